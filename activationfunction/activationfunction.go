@@ -1,12 +1,42 @@
 package activationfunction
 
-import "nn/mathext"
+import (
+	"fmt"
+	"math"
+	"nn/mathext"
 
+	"gonum.org/v1/gonum/mat"
+)
+
+// LayerActivationFunction maps the values of a whole layer (before activation) to its outputs.
+// JacobianVectorProduct takes the gradient with respect to the outputs and returns the gradient with respect to x.
+type LayerActivationFunction interface {
+	EvalLayer(x *mat.VecDense) *mat.VecDense
+	JacobianVectorProduct(x, grad *mat.VecDense) *mat.VecDense
+}
+
+// ActivationFunction is applied to each neuron of a layer independently
 type ActivationFunction struct {
 	Eval       func(float64) float64
 	Derivative func(float64) float64
 }
 
+func (activationFunction *ActivationFunction) EvalLayer(x *mat.VecDense) *mat.VecDense {
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, activationFunction.Eval(x.AtVec(i)))
+	}
+	return result
+}
+
+func (activationFunction *ActivationFunction) JacobianVectorProduct(x, grad *mat.VecDense) *mat.VecDense {
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, grad.AtVec(i)*activationFunction.Derivative(x.AtVec(i)))
+	}
+	return result
+}
+
 var Identity *ActivationFunction = &ActivationFunction{
 	Eval: func(x float64) float64 {
 		return x
@@ -25,5 +55,268 @@ var Sigmoid *ActivationFunction = &ActivationFunction{
 	},
 }
 
-var IntToActivationFunction = map[int]*ActivationFunction{0: Identity, 1: Sigmoid}
-var ActivationFunctionToInt = map[*ActivationFunction]int{Identity: 0, Sigmoid: 1}
+type softmax struct{}
+
+func (softmax) EvalLayer(x *mat.VecDense) *mat.VecDense {
+	logSumExp := mathext.LogSumExp(mat.Col(nil, 0, x))
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, math.Exp(x.AtVec(i)-logSumExp))
+	}
+	return result
+}
+
+func (softmax softmax) JacobianVectorProduct(x, grad *mat.VecDense) *mat.VecDense { //J = diag(y) - y y^T
+	y := softmax.EvalLayer(x)
+	dot := mat.Dot(y, grad)
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, y.AtVec(i)*(grad.AtVec(i)-dot))
+	}
+	return result
+}
+
+var Softmax LayerActivationFunction = softmax{}
+
+type logSoftmax struct{}
+
+func (logSoftmax) EvalLayer(x *mat.VecDense) *mat.VecDense {
+	logSumExp := mathext.LogSumExp(mat.Col(nil, 0, x))
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, x.AtVec(i)-logSumExp)
+	}
+	return result
+}
+
+func (logSoftmax) JacobianVectorProduct(x, grad *mat.VecDense) *mat.VecDense { //J = I - 1 softmax(x)^T
+	y := Softmax.EvalLayer(x)
+	gradSum := mat.Sum(grad)
+	result := mat.NewVecDense(x.Len(), nil)
+	for i := 0; i < x.Len(); i++ {
+		result.SetVec(i, grad.AtVec(i)-y.AtVec(i)*gradSum)
+	}
+	return result
+}
+
+var LogSoftmax LayerActivationFunction = logSoftmax{}
+
+// EvalBatch applies activationFunction to every row of x
+func EvalBatch(activationFunction LayerActivationFunction, x *mat.Dense) *mat.Dense {
+	numRows, numCols := x.Dims()
+	result := mat.NewDense(numRows, numCols, nil)
+	if elementwise, ok := activationFunction.(*ActivationFunction); ok {
+		result.Apply(func(_, _ int, v float64) float64 {
+			return elementwise.Eval(v)
+		}, x)
+		return result
+	}
+	for i := 0; i < numRows; i++ {
+		result.SetRow(i, activationFunction.EvalLayer(mat.VecDenseCopyOf(x.RowView(i))).RawVector().Data)
+	}
+	return result
+}
+
+// JacobianVectorProductBatch backpropagates each row of grad through activationFunction at the matching row of x
+func JacobianVectorProductBatch(activationFunction LayerActivationFunction, x, grad *mat.Dense) *mat.Dense {
+	numRows, numCols := x.Dims()
+	result := mat.NewDense(numRows, numCols, nil)
+	if elementwise, ok := activationFunction.(*ActivationFunction); ok {
+		result.Apply(func(i, j int, v float64) float64 {
+			return v * elementwise.Derivative(x.At(i, j))
+		}, grad)
+		return result
+	}
+	for i := 0; i < numRows; i++ {
+		result.SetRow(i, activationFunction.JacobianVectorProduct(mat.VecDenseCopyOf(x.RowView(i)), mat.VecDenseCopyOf(grad.RowView(i))).RawVector().Data)
+	}
+	return result
+}
+
+func NewLeakyReLU(alpha float64) *ActivationFunction {
+	return &ActivationFunction{
+		Eval: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return alpha * x
+		},
+		Derivative: func(x float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return alpha
+		},
+	}
+}
+
+func NewELU(alpha float64) *ActivationFunction {
+	return &ActivationFunction{
+		Eval: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return alpha * (math.Exp(x) - 1)
+		},
+		Derivative: func(x float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return alpha * math.Exp(x)
+		},
+	}
+}
+
+var ReLU *ActivationFunction = NewLeakyReLU(0)
+
+// LeakyReLUAlpha is the slope of LeakyReLU for negative inputs
+const LeakyReLUAlpha = 0.01
+
+var LeakyReLU *ActivationFunction = NewLeakyReLU(LeakyReLUAlpha)
+
+var ELU *ActivationFunction = NewELU(1)
+
+// constants from Klambauer et al., "Self-Normalizing Neural Networks"
+const SELUAlpha = 1.6732632423543772
+const SELUScale = 1.0507009873554805
+
+var SELU *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		if x > 0 {
+			return SELUScale * x
+		}
+		return SELUScale * SELUAlpha * (math.Exp(x) - 1)
+	},
+	Derivative: func(x float64) float64 {
+		if x > 0 {
+			return SELUScale
+		}
+		return SELUScale * SELUAlpha * math.Exp(x)
+	},
+}
+
+var GELU *ActivationFunction = &ActivationFunction{ //exact form x * Phi(x), not the tanh approximation
+	Eval: func(x float64) float64 {
+		return x * mathext.NormalCDF(x)
+	},
+	Derivative: func(x float64) float64 {
+		return mathext.NormalCDF(x) + x*mathext.NormalPDF(x)
+	},
+}
+
+var Swish *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		return x * mathext.Sigmoid(x)
+	},
+	Derivative: func(x float64) float64 {
+		sigmoid := mathext.Sigmoid(x)
+		return sigmoid + x*sigmoid*(1-sigmoid)
+	},
+}
+
+var SiLU *ActivationFunction = Swish
+
+var Tanh *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		return math.Tanh(x)
+	},
+	Derivative: func(x float64) float64 {
+		return 1 - math.Tanh(x)*math.Tanh(x)
+	},
+}
+
+var Softplus *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		return mathext.Softplus(x)
+	},
+	Derivative: func(x float64) float64 {
+		return mathext.Sigmoid(x)
+	},
+}
+
+var HardSigmoid *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		return math.Max(0, math.Min(1, x/6+0.5))
+	},
+	Derivative: func(x float64) float64 {
+		if -3 < x && x < 3 {
+			return float64(1) / 6
+		}
+		return 0
+	},
+}
+
+var Mish *ActivationFunction = &ActivationFunction{
+	Eval: func(x float64) float64 {
+		return x * math.Tanh(mathext.Softplus(x))
+	},
+	Derivative: func(x float64) float64 {
+		tanh := math.Tanh(mathext.Softplus(x))
+		return tanh + x*(1-tanh*tanh)*mathext.Sigmoid(x)
+	},
+}
+
+// names the built-in activation functions are registered under
+const (
+	IdentityName    = "identity"
+	SigmoidName     = "sigmoid"
+	SoftmaxName     = "softmax"
+	LogSoftmaxName  = "logSoftmax"
+	ReLUName        = "relu"
+	LeakyReLUName   = "leakyRelu"
+	ELUName         = "elu"
+	SELUName        = "selu"
+	GELUName        = "gelu"
+	SwishName       = "swish"
+	SiLUName        = "silu"
+	TanhName        = "tanh"
+	SoftplusName    = "softplus"
+	HardSigmoidName = "hardSigmoid"
+	MishName        = "mish"
+)
+
+var nameToActivationFunction = map[string]LayerActivationFunction{}
+var activationFunctionToName = map[LayerActivationFunction]string{}
+
+// Register makes activationFunction available under name, which is what gets stored in JSON networks.
+// Registering the same function under several names is allowed and the first name is used when encoding.
+func Register(name string, activationFunction LayerActivationFunction) {
+	if _, ok := nameToActivationFunction[name]; ok {
+		panic(fmt.Sprintf("activation function %q is already registered", name))
+	}
+	nameToActivationFunction[name] = activationFunction
+	if _, ok := activationFunctionToName[activationFunction]; !ok {
+		activationFunctionToName[activationFunction] = name
+	}
+}
+
+func Get(name string) (LayerActivationFunction, bool) {
+	activationFunction, ok := nameToActivationFunction[name]
+	return activationFunction, ok
+}
+
+func Name(activationFunction LayerActivationFunction) (string, bool) {
+	name, ok := activationFunctionToName[activationFunction]
+	return name, ok
+}
+
+func init() {
+	Register(IdentityName, Identity)
+	Register(SigmoidName, Sigmoid)
+	Register(SoftmaxName, Softmax)
+	Register(LogSoftmaxName, LogSoftmax)
+	Register(ReLUName, ReLU)
+	Register(LeakyReLUName, LeakyReLU)
+	Register(ELUName, ELU)
+	Register(SELUName, SELU)
+	Register(GELUName, GELU)
+	Register(SwishName, Swish)
+	Register(SiLUName, SiLU)
+	Register(TanhName, Tanh)
+	Register(SoftplusName, Softplus)
+	Register(HardSigmoidName, HardSigmoid)
+	Register(MishName, Mish)
+}
+
+// LegacyIntToName maps the integer codes used by older JSON networks, which only had identity and sigmoid, to registered names
+var LegacyIntToName = map[int]string{0: IdentityName, 1: SigmoidName}
@@ -0,0 +1,132 @@
+package autograd
+
+import (
+	"fmt"
+	"math"
+	"nn/activationfunction"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func positive(x float64) bool {
+	return x > 0
+}
+
+func ReLU(x *Tensor) *Tensor {
+	return LeakyReLU(x, 0)
+}
+
+func LeakyReLU(x *Tensor, alpha float64) *Tensor {
+	return Where(positive, x, Scale(x, alpha))
+}
+
+// ELU only takes the exponential of non-positive values, so that the unused branch can't overflow
+func ELU(x *Tensor, alpha float64) *Tensor {
+	return Where(positive, x, Scale(Shift(Exp(Minimum(x, x.Tape().Scalar(0))), -1), alpha))
+}
+
+func SELU(x *Tensor) *Tensor {
+	return Scale(ELU(x, activationfunction.SELUAlpha), activationfunction.SELUScale)
+}
+
+// GELU is x times the standard normal CDF, written with Erf
+func GELU(x *Tensor) *Tensor {
+	return Mul(x, Scale(Shift(Erf(Scale(x, 1/math.Sqrt2)), 1), 0.5))
+}
+
+func Swish(x *Tensor) *Tensor {
+	return Mul(x, Sigmoid(x))
+}
+
+func Mish(x *Tensor) *Tensor {
+	return Mul(x, Tanh(Softplus(x)))
+}
+
+// HardSigmoid has a gradient of 0 where it meets its bounds
+func HardSigmoid(x *Tensor) *Tensor {
+	belowOne := Where(func(y float64) bool { return y < 1 }, Shift(Scale(x, float64(1)/6), 0.5), x.Tape().Scalar(1))
+	return Where(positive, belowOne, x.Tape().Scalar(0))
+}
+
+// LogSumExp is log(sum(exp(x))) of each row as a column, shifted by the row's maximum to avoid overflow
+func LogSumExp(x *Tensor) *Tensor {
+	max := x.Tape().Constant(MaxCols(x).Value)
+	return Add(max, Log(SumCols(Exp(Sub(x, max)))))
+}
+
+// LogSoftmax and Softmax work on each row
+func LogSoftmax(x *Tensor) *Tensor {
+	return Sub(x, LogSumExp(x))
+}
+
+func Softmax(x *Tensor) *Tensor {
+	return Exp(LogSoftmax(x))
+}
+
+var nameToExpression = map[string]func(x *Tensor) *Tensor{}
+
+// Register gives the activation function registered under name in package activationfunction an expression, which Activate uses
+func Register(name string, expression func(x *Tensor) *Tensor) {
+	if _, ok := nameToExpression[name]; ok {
+		panic(fmt.Sprintf("expression for %q is already registered", name))
+	}
+	nameToExpression[name] = expression
+}
+
+// Activate applies activationFunction to each row of x. Registered activation functions use their expressions,
+// other elementwise ones their Eval and Derivative and the rest their EvalLayer and JacobianVectorProduct.
+func Activate(x *Tensor, activationFunction activationfunction.LayerActivationFunction) *Tensor {
+	if name, ok := activationfunction.Name(activationFunction); ok {
+		if expression, ok := nameToExpression[name]; ok {
+			return expression(x)
+		}
+	}
+	switch activationFunction := activationFunction.(type) {
+	case *Expression:
+		return activationFunction.Expression(x)
+	case *activationfunction.ActivationFunction:
+		return Map(x, activationFunction.Eval, func(x, _ float64) float64 { return activationFunction.Derivative(x) })
+	}
+	return newResult(activationfunction.EvalBatch(activationFunction, x.Value), func(grad *mat.Dense) {
+		x.accumulate(activationfunction.JacobianVectorProductBatch(activationFunction, x.Value, grad))
+	}, x)
+}
+
+// Expression turns an activation function written as operations on a row into an activationfunction.LayerActivationFunction,
+// so new activation functions don't need a hand-written derivative
+type Expression struct {
+	Expression func(x *Tensor) *Tensor
+}
+
+func NewExpression(expression func(x *Tensor) *Tensor) *Expression {
+	return &Expression{Expression: expression}
+}
+
+func (expression *Expression) EvalLayer(x *mat.VecDense) *mat.VecDense {
+	result := expression.Expression(NewTape().Constant(mat.NewDense(1, x.Len(), mat.Col(nil, 0, x))))
+	return mat.NewVecDense(x.Len(), mat.DenseCopyOf(result.Value).RawMatrix().Data)
+}
+
+func (expression *Expression) JacobianVectorProduct(x, grad *mat.VecDense) *mat.VecDense {
+	input := NewTape().Variable(mat.NewDense(1, x.Len(), mat.Col(nil, 0, x)))
+	expression.Expression(input).BackwardWith(mat.NewDense(1, grad.Len(), mat.Col(nil, 0, grad)))
+	return mat.NewVecDense(x.Len(), input.Grad.RawMatrix().Data)
+}
+
+func init() {
+	Register(activationfunction.IdentityName, func(x *Tensor) *Tensor { return x })
+	Register(activationfunction.SigmoidName, Sigmoid)
+	Register(activationfunction.SoftmaxName, Softmax)
+	Register(activationfunction.LogSoftmaxName, LogSoftmax)
+	Register(activationfunction.ReLUName, ReLU)
+	Register(activationfunction.LeakyReLUName, func(x *Tensor) *Tensor { return LeakyReLU(x, activationfunction.LeakyReLUAlpha) })
+	Register(activationfunction.ELUName, func(x *Tensor) *Tensor { return ELU(x, 1) })
+	Register(activationfunction.SELUName, SELU)
+	Register(activationfunction.GELUName, GELU)
+	Register(activationfunction.SwishName, Swish)
+	Register(activationfunction.SiLUName, Swish)
+	Register(activationfunction.TanhName, Tanh)
+	Register(activationfunction.SoftplusName, Softplus)
+	Register(activationfunction.HardSigmoidName, HardSigmoid)
+	Register(activationfunction.MishName, Mish)
+}
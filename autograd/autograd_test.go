@@ -0,0 +1,61 @@
+package autograd
+
+import (
+	"math"
+	"nn/activationfunction"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestOpsGradients(t *testing.T) {
+	tape := NewTape()
+	a := tape.Variable(mat.NewDense(2, 3, []float64{1, 2, 3, 4, 5, 6}))
+	b := tape.Variable(mat.NewDense(3, 2, []float64{0.5, -1, 2, 0.1, -0.3, 0.7}))
+	bias := tape.Variable(mat.NewDense(1, 2, []float64{0.1, 0.2}))
+	record := func() *Tensor {
+		m := Add(MatMul(a, b), bias)
+		r := Reshape(Tanh(m), 1, 4)
+		s := Sub(SumRows(Transpose(Rows(Transpose(r), []int{0, 3, 3}))), Div(MeanCols(m), Scale(SumCols(Pow(Abs(m), 2)), 0.3)))
+		c := ConcatColumns(Index(m, 1, 0), Slice(a, 0, 2, 1, 3))
+		return Add(Sum(Mul(s, s)), Add(Mean(Maximum(c, tape.Scalar(2.5))), Sum(Minimum(Exp(Scale(a, 0.1)), Log(Shift(a, 1))))))
+	}
+	record().Backward()
+
+	for _, variable := range []*Tensor{a, b, bias} {
+		grad := mat.DenseCopyOf(variable.Grad)
+		numRows, numCols := variable.Dims()
+		for i := 0; i < numRows; i++ {
+			for j := 0; j < numCols; j++ {
+				value := variable.Value.At(i, j)
+				variable.Value.Set(i, j, value+1e-6)
+				above := record().Scalar()
+				variable.Value.Set(i, j, value-1e-6)
+				below := record().Scalar()
+				variable.Value.Set(i, j, value)
+				if numerical := (above - below) / 2e-6; math.Abs(numerical-grad.At(i, j)) > 1e-6 {
+					t.Errorf("gradient at (%d, %d) is %g, finite differences give %g", i, j, grad.At(i, j), numerical)
+				}
+			}
+		}
+	}
+}
+
+func TestActivationsMatchActivationFunctions(t *testing.T) {
+	x := mat.NewDense(3, 5, []float64{-3.5, -1, -0.2, 0.3, 2, 1, 2, 3, 4, 5, -800, -30, 0.5, 30, 800})
+	outputGrad := mat.NewDense(3, 5, nil)
+	outputGrad.Apply(func(i, j int, _ float64) float64 { return math.Sin(float64(3*i + j + 1)) }, outputGrad)
+	for name := range nameToExpression {
+		activationFunction, _ := activationfunction.Get(name)
+		tape := NewTape()
+		input := tape.Variable(x)
+		output := Activate(input, activationFunction)
+		output.BackwardWith(outputGrad)
+		if want := activationfunction.EvalBatch(activationFunction, x); !mat.EqualApprox(output.Value, want, 1e-9) {
+			t.Errorf("%s: output %v, want %v", name, mat.Formatted(output.Value), mat.Formatted(want))
+		}
+		if want := activationfunction.JacobianVectorProductBatch(activationFunction, x, outputGrad); !mat.EqualApprox(input.Grad, want, 1e-9) {
+			t.Errorf("%s: gradient %v, want %v", name, mat.Formatted(input.Grad), mat.Formatted(want))
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package autograd
+
+import (
+	"fmt"
+	"math"
+	"nn/mathext"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// broadcastDims is the shape of an elementwise operation on a and b. Either may have a single row, column or value,
+// which is repeated to match the other, e.g. adding a 1 x n bias to every row.
+func broadcastDims(a, b *Tensor) (int, int) {
+	aRows, aCols := a.Dims()
+	bRows, bCols := b.Dims()
+	broadcast := func(x, y int) int {
+		if x == y || y == 1 {
+			return x
+		}
+		if x == 1 {
+			return y
+		}
+		panic(fmt.Sprintf("can't broadcast %v x %v and %v x %v tensors", aRows, aCols, bRows, bCols))
+	}
+	return broadcast(aRows, bRows), broadcast(aCols, bCols)
+}
+
+// expand repeats the single row or column of matrix to fill numRows x numCols
+func expand(matrix *mat.Dense, numRows, numCols int) *mat.Dense {
+	if sameDims(matrix, numRows, numCols) {
+		return matrix
+	}
+	currRows, currCols := matrix.Dims()
+	result := mat.NewDense(numRows, numCols, nil)
+	result.Apply(func(i, j int, _ float64) float64 {
+		return matrix.At(i%currRows, j%currCols)
+	}, result)
+	return result
+}
+
+// reduce sums grad over the rows or columns that were broadcast to turn a numRows x numCols tensor into grad's shape
+func reduce(grad *mat.Dense, numRows, numCols int) *mat.Dense {
+	if sameDims(grad, numRows, numCols) {
+		return grad
+	}
+	result := mat.NewDense(numRows, numCols, nil)
+	gradRows, gradCols := grad.Dims()
+	for i := 0; i < gradRows; i++ {
+		for j := 0; j < gradCols; j++ {
+			result.Set(i%numRows, j%numCols, result.At(i%numRows, j%numCols)+grad.At(i, j))
+		}
+	}
+	return result
+}
+
+// binary applies eval to each pair of broadcast values of a and b.
+// gradA and gradB are the partial derivatives of eval given its inputs x, y and output z.
+func binary(a, b *Tensor, eval func(x, y float64) float64, gradA, gradB func(x, y, z float64) float64) *Tensor {
+	numRows, numCols := broadcastDims(a, b)
+	x := expand(a.Value, numRows, numCols)
+	y := expand(b.Value, numRows, numCols)
+	value := mat.NewDense(numRows, numCols, nil)
+	value.Apply(func(i, j int, _ float64) float64 {
+		return eval(x.At(i, j), y.At(i, j))
+	}, value)
+	return newResult(value, func(grad *mat.Dense) {
+		for _, input := range []struct {
+			tensor  *Tensor
+			partial func(x, y, z float64) float64
+		}{{a, gradA}, {b, gradB}} {
+			if !input.tensor.requiresGrad {
+				continue
+			}
+			inputGrad := mat.NewDense(numRows, numCols, nil)
+			inputGrad.Apply(func(i, j int, g float64) float64 {
+				return g * input.partial(x.At(i, j), y.At(i, j), value.At(i, j))
+			}, grad)
+			inputRows, inputCols := input.tensor.Dims()
+			input.tensor.accumulate(reduce(inputGrad, inputRows, inputCols))
+		}
+	}, a, b)
+}
+
+func Add(a, b *Tensor) *Tensor {
+	return binary(a, b, func(x, y float64) float64 { return x + y },
+		func(_, _, _ float64) float64 { return 1 },
+		func(_, _, _ float64) float64 { return 1 })
+}
+
+func Sub(a, b *Tensor) *Tensor {
+	return binary(a, b, func(x, y float64) float64 { return x - y },
+		func(_, _, _ float64) float64 { return 1 },
+		func(_, _, _ float64) float64 { return -1 })
+}
+
+// Mul multiplies elementwise, see MatMul for the matrix product
+func Mul(a, b *Tensor) *Tensor {
+	return binary(a, b, func(x, y float64) float64 { return x * y },
+		func(_, y, _ float64) float64 { return y },
+		func(x, _, _ float64) float64 { return x })
+}
+
+func Div(a, b *Tensor) *Tensor {
+	return binary(a, b, func(x, y float64) float64 { return x / y },
+		func(_, y, _ float64) float64 { return 1 / y },
+		func(_, y, z float64) float64 { return -z / y })
+}
+
+// Maximum takes the larger value of each pair, sending the gradient to a on ties
+func Maximum(a, b *Tensor) *Tensor {
+	return binary(a, b, math.Max,
+		func(x, y, _ float64) float64 { return indicator(x >= y) },
+		func(x, y, _ float64) float64 { return indicator(x < y) })
+}
+
+// Minimum takes the smaller value of each pair, sending the gradient to a on ties
+func Minimum(a, b *Tensor) *Tensor {
+	return binary(a, b, math.Min,
+		func(x, y, _ float64) float64 { return indicator(x <= y) },
+		func(x, y, _ float64) float64 { return indicator(x > y) })
+}
+
+func indicator(condition bool) float64 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// Where picks a's value where condition holds for a's value and b's elsewhere, e.g. for piecewise functions
+func Where(condition func(x float64) bool, a, b *Tensor) *Tensor {
+	return binary(a, b, func(x, y float64) float64 {
+		if condition(x) {
+			return x
+		}
+		return y
+	}, func(x, _, _ float64) float64 { return indicator(condition(x)) },
+		func(x, _, _ float64) float64 { return indicator(!condition(x)) })
+}
+
+// Scale multiplies every value by a constant
+func Scale(a *Tensor, scale float64) *Tensor {
+	return Map(a, func(x float64) float64 { return scale * x }, func(_, _ float64) float64 { return scale })
+}
+
+// Shift adds a constant to every value
+func Shift(a *Tensor, shift float64) *Tensor {
+	return Map(a, func(x float64) float64 { return x + shift }, func(_, _ float64) float64 { return 1 })
+}
+
+func Neg(a *Tensor) *Tensor {
+	return Scale(a, -1)
+}
+
+// Map applies eval to each value. derivative takes the input x and output y, so functions like exp can reuse y.
+func Map(a *Tensor, eval func(x float64) float64, derivative func(x, y float64) float64) *Tensor {
+	value := &mat.Dense{}
+	value.Apply(func(_, _ int, x float64) float64 { return eval(x) }, a.Value)
+	return newResult(value, func(grad *mat.Dense) {
+		inputGrad := &mat.Dense{}
+		inputGrad.Apply(func(i, j int, g float64) float64 {
+			return g * derivative(a.Value.At(i, j), value.At(i, j))
+		}, grad)
+		a.accumulate(inputGrad)
+	}, a)
+}
+
+func Exp(a *Tensor) *Tensor {
+	return Map(a, math.Exp, func(_, y float64) float64 { return y })
+}
+
+func Log(a *Tensor) *Tensor {
+	return Map(a, math.Log, func(x, _ float64) float64 { return 1 / x })
+}
+
+func Pow(a *Tensor, power float64) *Tensor {
+	return Map(a, func(x float64) float64 { return math.Pow(x, power) }, func(x, _ float64) float64 { return power * math.Pow(x, power-1) })
+}
+
+// Abs has a gradient of 0 at 0
+func Abs(a *Tensor) *Tensor {
+	return Map(a, math.Abs, func(x, _ float64) float64 { return indicator(x > 0) - indicator(x < 0) })
+}
+
+func Tanh(a *Tensor) *Tensor {
+	return Map(a, math.Tanh, func(_, y float64) float64 { return 1 - y*y })
+}
+
+// Sigmoid is a primitive rather than 1 / (1 + exp(-x)) so that large inputs don't overflow into NaN gradients
+func Sigmoid(a *Tensor) *Tensor {
+	return Map(a, mathext.Sigmoid, func(_, y float64) float64 { return y * (1 - y) })
+}
+
+// Softplus is a primitive for the same reason as Sigmoid
+func Softplus(a *Tensor) *Tensor {
+	return Map(a, mathext.Softplus, func(x, _ float64) float64 { return mathext.Sigmoid(x) })
+}
+
+func Erf(a *Tensor) *Tensor {
+	return Map(a, math.Erf, func(x, _ float64) float64 { return 2 / math.Sqrt(math.Pi) * math.Exp(-x*x) })
+}
+
+// MatMul is the matrix product of a (n x k) and b (k x m)
+func MatMul(a, b *Tensor) *Tensor {
+	value := &mat.Dense{}
+	value.Mul(a.Value, b.Value)
+	return newResult(value, func(grad *mat.Dense) {
+		if a.requiresGrad {
+			aGrad := &mat.Dense{}
+			aGrad.Mul(grad, b.Value.T())
+			a.accumulate(aGrad)
+		}
+		if b.requiresGrad {
+			bGrad := &mat.Dense{}
+			bGrad.Mul(a.Value.T(), grad)
+			b.accumulate(bGrad)
+		}
+	}, a, b)
+}
+
+func Transpose(a *Tensor) *Tensor {
+	return newResult(mat.DenseCopyOf(a.Value.T()), func(grad *mat.Dense) {
+		a.accumulate(grad.T())
+	}, a)
+}
+
+// Sum adds up every value into a scalar
+func Sum(a *Tensor) *Tensor {
+	numRows, numCols := a.Dims()
+	return newResult(mat.NewDense(1, 1, []float64{mat.Sum(a.Value)}), func(grad *mat.Dense) {
+		a.accumulate(expand(grad, numRows, numCols))
+	}, a)
+}
+
+func Mean(a *Tensor) *Tensor {
+	numRows, numCols := a.Dims()
+	return Scale(Sum(a), 1/float64(numRows*numCols))
+}
+
+// SumRows adds up the rows of a into a single row
+func SumRows(a *Tensor) *Tensor {
+	numRows, numCols := a.Dims()
+	return newResult(reduce(a.Value, 1, numCols), func(grad *mat.Dense) {
+		a.accumulate(expand(grad, numRows, numCols))
+	}, a)
+}
+
+// SumCols adds up the columns of a into a single column
+func SumCols(a *Tensor) *Tensor {
+	numRows, numCols := a.Dims()
+	return newResult(reduce(a.Value, numRows, 1), func(grad *mat.Dense) {
+		a.accumulate(expand(grad, numRows, numCols))
+	}, a)
+}
+
+// MeanRows averages the rows of a into a single row
+func MeanRows(a *Tensor) *Tensor {
+	numRows, _ := a.Dims()
+	return Scale(SumRows(a), 1/float64(numRows))
+}
+
+// MeanCols averages the columns of a into a single column
+func MeanCols(a *Tensor) *Tensor {
+	_, numCols := a.Dims()
+	return Scale(SumCols(a), 1/float64(numCols))
+}
+
+// MaxCols takes the largest value of each row into a single column, with the gradient going to the first largest value
+func MaxCols(a *Tensor) *Tensor {
+	numRows, _ := a.Dims()
+	indices := make([]int, numRows)
+	value := mat.NewDense(numRows, 1, nil)
+	for i := 0; i < numRows; i++ {
+		row := a.Value.RawRowView(i)
+		for j := range row {
+			if row[j] > row[indices[i]] {
+				indices[i] = j
+			}
+		}
+		value.Set(i, 0, row[indices[i]])
+	}
+	return newResult(value, func(grad *mat.Dense) {
+		numRows, numCols := a.Dims()
+		inputGrad := mat.NewDense(numRows, numCols, nil)
+		for i, j := range indices {
+			inputGrad.Set(i, j, grad.At(i, 0))
+		}
+		a.accumulate(inputGrad)
+	}, a)
+}
+
+// Reshape reads a's values row by row into a numRows x numCols tensor
+func Reshape(a *Tensor, numRows, numCols int) *Tensor {
+	currRows, currCols := a.Dims()
+	if currRows*currCols != numRows*numCols {
+		panic(fmt.Sprintf("can't reshape %v x %v into %v x %v", currRows, currCols, numRows, numCols))
+	}
+	return newResult(mat.NewDense(numRows, numCols, mat.DenseCopyOf(a.Value).RawMatrix().Data), func(grad *mat.Dense) {
+		a.accumulate(mat.NewDense(currRows, currCols, mat.DenseCopyOf(grad).RawMatrix().Data))
+	}, a)
+}
+
+// Slice is rows i..k-1 and columns j..l-1 of a, like mat.Dense.Slice
+func Slice(a *Tensor, i, k, j, l int) *Tensor {
+	numRows, numCols := a.Dims()
+	return newResult(mat.DenseCopyOf(a.Value.Slice(i, k, j, l)), func(grad *mat.Dense) {
+		inputGrad := mat.NewDense(numRows, numCols, nil)
+		inputGrad.Slice(i, k, j, l).(*mat.Dense).Copy(grad)
+		a.accumulate(inputGrad)
+	}, a)
+}
+
+// Index is the value at row i and column j as a scalar
+func Index(a *Tensor, i, j int) *Tensor {
+	return Slice(a, i, i+1, j, j+1)
+}
+
+// Rows gathers the rows of a at indices, which may repeat, e.g. looking up embeddings
+func Rows(a *Tensor, indices []int) *Tensor {
+	numRows, numCols := a.Dims()
+	value := mat.NewDense(len(indices), numCols, nil)
+	for i, index := range indices {
+		value.SetRow(i, a.Value.RawRowView(index))
+	}
+	return newResult(value, func(grad *mat.Dense) {
+		inputGrad := mat.NewDense(numRows, numCols, nil)
+		for i, index := range indices {
+			row := inputGrad.RawRowView(index)
+			for j, g := range grad.RawRowView(i) {
+				row[j] += g
+			}
+		}
+		a.accumulate(inputGrad)
+	}, a)
+}
+
+// ConcatColumns joins the columns of tensors with the same number of rows
+func ConcatColumns(tensors ...*Tensor) *Tensor {
+	numRows, _ := tensors[0].Dims()
+	numCols := 0
+	for _, tensor := range tensors {
+		_, currCols := tensor.Dims()
+		numCols += currCols
+	}
+	value := mat.NewDense(numRows, numCols, nil)
+	start := 0
+	for _, tensor := range tensors {
+		_, currCols := tensor.Dims()
+		value.Slice(0, numRows, start, start+currCols).(*mat.Dense).Copy(tensor.Value)
+		start += currCols
+	}
+	return newResult(value, func(grad *mat.Dense) {
+		start := 0
+		for _, tensor := range tensors {
+			_, currCols := tensor.Dims()
+			tensor.accumulate(grad.Slice(0, numRows, start, start+currCols))
+			start += currCols
+		}
+	}, tensors...)
+}
@@ -0,0 +1,138 @@
+package autograd
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Tape records the operations on its tensors in the order they were made, so Backward can replay them in reverse
+type Tape struct {
+	tensors []*Tensor
+}
+
+// Tensor is a matrix value on a tape. Vectors are 1 x n or n x 1 matrices and scalars are 1 x 1.
+type Tensor struct {
+	Value *mat.Dense
+	Grad  *mat.Dense //gradient of the last Backward's output with respect to Value, accumulated across calls for variables
+
+	tape         *Tape
+	requiresGrad bool                  //whether gradients flow to this tensor, true for variables and anything computed from them
+	backward     func(grad *mat.Dense) //passes this tensor's gradient on to the tensors it was computed from, nil for constants and variables
+}
+
+func NewTape() *Tape {
+	return &Tape{}
+}
+
+func (tape *Tape) record(tensor *Tensor) *Tensor {
+	tensor.tape = tape
+	tape.tensors = append(tape.tensors, tensor)
+	return tensor
+}
+
+// Variable is a tensor whose gradient Backward computes, such as a parameter. Value is aliased, not copied.
+func (tape *Tape) Variable(value *mat.Dense) *Tensor {
+	return tape.record(&Tensor{Value: value, requiresGrad: true})
+}
+
+// Constant is a tensor Backward doesn't compute a gradient for, such as an input. Value is aliased, not copied.
+func (tape *Tape) Constant(value *mat.Dense) *Tensor {
+	return tape.record(&Tensor{Value: value})
+}
+
+// Scalar is a 1 x 1 constant, which broadcasts against tensors of any shape
+func (tape *Tape) Scalar(value float64) *Tensor {
+	return tape.Constant(mat.NewDense(1, 1, []float64{value}))
+}
+
+// ZeroGrad clears the accumulated gradients of every variable on the tape
+func (tape *Tape) ZeroGrad() {
+	for _, tensor := range tape.tensors {
+		tensor.Grad = nil
+	}
+}
+
+// Tape is the tape tensor is recorded on, for making constants to combine with it
+func (tensor *Tensor) Tape() *Tape {
+	return tensor.tape
+}
+
+func (tensor *Tensor) Dims() (int, int) {
+	return tensor.Value.Dims()
+}
+
+// Scalar returns the value of a 1 x 1 tensor
+func (tensor *Tensor) Scalar() float64 {
+	if numRows, numCols := tensor.Dims(); numRows != 1 || numCols != 1 {
+		panic(fmt.Sprintf("%v x %v tensor is not a scalar", numRows, numCols))
+	}
+	return tensor.Value.At(0, 0)
+}
+
+// Backward computes the gradients of the sum of tensor's values with respect to every variable it was computed from
+func (tensor *Tensor) Backward() {
+	numRows, numCols := tensor.Dims()
+	seed := mat.NewDense(numRows, numCols, nil)
+	seed.Apply(func(_, _ int, _ float64) float64 { return 1 }, seed)
+	tensor.BackwardWith(seed)
+}
+
+// BackwardWith computes the vector-Jacobian product of grad, the gradient of some cost with respect to tensor,
+// with every tensor it was computed from. Variables' gradients add up over calls until ZeroGrad.
+func (tensor *Tensor) BackwardWith(grad *mat.Dense) {
+	if tensor.tape == nil {
+		panic("tensor is not on a tape")
+	}
+	if numRows, numCols := tensor.Dims(); !sameDims(grad, numRows, numCols) {
+		panic(fmt.Sprintf("gradient doesn't match a %v x %v tensor", numRows, numCols))
+	}
+	tensors := tensor.tape.tensors
+	end := len(tensors) - 1
+	for tensors[end] != tensor {
+		end--
+	}
+	for i := 0; i <= end; i++ {
+		if tensors[i].backward != nil {
+			tensors[i].Grad = nil
+		}
+	}
+	tensor.accumulate(grad)
+	for i := end; i >= 0; i-- {
+		if tensors[i].backward != nil && tensors[i].Grad != nil {
+			tensors[i].backward(tensors[i].Grad)
+		}
+	}
+}
+
+func sameDims(matrix mat.Matrix, numRows, numCols int) bool {
+	currRows, currCols := matrix.Dims()
+	return currRows == numRows && currCols == numCols
+}
+
+// accumulate adds grad to tensor's gradient if gradients flow to it
+func (tensor *Tensor) accumulate(grad mat.Matrix) {
+	if !tensor.requiresGrad {
+		return
+	}
+	if tensor.Grad == nil {
+		tensor.Grad = mat.DenseCopyOf(grad)
+		return
+	}
+	tensor.Grad.Add(tensor.Grad, grad)
+}
+
+// newResult records the result of an operation on inputs, which only needs a backward function if gradients flow to one of them
+func newResult(value *mat.Dense, backward func(grad *mat.Dense), inputs ...*Tensor) *Tensor {
+	result := &Tensor{Value: value}
+	for _, input := range inputs {
+		if input.tape != inputs[0].tape {
+			panic("tensors are on different tapes")
+		}
+		if input.requiresGrad {
+			result.requiresGrad = true
+			result.backward = backward
+		}
+	}
+	return inputs[0].tape.record(result)
+}
@@ -0,0 +1,349 @@
+package callback
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"nn/checkpoint"
+	"nn/codec"
+	"nn/feedforward"
+	"nn/layer"
+	"nn/mathext"
+	"nn/metrics"
+	"nn/model"
+	"nn/optimizer"
+	"nn/random"
+	"strconv"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// State is what callbacks see during training. Callbacks may set Stop to end training after the current
+// step, epoch or generation, or set Err to end it with an error.
+type State struct {
+	Network          model.Model            //the network being trained, or the best one so far in the genetic algorithm
+	Pool             []*feedforward.Network //genetic algorithm population
+	Optimizer        optimizer.Optimizer    //nil in the genetic algorithm
+	NumEpochs        int                    //planned number of epochs, 0 when training by steps
+	Step             int                    //number of steps completed
+	Epoch            int                    //number of epochs completed
+	Batch            int                    //number of batches completed in the current epoch
+	EpochCost        float64                //sum of the costs of those batches
+	EpochRandomState uint64                 //random state the current epoch was shuffled with
+	Generation       int                    //number of generations completed
+	Cost             float64                //cost of the last step or epoch, or the best cost so far in the genetic algorithm
+	AvgCost          float64                //average cost of the genetic algorithm's pool in the last generation
+	Costs            []float64              //cost of every step, epoch or generation so far
+	Validation       *metrics.Report        //set when the network was just evaluated on the validation set
+
+	Stop bool
+	Err  error
+}
+
+type Callback interface {
+	OnStepEnd(state *State)
+	OnEpochEnd(state *State)
+	OnGenerationEnd(state *State)
+	OnTrainEnd(state *State)
+}
+
+// Resumable is a callback with progress of its own, which Checkpoint saves so that a resumed run continues it
+type Resumable interface {
+	Callback
+	SaveState() (json.RawMessage, error)
+	RestoreState(data json.RawMessage) error
+}
+
+// Base does nothing on every event, embed it to only implement some of them
+type Base struct{}
+
+func (Base) OnStepEnd(state *State)       {}
+func (Base) OnEpochEnd(state *State)      {}
+func (Base) OnGenerationEnd(state *State) {}
+func (Base) OnTrainEnd(state *State)      {}
+
+// Progress prints costs and validation reports
+type Progress struct {
+	Writer       io.Writer
+	AvgCostRange int //number of steps averaged in the printed cost when training by steps
+}
+
+func (progress *Progress) OnStepEnd(state *State) {
+	if state.NumEpochs == 0 {
+		fmt.Fprintf(progress.Writer, "Step %v | cost %v\n", state.Step-1, mathext.Average(state.Costs[int(math.Max(0, float64(len(state.Costs)-progress.AvgCostRange))):]))
+		if state.Validation != nil {
+			fmt.Fprint(progress.Writer, "Validation | ", state.Validation)
+		}
+	}
+}
+
+func (progress *Progress) OnEpochEnd(state *State) {
+	fmt.Fprintf(progress.Writer, "Epoch %v | cost %v\n", state.Epoch-1, state.Cost)
+	if state.Validation != nil {
+		fmt.Fprint(progress.Writer, "Validation | ", state.Validation)
+	}
+}
+
+func (progress *Progress) OnGenerationEnd(state *State) {
+	fmt.Fprintf(progress.Writer, "Step %v | avg cost %v | best cost %v\n", state.Generation-1, state.AvgCost, state.Cost)
+}
+
+func (progress *Progress) OnTrainEnd(state *State) {
+	if state.Stop {
+		fmt.Fprintln(progress.Writer, "Stopping early")
+	}
+}
+
+// CSVLogger writes one row per step when training by steps, per epoch when training by epochs, and per generation
+type CSVLogger struct {
+	Writer io.Writer
+
+	csvWriter *csv.Writer
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+func (logger *CSVLogger) log(state *State) {
+	if logger.csvWriter == nil {
+		logger.csvWriter = csv.NewWriter(logger.Writer)
+		logger.csvWriter.Write([]string{"step", "epoch", "generation", "cost", "validationLoss", "validationAccuracy"})
+	}
+	row := []string{strconv.Itoa(state.Step), strconv.Itoa(state.Epoch), strconv.Itoa(state.Generation), formatFloat(state.Cost), "", ""}
+	if state.Validation != nil {
+		row[4] = formatFloat(state.Validation.Loss)
+		row[5] = formatFloat(state.Validation.Accuracy)
+	}
+	logger.csvWriter.Write(row)
+	logger.csvWriter.Flush()
+	if err := logger.csvWriter.Error(); err != nil {
+		state.Err = err
+	}
+}
+
+func (logger *CSVLogger) OnStepEnd(state *State) {
+	if state.NumEpochs == 0 {
+		logger.log(state)
+	}
+}
+
+func (logger *CSVLogger) OnEpochEnd(state *State) {
+	logger.log(state)
+}
+
+func (logger *CSVLogger) OnGenerationEnd(state *State) {
+	logger.log(state)
+}
+
+func (logger *CSVLogger) OnTrainEnd(state *State) {}
+
+// Plot saves a plot of the cost history to Path when training ends
+type Plot struct {
+	Path         string
+	AvgCostRange int //number of costs averaged into each point when training by steps or generations
+}
+
+func SaveCostPlot(costs []float64, xLabel, yLabel, filename string) error {
+	avgCostPlot := plot.New()
+	avgCostPlot.X.Label.Text = xLabel
+	avgCostPlot.Y.Label.Text = yLabel
+
+	avgCostPlotPoints := make(plotter.XYs, len(costs))
+	for i := 0; i < len(costs); i++ {
+		avgCostPlotPoints[i].X = float64(i)
+		avgCostPlotPoints[i].Y = costs[i]
+	}
+	plotutil.AddLinePoints(avgCostPlot, "avg cost", avgCostPlotPoints)
+	return avgCostPlot.Save(4*vg.Inch, 4*vg.Inch, filename)
+}
+
+func (Plot) OnStepEnd(state *State)       {}
+func (Plot) OnEpochEnd(state *State)      {}
+func (Plot) OnGenerationEnd(state *State) {}
+
+func (plot *Plot) OnTrainEnd(state *State) {
+	var err error
+	if state.NumEpochs > 0 {
+		err = SaveCostPlot(state.Costs, "epoch", "avg cost", plot.Path)
+	} else {
+		err = SaveCostPlot(mathext.MovingAverages(state.Costs, plot.AvgCostRange), "step", fmt.Sprintf("avg cost (last %v steps)", plot.AvgCostRange), plot.Path)
+	}
+	if err != nil {
+		state.Err = err
+	}
+}
+
+// EarlyStopping keeps the network with the lowest validation loss and stops training once the loss hasn't improved for Patience evaluations
+type EarlyStopping struct {
+	Patience           int     //0 never stops training and only keeps track of the best network
+	MinDelta           float64 //smallest decrease in validation loss that counts as an improvement
+	RestoreBestWeights bool    //end training with the best network instead of the latest one
+	BestNetworkPath    string  //if set, the best network is written here when training ends
+
+	bestLoss              float64
+	bestNetwork           model.Model
+	numWithoutImprovement int
+	lastLoss              float64
+}
+
+func NewEarlyStopping(patience int, minDelta float64, restoreBestWeights bool, bestNetworkPath string) *EarlyStopping {
+	return &EarlyStopping{Patience: patience, MinDelta: minDelta, RestoreBestWeights: restoreBestWeights, BestNetworkPath: bestNetworkPath, bestLoss: math.Inf(1), lastLoss: math.NaN()}
+}
+
+// Restore picks up where the early stopping of a checkpointed run left off
+func (earlyStopping *EarlyStopping) Restore(resumeFrom *checkpoint.Checkpoint) error {
+	if resumeFrom.BestNetwork != nil {
+		bestNetwork, err := layer.DecodeModel(resumeFrom.BestNetwork)
+		if err != nil {
+			return err
+		}
+		earlyStopping.bestNetwork = bestNetwork
+		earlyStopping.bestLoss = resumeFrom.BestValidationLoss
+		earlyStopping.numWithoutImprovement = resumeFrom.NumWithoutImprovement
+		earlyStopping.lastLoss = resumeFrom.Cost
+	}
+	return nil
+}
+
+func (earlyStopping *EarlyStopping) BestNetwork() model.Model {
+	return earlyStopping.bestNetwork
+}
+
+func (earlyStopping *EarlyStopping) observe(state *State) {
+	if state.Validation == nil {
+		return
+	}
+	earlyStopping.lastLoss = state.Validation.Loss
+	if state.Validation.Loss < earlyStopping.bestLoss-earlyStopping.MinDelta {
+		bestNetwork, err := state.Network.Clone()
+		if err != nil {
+			state.Err = err
+			return
+		}
+		earlyStopping.bestLoss = state.Validation.Loss
+		earlyStopping.bestNetwork = bestNetwork
+		earlyStopping.numWithoutImprovement = 0
+		return
+	}
+	earlyStopping.numWithoutImprovement++
+	if earlyStopping.Patience > 0 && earlyStopping.numWithoutImprovement >= earlyStopping.Patience {
+		state.Stop = true
+	}
+}
+
+func (earlyStopping *EarlyStopping) OnStepEnd(state *State) {
+	earlyStopping.observe(state)
+}
+
+func (earlyStopping *EarlyStopping) OnEpochEnd(state *State) {
+	earlyStopping.observe(state)
+}
+
+func (earlyStopping *EarlyStopping) OnGenerationEnd(state *State) {}
+
+func (earlyStopping *EarlyStopping) OnTrainEnd(state *State) {
+	if earlyStopping.bestNetwork == nil {
+		return
+	}
+	if earlyStopping.BestNetworkPath != "" {
+		if err := codec.EncodeModel(earlyStopping.bestNetwork, earlyStopping.BestNetworkPath); err != nil {
+			state.Err = err
+		}
+	}
+	if earlyStopping.RestoreBestWeights {
+		state.Network = earlyStopping.bestNetwork
+	}
+}
+
+// Checkpoint saves a checkpoint every Manager.Every steps (when training by steps), epochs or generations, and when a callback stops training,
+// which can happen in the middle of an epoch.
+// If EarlyStopping is set, its progress is saved too so a resumed run stops at the same point, and so is the progress of Schedule.
+// Callbacks that stop training must come before it.
+type Checkpoint struct {
+	Manager       *checkpoint.Manager
+	EarlyStopping *EarlyStopping
+	Schedule      Resumable //a learning rate schedule that is also a callback, e.g. schedule.ReduceOnPlateau
+}
+
+func (callback *Checkpoint) save(state *State, counter int) {
+	var err error
+	currCheckpoint := &checkpoint.Checkpoint{}
+	if currCheckpoint.Network, err = json.Marshal(state.Network); err != nil {
+		state.Err = err
+		return
+	}
+	if state.Optimizer != nil {
+		currCheckpoint.Optimizer = state.Optimizer.ToJSONOptimizer()
+	}
+	for _, network := range state.Pool {
+		jsonNetwork, err := network.ToJSONNetwork()
+		if err != nil {
+			state.Err = err
+			return
+		}
+		currCheckpoint.Pool = append(currCheckpoint.Pool, jsonNetwork)
+	}
+	currCheckpoint.Step = state.Step
+	currCheckpoint.Epoch = state.Epoch
+	if state.Batch > 0 {
+		currCheckpoint.Batch = state.Batch
+		currCheckpoint.EpochCost = state.EpochCost
+		currCheckpoint.EpochRandomState = state.EpochRandomState
+	}
+	if state.Generation > 0 {
+		currCheckpoint.Step = state.Generation
+	}
+	currCheckpoint.RandomState = random.State()
+	currCheckpoint.CostHistory = state.Costs
+	currCheckpoint.Cost = state.Cost
+	if callback.EarlyStopping != nil {
+		//ranked by validation loss alone, so training costs saved before the first evaluation don't compete with it
+		currCheckpoint.Cost = checkpoint.Unranked
+	}
+	if callback.EarlyStopping != nil && callback.EarlyStopping.bestNetwork != nil {
+		currCheckpoint.Cost = callback.EarlyStopping.lastLoss
+		if currCheckpoint.BestNetwork, err = json.Marshal(callback.EarlyStopping.bestNetwork); err != nil {
+			state.Err = err
+			return
+		}
+		currCheckpoint.BestValidationLoss = callback.EarlyStopping.bestLoss
+		currCheckpoint.NumWithoutImprovement = callback.EarlyStopping.numWithoutImprovement
+	}
+	if callback.Schedule != nil {
+		if currCheckpoint.ScheduleState, err = callback.Schedule.SaveState(); err != nil {
+			state.Err = err
+			return
+		}
+	}
+	if err := callback.Manager.Save(currCheckpoint, counter); err != nil {
+		state.Err = err
+	}
+}
+
+func (callback *Checkpoint) OnStepEnd(state *State) {
+	if state.NumEpochs == 0 && (state.Step%callback.Manager.Every == 0 || state.Stop) {
+		callback.save(state, state.Step)
+	} else if state.NumEpochs > 0 && state.Stop {
+		callback.save(state, state.Epoch+1) //replaced by the epoch's own checkpoint if this was its last batch
+	}
+}
+
+func (callback *Checkpoint) OnEpochEnd(state *State) {
+	if state.Epoch%callback.Manager.Every == 0 || state.Stop {
+		callback.save(state, state.Epoch)
+	}
+}
+
+func (callback *Checkpoint) OnGenerationEnd(state *State) {
+	if state.Generation%callback.Manager.Every == 0 || state.Stop {
+		callback.save(state, state.Generation)
+	}
+}
+
+func (callback *Checkpoint) OnTrainEnd(state *State) {}
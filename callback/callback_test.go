@@ -0,0 +1,148 @@
+package callback
+
+import (
+	"bytes"
+	"fmt"
+	"nn/activationfunction"
+	"nn/checkpoint"
+	"nn/codec"
+	"nn/feedforward"
+	"nn/layer"
+	"nn/metrics"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestNetwork() *feedforward.Network {
+	network := feedforward.NewNetwork([]int{2, 3, 2}, []activationfunction.LayerActivationFunction{activationfunction.Tanh, activationfunction.Softmax})
+	network.Randomize(-1, 1, -1, 1)
+	return network
+}
+
+func TestCheckpointRanksByValidationLoss(t *testing.T) {
+	dir := t.TempDir()
+	earlyStopping := NewEarlyStopping(0, 0, false, "")
+	callbacks := []Callback{earlyStopping, &Checkpoint{Manager: &checkpoint.Manager{Dir: dir, Every: 1}, EarlyStopping: earlyStopping}}
+	state := &State{Network: newTestNetwork()}
+	for i, validation := range []*metrics.Report{nil, {Loss: 0.4}, nil} {
+		state.Step++
+		state.Cost = 0.1 * float64(i)
+		state.Validation = validation
+		for _, currCallback := range callbacks {
+			currCallback.OnStepEnd(state)
+		}
+		if state.Err != nil {
+			t.Fatal(state.Err)
+		}
+	}
+	for i, want := range []float64{checkpoint.Unranked, 0.4, 0.4} {
+		saved, err := checkpoint.Load(filepath.Join(dir, fmt.Sprintf("checkpoint-%d.json", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Cost != want {
+			t.Errorf("checkpoint %d: cost %v, want %v", i+1, saved.Cost, want)
+		}
+	}
+}
+
+func TestCSVLogger(t *testing.T) {
+	tests := map[string]struct {
+		numEpochs int
+		want      string
+	}{
+		"steps":  {0, "step,epoch,generation,cost,validationLoss,validationAccuracy\n1,0,0,0.5,,\n2,0,0,0.25,0.4,0.75\n2,1,0,0.25,0.4,0.75\n"},
+		"epochs": {3, "step,epoch,generation,cost,validationLoss,validationAccuracy\n2,1,0,0.25,0.4,0.75\n"},
+	}
+	for name, test := range tests {
+		buffer := &bytes.Buffer{}
+		logger := &CSVLogger{Writer: buffer}
+		state := &State{NumEpochs: test.numEpochs, Step: 1, Cost: 0.5}
+		logger.OnStepEnd(state)
+		state.Step, state.Cost, state.Validation = 2, 0.25, &metrics.Report{Loss: 0.4, Accuracy: 0.75}
+		logger.OnStepEnd(state)
+		state.Epoch = 1
+		logger.OnEpochEnd(state)
+		if buffer.String() != test.want {
+			t.Errorf("%s: wrote %q, want %q", name, buffer.String(), test.want)
+		}
+	}
+}
+
+func TestEarlyStopping(t *testing.T) {
+	bestNetworkPath := filepath.Join(t.TempDir(), "best.json")
+	earlyStopping := NewEarlyStopping(2, 0.05, true, bestNetworkPath)
+	networks := []*feedforward.Network{newTestNetwork(), newTestNetwork(), newTestNetwork(), newTestNetwork()}
+	state := &State{}
+	//only the second loss improves on the best by more than MinDelta
+	for i, validationLoss := range []float64{1, 0.9, 0.88, 0.87} {
+		state.Network = networks[i]
+		state.Validation = &metrics.Report{Loss: validationLoss}
+		earlyStopping.OnEpochEnd(state)
+		if state.Err != nil {
+			t.Fatal(state.Err)
+		}
+		if state.Stop != (i == 3) {
+			t.Errorf("loss %v: stop is %v", validationLoss, state.Stop)
+		}
+	}
+	earlyStopping.OnTrainEnd(state)
+	if state.Err != nil {
+		t.Fatal(state.Err)
+	}
+	if state.Network == networks[1] || !reflect.DeepEqual(state.Network.Parameters(), networks[1].Parameters()) {
+		t.Error("training didn't end with a copy of the best network")
+	}
+	saved, err := codec.DecodeModel(bestNetworkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Parameters(), networks[1].Parameters()) {
+		t.Error("the saved best network isn't the best one")
+	}
+}
+
+func TestEarlyStoppingCloneError(t *testing.T) {
+	earlyStopping := NewEarlyStopping(0, 0, false, "")
+	state := &State{Network: layer.NewSequential(layer.NewDense(2, 2, activationfunction.NewLeakyReLU(0.2))), Validation: &metrics.Report{Loss: 1}}
+	earlyStopping.OnStepEnd(state)
+	if state.Err == nil {
+		t.Error("keeping a network that can't be cloned didn't fail")
+	}
+}
+
+func TestCheckpointOnStop(t *testing.T) {
+	tests := map[string]struct {
+		state *State
+		want  string
+	}{
+		//stopped partway through the third epoch, saved as the epoch it will finish
+		"epochs": {&State{NumEpochs: 5, Step: 7, Epoch: 2, Batch: 1, EpochCost: 0.3, Costs: []float64{0.5, 0.4}}, "checkpoint-3.json"},
+		"steps":  {&State{Step: 7, Costs: []float64{0.5, 0.4, 0.3, 0.3, 0.2, 0.2, 0.1}}, "checkpoint-7.json"},
+	}
+	for name, test := range tests {
+		dir := t.TempDir()
+		checkpointCallback := &Checkpoint{Manager: &checkpoint.Manager{Dir: dir, Every: 10}}
+		test.state.Network = newTestNetwork()
+		checkpointCallback.OnStepEnd(test.state)
+		if test.state.Err != nil {
+			t.Fatalf("%s: %v", name, test.state.Err)
+		}
+		if latest, _ := checkpointCallback.Manager.Latest(); latest != "" {
+			t.Errorf("%s: saved %v before Every steps or epochs", name, latest)
+		}
+		test.state.Stop = true
+		checkpointCallback.OnStepEnd(test.state)
+		if test.state.Err != nil {
+			t.Fatalf("%s: %v", name, test.state.Err)
+		}
+		saved, err := checkpoint.Load(filepath.Join(dir, test.want))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if saved.Step != test.state.Step || saved.Epoch != test.state.Epoch || saved.Batch != test.state.Batch || saved.EpochCost != test.state.EpochCost || !reflect.DeepEqual(saved.CostHistory, test.state.Costs) {
+			t.Errorf("%s: saved %+v", name, saved)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"nn/feedforward"
+	"nn/optimizer"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Checkpoint is everything needed to continue a training run exactly where it stopped
+type Checkpoint struct {
+	Network     json.RawMessage //a feedforward.JSONNetwork, layer.JSONSequential or layer.JSONGraph, see layer.DecodeModel
+	Optimizer   *optimizer.JSONOptimizer
+	Step        int //number of steps completed
+	Epoch       int //number of epochs completed
+	RandomState uint64
+
+	Batch            int     `json:",omitempty"` //number of batches completed in an unfinished epoch, which a resumed run finishes first
+	EpochCost        float64 `json:",omitempty"` //sum of the costs of those batches
+	EpochRandomState uint64  `json:",omitempty"` //random state the unfinished epoch was shuffled with, so it is replayed in the same order
+
+	CostHistory []float64
+	Cost        float64 //the cost used to rank checkpoints, the last validation loss when there is a validation set or Unranked before the first evaluation
+
+	BestNetwork           json.RawMessage `json:",omitempty"` //best network on the validation set so far, encoded like Network
+	BestValidationLoss    float64
+	NumWithoutImprovement int
+
+	ScheduleState json.RawMessage `json:",omitempty"` //progress of a learning rate schedule that adapts to training, e.g. schedule.ReduceOnPlateau
+
+	Pool []*feedforward.JSONNetwork `json:",omitempty"` //genetic algorithm population, Network is then the best network so far
+}
+
+func Save(checkpoint *Checkpoint, filename string) error {
+	encodedCheckpoint, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, encodedCheckpoint, 0664)
+}
+
+func Load(filename string) (*Checkpoint, error) {
+	checkpointBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(checkpointBytes, checkpoint); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+	return checkpoint, nil
+}
+
+// Unranked is the Cost of a checkpoint saved before what checkpoints are ranked by was first measured, which never counts as the best
+const Unranked = math.MaxFloat64
+
+type savedCheckpoint struct {
+	filename string
+	cost     float64
+}
+
+// Manager writes checkpoints into Dir and deletes old ones
+type Manager struct {
+	Dir      string
+	Every    int  //number of steps, epochs or generations between checkpoints, trainers treat 0 as 1
+	KeepLast int  //number of most recent checkpoints to keep, 0 keeps all of them
+	KeepBest bool //also keep the checkpoint with the lowest cost
+
+	saved   []savedCheckpoint //oldest first
+	scanned bool
+}
+
+// scan picks up checkpoints already in Dir, e.g. from the run being resumed
+func (manager *Manager) scan() error {
+	filenames, err := filepath.Glob(filepath.Join(manager.Dir, "checkpoint-*.json"))
+	if err != nil {
+		return err
+	}
+	counters := map[string]int{}
+	for _, filename := range filenames {
+		counter := 0
+		if _, err := fmt.Sscanf(filepath.Base(filename), "checkpoint-%d.json", &counter); err != nil {
+			continue
+		}
+		checkpoint, err := Load(filename)
+		if err != nil {
+			return err
+		}
+		counters[filename] = counter
+		manager.saved = append(manager.saved, savedCheckpoint{filename, checkpoint.Cost})
+	}
+	sort.Slice(manager.saved, func(i, j int) bool {
+		return counters[manager.saved[i].filename] < counters[manager.saved[j].filename]
+	})
+	manager.scanned = true
+	return nil
+}
+
+// Save writes checkpoint as Dir/checkpoint-<counter>.json and applies the retention policy
+func (manager *Manager) Save(checkpoint *Checkpoint, counter int) error {
+	if err := os.MkdirAll(manager.Dir, 0775); err != nil {
+		return err
+	}
+	if !manager.scanned {
+		if err := manager.scan(); err != nil {
+			return err
+		}
+	}
+	filename := filepath.Join(manager.Dir, fmt.Sprintf("checkpoint-%d.json", counter))
+	if err := Save(checkpoint, filename); err != nil {
+		return err
+	}
+	for i := 0; i < len(manager.saved); i++ {
+		if manager.saved[i].filename == filename {
+			manager.saved = append(manager.saved[:i], manager.saved[i+1:]...)
+			break
+		}
+	}
+	manager.saved = append(manager.saved, savedCheckpoint{filename, checkpoint.Cost})
+	return manager.prune()
+}
+
+func (manager *Manager) prune() error {
+	if manager.KeepLast <= 0 {
+		return nil
+	}
+	best := ""
+	bestCost := math.Inf(1)
+	for _, saved := range manager.saved {
+		if saved.cost < bestCost && saved.cost != Unranked {
+			best = saved.filename
+			bestCost = saved.cost
+		}
+	}
+	kept := []savedCheckpoint{}
+	for i, saved := range manager.saved {
+		if i >= len(manager.saved)-manager.KeepLast || (manager.KeepBest && saved.filename == best) {
+			kept = append(kept, saved)
+		} else if err := os.Remove(saved.filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	manager.saved = kept
+	return nil
+}
+
+// Latest returns the filename of the most recent checkpoint in Dir, or "" if there is none
+func (manager *Manager) Latest() (string, error) {
+	if !manager.scanned {
+		if err := manager.scan(); err != nil {
+			return "", err
+		}
+	}
+	if len(manager.saved) == 0 {
+		return "", nil
+	}
+	return manager.saved[len(manager.saved)-1].filename, nil
+}
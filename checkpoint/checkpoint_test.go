@@ -0,0 +1,120 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"nn/optimizer"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// remaining lists the base names of the checkpoints left in dir
+func remaining(t *testing.T, dir string) []string {
+	t.Helper()
+	filenames, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, filename := range filenames {
+		result = append(result, filepath.Base(filename))
+	}
+	return result
+}
+
+func TestSaveLoad(t *testing.T) {
+	original := &Checkpoint{
+		Network:          json.RawMessage(`{"LayerSizes":[1,1]}`),
+		Optimizer:        optimizer.NewAdam(0.01, 0.9, 0.999).ToJSONOptimizer(),
+		Step:             12,
+		Epoch:            2,
+		RandomState:      1 << 60,
+		Batch:            3,
+		EpochCost:        1.5,
+		EpochRandomState: 7,
+		CostHistory:      []float64{0.9, 0.7},
+		Cost:             0.8,
+		ScheduleState:    json.RawMessage(`{"Scale":0.5}`),
+	}
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := Save(original, filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, original) {
+		t.Errorf("loaded %+v, saved %+v", loaded, original)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loading a missing checkpoint didn't fail")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	costs := []float64{0.5, 0.2, 0.3, 0.4, 0.6}
+	tests := map[string]struct {
+		keepLast int
+		keepBest bool
+		want     []string
+	}{
+		"keep all":           {0, false, []string{"checkpoint-1.json", "checkpoint-2.json", "checkpoint-3.json", "checkpoint-4.json", "checkpoint-5.json"}},
+		"keep last":          {2, false, []string{"checkpoint-4.json", "checkpoint-5.json"}},
+		"keep last and best": {2, true, []string{"checkpoint-2.json", "checkpoint-4.json", "checkpoint-5.json"}},
+	}
+	for name, test := range tests {
+		dir := t.TempDir()
+		manager := &Manager{Dir: dir, KeepLast: test.keepLast, KeepBest: test.keepBest}
+		for i, cost := range costs {
+			if err := manager.Save(&Checkpoint{Cost: cost}, i+1); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if got := remaining(t, dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: kept %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestLatestPicksUpEarlierRuns(t *testing.T) {
+	dir := t.TempDir()
+	if latest, err := (&Manager{Dir: dir}).Latest(); err != nil || latest != "" {
+		t.Errorf("latest of an empty directory is %q, %v", latest, err)
+	}
+	earlier := &Manager{Dir: dir}
+	for _, counter := range []int{9, 10} {
+		if err := earlier.Save(&Checkpoint{Cost: 0.1}, counter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//a resumed run starts with a new manager, which must order the files by counter rather than by name and prune them with its own
+	resumed := &Manager{Dir: dir, KeepLast: 1}
+	latest, err := resumed.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "checkpoint-10.json"); latest != want {
+		t.Errorf("latest is %v, want %v", latest, want)
+	}
+	if err := resumed.Save(&Checkpoint{Cost: 0.1}, 11); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := remaining(t, dir), []string{"checkpoint-11.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
+
+func TestKeepBestSkipsUnranked(t *testing.T) {
+	dir := t.TempDir()
+	manager := &Manager{Dir: dir, KeepLast: 1, KeepBest: true}
+	for i, cost := range []float64{Unranked, 0.5, 0.2, 0.3, Unranked} {
+		if err := manager.Save(&Checkpoint{Cost: cost}, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := remaining(t, dir), []string{"checkpoint-3.json", "checkpoint-5.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
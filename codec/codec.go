@@ -3,14 +3,148 @@ package codec
 import (
 	"encoding/json"
 	"nn/feedforward"
+	"nn/layer"
+	"nn/model"
+	"nn/optimizer"
+	"nn/tabular"
 	"os"
 )
 
-func EncodeNetwork(network *feedforward.Network, filename string) {
-	file, _ := os.Create(filename)
+func EncodeNetwork(network *feedforward.Network, filename string) error {
+	jsonNetwork, err := network.ToJSONNetwork()
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
 	defer file.Close()
 
 	// "men" - Rojeel Sharma, 2023
-	encodedNetwork, _ := json.Marshal(network.ToJSONNetwork())
-	file.Write(encodedNetwork)
+	encodedNetwork, err := json.Marshal(jsonNetwork)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(encodedNetwork)
+	return err
+}
+
+func EncodeOptimizer(opt optimizer.Optimizer, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encodedOptimizer, err := json.Marshal(opt.ToJSONOptimizer())
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(encodedOptimizer)
+	return err
+}
+
+func DecodeOptimizer(filename string) (optimizer.Optimizer, error) {
+	optimizerBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	jsonOptimizer := &optimizer.JSONOptimizer{}
+	if err := json.Unmarshal(optimizerBytes, jsonOptimizer); err != nil {
+		return nil, err
+	}
+	return jsonOptimizer.ToOptimizer()
+}
+
+// EncodeModel writes any model, e.g. a layer.Sequential, in the format DecodeModel reads
+func EncodeModel(network model.Model, filename string) error {
+	encodedNetwork, err := json.Marshal(network)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, encodedNetwork, 0664)
+}
+
+// DecodeModel reads a feedforward network, a sequential model or a graph, see layer.DecodeModel
+func DecodeModel(filename string) (model.Model, error) {
+	networkBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return layer.DecodeModel(networkBytes)
+}
+
+// TabularModel is a model saved beside the preprocessor that turns raw records into its inputs
+type TabularModel struct {
+	Preprocessor *tabular.Preprocessor
+	Network      json.RawMessage //see layer.DecodeModel
+}
+
+func EncodeTabularModel(network model.Model, preprocessor *tabular.Preprocessor, filename string) error {
+	encodedNetwork, err := json.Marshal(network)
+	if err != nil {
+		return err
+	}
+	encodedModel, err := json.Marshal(&TabularModel{Preprocessor: preprocessor, Network: encodedNetwork})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, encodedModel, 0664)
+}
+
+// DecodeTabularModel reads a model written by EncodeTabularModel, or any model written by EncodeModel, whose preprocessor is then nil
+func DecodeTabularModel(filename string) (model.Model, *tabular.Preprocessor, error) {
+	modelBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	tabularModel := &TabularModel{}
+	if err := json.Unmarshal(modelBytes, tabularModel); err != nil {
+		return nil, nil, err
+	}
+	if tabularModel.Network == nil {
+		network, err := layer.DecodeModel(modelBytes)
+		return network, nil, err
+	}
+	network, err := layer.DecodeModel(tabularModel.Network)
+	if err != nil {
+		return nil, nil, err
+	}
+	return network, tabularModel.Preprocessor, nil
+}
+
+// EncodeLayer writes a single layer, e.g. a trained layer.Embedding to reuse in another model
+func EncodeLayer(currLayer layer.Layer, filename string) error {
+	jsonLayer, err := currLayer.Serialize()
+	if err != nil {
+		return err
+	}
+	encodedLayer, err := json.Marshal(jsonLayer)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, encodedLayer, 0664)
+}
+
+func DecodeLayer(filename string) (layer.Layer, error) {
+	layerBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	jsonLayer := &layer.JSONLayer{}
+	if err := json.Unmarshal(layerBytes, jsonLayer); err != nil {
+		return nil, err
+	}
+	return jsonLayer.ToLayer()
+}
+
+// DecodeWordVectors reads a plain-text word vector file, see layer.ReadWordVectors
+func DecodeWordVectors(filename string) (*layer.Embedding, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return layer.ReadWordVectors(file)
 }
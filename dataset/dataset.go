@@ -0,0 +1,264 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"nn/random"
+	"os"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Dataset is a finite, indexable list of (input, ground truth) samples
+type Dataset interface {
+	Len() int
+	Get(i int) (*mat.VecDense, *mat.VecDense)
+}
+
+type Sample struct {
+	Input       *mat.VecDense
+	GroundTruth *mat.VecDense
+	Err         error //set on the last sample sent if reading the dataset failed, Input and GroundTruth are then nil
+}
+
+// Streamer is implemented by datasets that are cheaper to read in order than by index.
+// Stream stops sending and closes the channel once ctx is done, so a consumer can stop early by cancelling it.
+type Streamer interface {
+	Stream(ctx context.Context) <-chan Sample
+}
+
+// Stream sends every sample of dataset in order until ctx is done, using its own Stream if it has one
+func Stream(ctx context.Context, dataset Dataset) <-chan Sample {
+	if streamer, ok := dataset.(Streamer); ok {
+		return streamer.Stream(ctx)
+	}
+	samples := make(chan Sample)
+	go func() {
+		defer close(samples)
+		for i := 0; i < dataset.Len(); i++ {
+			input, groundTruth := dataset.Get(i)
+			select {
+			case samples <- Sample{Input: input, GroundTruth: groundTruth}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return samples
+}
+
+type generator struct {
+	genInput func() (*mat.VecDense, *mat.VecDense)
+	size     int
+}
+
+func (generator *generator) Len() int {
+	return generator.size
+}
+
+func (generator *generator) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	return generator.genInput()
+}
+
+// FromGenerator treats genInput as a dataset of size samples. Every Get draws a new sample, so the index is ignored.
+func FromGenerator(genInput func() (*mat.VecDense, *mat.VecDense), size int) Dataset {
+	return &generator{genInput, size}
+}
+
+type inMemory struct {
+	inputs       []*mat.VecDense
+	groundTruths []*mat.VecDense
+}
+
+func (inMemory *inMemory) Len() int {
+	return len(inMemory.inputs)
+}
+
+func (inMemory *inMemory) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	return inMemory.inputs[i], inMemory.groundTruths[i]
+}
+
+func FromSlices(inputs, groundTruths []*mat.VecDense) Dataset {
+	if len(inputs) != len(groundTruths) {
+		panic(fmt.Sprintf("%v inputs but %v ground truths", len(inputs), len(groundTruths)))
+	}
+	return &inMemory{inputs, groundTruths}
+}
+
+// File reads fixed-size records from disk only when they are asked for
+type File struct {
+	file       *os.File
+	headerSize int
+	recordSize int
+	numRecords int
+	decode     func(record []byte) (*mat.VecDense, *mat.VecDense)
+}
+
+// FromFile opens a file made of a headerSize byte header followed by records of recordSize bytes each
+func FromFile(filename string, headerSize, recordSize int, decode func(record []byte) (*mat.VecDense, *mat.VecDense)) (*File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	dataSize := int(fileInfo.Size()) - headerSize
+	if dataSize < 0 || dataSize%recordSize != 0 {
+		file.Close()
+		return nil, fmt.Errorf("%v: %v bytes after the header is not a multiple of the record size %v", filename, dataSize, recordSize)
+	}
+	return &File{file, headerSize, recordSize, dataSize / recordSize, decode}, nil
+}
+
+func (file *File) Len() int {
+	return file.numRecords
+}
+
+func (file *File) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	record := make([]byte, file.recordSize)
+	if _, err := file.file.ReadAt(record, int64(file.headerSize+i*file.recordSize)); err != nil {
+		panic(err)
+	}
+	return file.decode(record)
+}
+
+func (file *File) Stream(ctx context.Context) <-chan Sample {
+	samples := make(chan Sample)
+	go func() {
+		defer close(samples)
+		chunkRecords := 1024
+		chunk := make([]byte, chunkRecords*file.recordSize)
+		for i := 0; i < file.numRecords; i += chunkRecords {
+			numRecords := chunkRecords
+			if i+numRecords > file.numRecords {
+				numRecords = file.numRecords - i
+			}
+			if _, err := file.file.ReadAt(chunk[:numRecords*file.recordSize], int64(file.headerSize+i*file.recordSize)); err != nil {
+				select {
+				case samples <- Sample{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for j := 0; j < numRecords; j++ {
+				input, groundTruth := file.decode(chunk[j*file.recordSize : (j+1)*file.recordSize])
+				select {
+				case samples <- Sample{Input: input, GroundTruth: groundTruth}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return samples
+}
+
+func (file *File) Close() error {
+	return file.file.Close()
+}
+
+type subset struct {
+	dataset Dataset
+	indices []int
+}
+
+func (subset *subset) Len() int {
+	return len(subset.indices)
+}
+
+func (subset *subset) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	return subset.dataset.Get(subset.indices[i])
+}
+
+// Subset is a view of the samples of dataset at indices, in that order
+func Subset(dataset Dataset, indices []int) Dataset {
+	return &subset{dataset, indices}
+}
+
+// Shuffle is a view of dataset in a random order, fixed when Shuffle is called
+func Shuffle(dataset Dataset) Dataset {
+	return Subset(dataset, random.Permutation(dataset.Len()))
+}
+
+// Split divides dataset in order into its first fraction of samples and the rest
+func Split(dataset Dataset, fraction float64) (Dataset, Dataset) {
+	splitIndex := int(fraction * float64(dataset.Len()))
+	first := make([]int, splitIndex)
+	for i := 0; i < splitIndex; i++ {
+		first[i] = i
+	}
+	second := make([]int, dataset.Len()-splitIndex)
+	for i := splitIndex; i < dataset.Len(); i++ {
+		second[i-splitIndex] = i
+	}
+	return Subset(dataset, first), Subset(dataset, second)
+}
+
+type mapped struct {
+	dataset Dataset
+	f       func(input, groundTruth *mat.VecDense) (*mat.VecDense, *mat.VecDense)
+}
+
+func (mapped *mapped) Len() int {
+	return mapped.dataset.Len()
+}
+
+func (mapped *mapped) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	return mapped.f(mapped.dataset.Get(i))
+}
+
+// Map applies f to each sample as it is read
+func Map(dataset Dataset, f func(input, groundTruth *mat.VecDense) (*mat.VecDense, *mat.VecDense)) Dataset {
+	return &mapped{dataset, f}
+}
+
+// Batches groups consecutive samples of a dataset into matrices with one sample per row
+type Batches struct {
+	dataset       Dataset
+	batchSize     int
+	dropLastBatch bool
+}
+
+// Batch splits dataset into batches of batchSize samples. If its size isn't a multiple of batchSize,
+// the smaller last batch is left out when dropLastBatch is set.
+func Batch(dataset Dataset, batchSize int, dropLastBatch bool) *Batches {
+	return &Batches{dataset, batchSize, dropLastBatch}
+}
+
+func (batches *Batches) Len() int {
+	if batches.dropLastBatch {
+		return batches.dataset.Len() / batches.batchSize
+	}
+	return (batches.dataset.Len() + batches.batchSize - 1) / batches.batchSize
+}
+
+func (batches *Batches) Get(i int) (*mat.Dense, *mat.Dense) {
+	start := i * batches.batchSize
+	end := start + batches.batchSize
+	if end > batches.dataset.Len() {
+		end = batches.dataset.Len()
+	}
+	var inputs, groundTruths *mat.Dense
+	for j := start; j < end; j++ {
+		input, groundTruth := batches.dataset.Get(j)
+		if inputs == nil {
+			inputs = mat.NewDense(end-start, input.Len(), nil)
+			groundTruths = mat.NewDense(end-start, groundTruth.Len(), nil)
+		}
+		inputs.SetRow(j-start, mat.Col(nil, 0, input))
+		groundTruths.SetRow(j-start, mat.Col(nil, 0, groundTruth))
+	}
+	return inputs, groundTruths
+}
+
+// RandomBatch draws numSamples random samples of dataset, with replacement, as a single batch. dataset must not be empty.
+func RandomBatch(dataset Dataset, numSamples int) (*mat.Dense, *mat.Dense) {
+	indices := make([]int, numSamples)
+	for i := 0; i < numSamples; i++ {
+		indices[i] = random.RandomInt(0, dataset.Len()-1)
+	}
+	return Batch(Subset(dataset, indices), numSamples, false).Get(0)
+}
@@ -0,0 +1,169 @@
+package dataset
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// numbered has samples with input i and ground truth 2i
+func numbered(numSamples int) Dataset {
+	inputs, groundTruths := []*mat.VecDense{}, []*mat.VecDense{}
+	for i := 0; i < numSamples; i++ {
+		inputs = append(inputs, mat.NewVecDense(1, []float64{float64(i)}))
+		groundTruths = append(groundTruths, mat.NewVecDense(1, []float64{float64(2 * i)}))
+	}
+	return FromSlices(inputs, groundTruths)
+}
+
+// inputValues lists the inputs of every sample of dataset in order
+func inputValues(dataset Dataset) []float64 {
+	result := []float64{}
+	for i := 0; i < dataset.Len(); i++ {
+		input, _ := dataset.Get(i)
+		result = append(result, input.AtVec(0))
+	}
+	return result
+}
+
+func TestBatch(t *testing.T) {
+	data := numbered(5)
+	if batches := Batch(data, 2, true); batches.Len() != 2 {
+		t.Errorf("%v batches when dropping the last one, want 2", batches.Len())
+	}
+	batches := Batch(data, 2, false)
+	if batches.Len() != 3 {
+		t.Fatalf("%v batches, want 3", batches.Len())
+	}
+	inputs, groundTruths := batches.Get(1)
+	if !mat.Equal(inputs, mat.NewDense(2, 1, []float64{2, 3})) || !mat.Equal(groundTruths, mat.NewDense(2, 1, []float64{4, 6})) {
+		t.Errorf("batch 1 is %v and %v", mat.Formatted(inputs), mat.Formatted(groundTruths))
+	}
+	if inputs, _ := batches.Get(2); !mat.Equal(inputs, mat.NewDense(1, 1, []float64{4})) {
+		t.Errorf("last batch is %v", mat.Formatted(inputs))
+	}
+}
+
+func TestShuffleSplitAndMap(t *testing.T) {
+	data := numbered(10)
+	shuffled := inputValues(Shuffle(data))
+	sort.Float64s(shuffled)
+	if want := inputValues(data); !reflect.DeepEqual(shuffled, want) {
+		t.Errorf("shuffled samples %v aren't a permutation of %v", shuffled, want)
+	}
+
+	first, second := Split(data, 0.7)
+	if got := inputValues(first); !reflect.DeepEqual(got, []float64{0, 1, 2, 3, 4, 5, 6}) {
+		t.Errorf("first part of the split is %v", got)
+	}
+	if got := inputValues(second); !reflect.DeepEqual(got, []float64{7, 8, 9}) {
+		t.Errorf("second part of the split is %v", got)
+	}
+
+	doubled := Map(second, func(input, groundTruth *mat.VecDense) (*mat.VecDense, *mat.VecDense) {
+		result := mat.NewVecDense(1, nil)
+		result.ScaleVec(2, input)
+		return result, groundTruth
+	})
+	if got := inputValues(doubled); !reflect.DeepEqual(got, []float64{14, 16, 18}) {
+		t.Errorf("mapped inputs are %v", got)
+	}
+}
+
+func TestRandomBatch(t *testing.T) {
+	inputs, groundTruths := RandomBatch(numbered(4), 20)
+	for i := 0; i < 20; i++ {
+		if input := inputs.At(i, 0); input < 0 || input > 3 || groundTruths.At(i, 0) != 2*input {
+			t.Errorf("row %d is (%v, %v), not a sample of the dataset", i, input, groundTruths.At(i, 0))
+		}
+	}
+}
+
+// writeRecords writes a file with a 3 byte header and 2 byte records holding an input and its ground truth
+func writeRecords(t *testing.T, numRecords int) *File {
+	t.Helper()
+	contents := []byte{'h', 'd', 'r'}
+	for i := 0; i < numRecords; i++ {
+		contents = append(contents, byte(i), byte(2*i))
+	}
+	filename := filepath.Join(t.TempDir(), "records")
+	if err := os.WriteFile(filename, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := FromFile(filename, 3, 2, func(record []byte) (*mat.VecDense, *mat.VecDense) {
+		return mat.NewVecDense(1, []float64{float64(record[0])}), mat.NewVecDense(1, []float64{float64(record[1])})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestFromFile(t *testing.T) {
+	file := writeRecords(t, 1500)
+	defer file.Close()
+	if file.Len() != 1500 {
+		t.Fatalf("%v records, want 1500", file.Len())
+	}
+	i := 0
+	for sample := range Stream(context.Background(), file) {
+		if sample.Err != nil {
+			t.Fatal(sample.Err)
+		}
+		if input, groundTruth := file.Get(i); !mat.Equal(sample.Input, input) || !mat.Equal(sample.GroundTruth, groundTruth) {
+			t.Fatalf("streamed sample %d is (%v, %v), Get gives (%v, %v)", i, sample.Input.AtVec(0), sample.GroundTruth.AtVec(0), input.AtVec(0), groundTruth.AtVec(0))
+		}
+		i++
+	}
+	if i != 1500 {
+		t.Errorf("streamed %v samples, want 1500", i)
+	}
+
+	filename := filepath.Join(t.TempDir(), "truncated")
+	if err := os.WriteFile(filename, []byte{'h', 'd', 'r', 1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(filename, 3, 2, nil); err == nil {
+		t.Error("opening a file that ends partway through a record didn't fail")
+	}
+}
+
+func TestStreamStops(t *testing.T) {
+	file := writeRecords(t, 10)
+	defer file.Close()
+	for name, data := range map[string]Dataset{"file": file, "in memory": numbered(10)} {
+		ctx, cancel := context.WithCancel(context.Background())
+		samples := Stream(ctx, data)
+		<-samples
+		cancel()
+		//give the sender time to see the cancellation while nothing is receiving, so it can't pick sending instead
+		time.Sleep(10 * time.Millisecond)
+		numReceived := 0
+		for range samples {
+			numReceived++
+		}
+		if numReceived > 0 {
+			t.Errorf("%s: received %v samples after cancelling", name, numReceived)
+		}
+	}
+}
+
+func TestStreamReadError(t *testing.T) {
+	file := writeRecords(t, 10)
+	file.Close()
+	numSamples := 0
+	var err error
+	for sample := range Stream(context.Background(), file) {
+		numSamples++
+		err = sample.Err
+	}
+	if numSamples != 1 || err == nil {
+		t.Errorf("streaming a closed file sent %v samples and the error %v, want only an error", numSamples, err)
+	}
+}
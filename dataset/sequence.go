@@ -0,0 +1,163 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"nn/random"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Sequences holds samples made of steps. Get flattens a sample's steps one after another,
+// which is the layout layer.Recurrent reads, so a batch of sequences is still one row per sample.
+// Ground truths have either one step per input step or a single step for the whole sequence.
+type Sequences struct {
+	inputs       [][]*mat.VecDense
+	groundTruths [][]*mat.VecDense
+}
+
+// FromSequences checks that every sample has the same number of steps and step sizes
+func FromSequences(inputs, groundTruths [][]*mat.VecDense) (*Sequences, error) {
+	if len(inputs) != len(groundTruths) {
+		return nil, fmt.Errorf("%v input sequences but %v ground truth sequences", len(inputs), len(groundTruths))
+	}
+	for i := range inputs {
+		if len(inputs[i]) == 0 || len(groundTruths[i]) == 0 {
+			return nil, fmt.Errorf("sequence %v is empty", i)
+		}
+		if len(groundTruths[i]) != 1 && len(groundTruths[i]) != len(inputs[i]) {
+			return nil, fmt.Errorf("sequence %v has %v steps but %v ground truth steps", i, len(inputs[i]), len(groundTruths[i]))
+		}
+		if len(inputs[i]) != len(inputs[0]) || len(groundTruths[i]) != len(groundTruths[0]) {
+			return nil, fmt.Errorf("sequence %v has a different length from sequence 0", i)
+		}
+		for _, steps := range [][]*mat.VecDense{inputs[i], groundTruths[i]} {
+			for _, step := range steps {
+				if step.Len() != steps[0].Len() {
+					return nil, fmt.Errorf("sequence %v has steps of different sizes", i)
+				}
+			}
+		}
+		if inputs[i][0].Len() != inputs[0][0].Len() || groundTruths[i][0].Len() != groundTruths[0][0].Len() {
+			return nil, fmt.Errorf("sequence %v has different step sizes from sequence 0", i)
+		}
+	}
+	return &Sequences{inputs, groundTruths}, nil
+}
+
+func (sequences *Sequences) Len() int {
+	return len(sequences.inputs)
+}
+
+func flatten(steps []*mat.VecDense) *mat.VecDense {
+	result := mat.NewVecDense(len(steps)*steps[0].Len(), nil)
+	for t, step := range steps {
+		result.SliceVec(t*step.Len(), (t+1)*step.Len()).(*mat.VecDense).CopyVec(step)
+	}
+	return result
+}
+
+func (sequences *Sequences) Get(i int) (*mat.VecDense, *mat.VecDense) {
+	return flatten(sequences.inputs[i]), flatten(sequences.groundTruths[i])
+}
+
+// Steps returns the unflattened steps of sample i
+func (sequences *Sequences) Steps(i int) ([]*mat.VecDense, []*mat.VecDense) {
+	return sequences.inputs[i], sequences.groundTruths[i]
+}
+
+// SequenceLength is the number of input steps in each sample
+func (sequences *Sequences) SequenceLength() int {
+	if len(sequences.inputs) == 0 {
+		return 0
+	}
+	return len(sequences.inputs[0])
+}
+
+// SineWave makes size sequences of sequenceLength samples of sin, stepSize apart and starting at random phases.
+// The ground truth is the value after each step, or only the value after the last step if lastStepOnly is set.
+func SineWave(size, sequenceLength int, stepSize float64, lastStepOnly bool) *Sequences {
+	inputs := make([][]*mat.VecDense, size)
+	groundTruths := make([][]*mat.VecDense, size)
+	for i := 0; i < size; i++ {
+		phase := random.RandomFloat64(0, 2*math.Pi)
+		inputs[i] = make([]*mat.VecDense, sequenceLength)
+		for t := range inputs[i] {
+			inputs[i][t] = mat.NewVecDense(1, []float64{math.Sin(phase + float64(t)*stepSize)})
+		}
+		if lastStepOnly {
+			groundTruths[i] = []*mat.VecDense{mat.NewVecDense(1, []float64{math.Sin(phase + float64(sequenceLength)*stepSize)})}
+		} else {
+			groundTruths[i] = append(inputs[i][1:], mat.NewVecDense(1, []float64{math.Sin(phase + float64(sequenceLength)*stepSize)}))
+		}
+	}
+	return &Sequences{inputs, groundTruths}
+}
+
+// Vocabulary maps the characters of a text to one-hot vectors
+type Vocabulary struct {
+	Characters []rune
+	indices    map[rune]int
+}
+
+// NewVocabulary collects the distinct characters of text in sorted order
+func NewVocabulary(text string) *Vocabulary {
+	vocabulary := &Vocabulary{indices: map[rune]int{}}
+	for _, character := range text {
+		if _, ok := vocabulary.indices[character]; !ok {
+			vocabulary.indices[character] = 0
+			vocabulary.Characters = append(vocabulary.Characters, character)
+		}
+	}
+	sort.Slice(vocabulary.Characters, func(i, j int) bool { return vocabulary.Characters[i] < vocabulary.Characters[j] })
+	for i, character := range vocabulary.Characters {
+		vocabulary.indices[character] = i
+	}
+	return vocabulary
+}
+
+func (vocabulary *Vocabulary) Size() int {
+	return len(vocabulary.Characters)
+}
+
+// Index returns the position of character in the vocabulary, or -1 if it isn't in it
+func (vocabulary *Vocabulary) Index(character rune) int {
+	index, ok := vocabulary.indices[character]
+	if !ok {
+		return -1
+	}
+	return index
+}
+
+// OneHot panics if character isn't in the vocabulary
+func (vocabulary *Vocabulary) OneHot(character rune) *mat.VecDense {
+	index := vocabulary.Index(character)
+	if index == -1 {
+		panic(fmt.Sprintf("%q is not in the vocabulary", character))
+	}
+	result := mat.NewVecDense(vocabulary.Size(), nil)
+	result.SetVec(index, 1)
+	return result
+}
+
+// FromText makes a sample from every sequenceLength characters of text, starting at each character in turn.
+// Characters are one-hot and the ground truth of each step is the next character, for training a character-level model.
+func FromText(text string, sequenceLength int) (*Sequences, *Vocabulary) {
+	vocabulary := NewVocabulary(text)
+	oneHots := make(map[rune]*mat.VecDense, vocabulary.Size())
+	for _, character := range vocabulary.Characters {
+		oneHots[character] = vocabulary.OneHot(character)
+	}
+	characters := []rune(text)
+	steps := make([]*mat.VecDense, len(characters))
+	for i, character := range characters {
+		steps[i] = oneHots[character]
+	}
+	sequences := &Sequences{}
+	for i := 0; i+sequenceLength < len(steps); i++ {
+		sequences.inputs = append(sequences.inputs, steps[i:i+sequenceLength])
+		sequences.groundTruths = append(sequences.groundTruths, steps[i+1:i+sequenceLength+1])
+	}
+	return sequences, vocabulary
+}
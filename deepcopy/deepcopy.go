@@ -41,3 +41,15 @@ func PrimitiveSlice2D[T any](slice [][]T) [][]T {
 	}
 	return result
 }
+
+func Matrix(matrix *mat.Dense) *mat.Dense {
+	return mat.DenseCopyOf(matrix)
+}
+
+func MatrixSlice1D(slice []*mat.Dense) []*mat.Dense {
+	result := make([]*mat.Dense, len(slice))
+	for i := 0; i < len(slice); i++ {
+		result[i] = Matrix(slice[i])
+	}
+	return result
+}
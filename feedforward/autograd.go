@@ -0,0 +1,119 @@
+package feedforward
+
+import (
+	"math"
+	"nn/autograd"
+	"nn/loss"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// rowTensor is a 1 x n variable aliasing vec, so its gradient has vec's layout
+func rowTensor(tape *autograd.Tape, vec *mat.VecDense) *autograd.Tensor {
+	return tape.Variable(mat.NewDense(1, vec.Len(), vec.RawVector().Data))
+}
+
+// record normalizes x on tape with gamma and beta as in Forward, updating batch norm's running statistics when training
+func (normalization *Normalization) record(x, gamma, beta *autograd.Tensor, training bool) *autograd.Tensor {
+	tape := x.Tape()
+	var normalized *autograd.Tensor
+	switch {
+	case normalization.Kind == BatchNorm && !training:
+		invStds := mat.NewDense(1, normalization.RunningVariance.Len(), nil)
+		invStds.Apply(func(_, j int, _ float64) float64 {
+			return 1 / math.Sqrt(normalization.RunningVariance.AtVec(j)+normalization.Epsilon)
+		}, invStds)
+		runningMean := mat.NewDense(1, normalization.RunningMean.Len(), mat.Col(nil, 0, normalization.RunningMean))
+		normalized = autograd.Mul(autograd.Sub(x, tape.Constant(runningMean)), tape.Constant(invStds))
+	case normalization.Kind == BatchNorm:
+		normalization.normalize(mat.DenseCopyOf(x.Value), true)
+		centered := autograd.Sub(x, autograd.MeanRows(x))
+		variance := autograd.MeanRows(autograd.Mul(centered, centered))
+		normalized = autograd.Mul(centered, autograd.Pow(autograd.Shift(variance, normalization.Epsilon), -0.5))
+	default:
+		centered := autograd.Sub(x, autograd.MeanCols(x))
+		variance := autograd.MeanCols(autograd.Mul(centered, centered))
+		normalized = autograd.Mul(centered, autograd.Pow(autograd.Shift(variance, normalization.Epsilon), -0.5))
+	}
+	return autograd.Add(autograd.Mul(normalized, gamma), beta)
+}
+
+// Record runs inputs through the network like RunBatch, recording the operations on tape.
+// It returns the outputs and variables aliasing the network's parameters in the order of Parameters.
+// When called by LearnBatch, dropout masks are drawn and batch norm's running statistics updated just as in RunBatch.
+func (network *Network) Record(tape *autograd.Tape, inputs *mat.Dense) (*autograd.Tensor, []*autograd.Tensor) {
+	weights := make([]*autograd.Tensor, network.NumLayers-1)
+	biases := make([]*autograd.Tensor, network.NumLayers-1)
+	for i := range weights {
+		weights[i] = tape.Variable(network.Weights[i])
+		biases[i] = rowTensor(tape, network.Biases[i])
+	}
+	normalizationParams := []*autograd.Tensor{}
+
+	network.dropoutMasks = nil
+	if network.training {
+		network.dropoutMasks = make([]*mat.Dense, network.NumLayers-1)
+	}
+	layer := tape.Constant(inputs)
+	for i := 1; i < network.NumLayers; i++ {
+		if network.training && i-1 < len(network.DropoutRates) && network.DropoutRates[i-1] > 0 {
+			network.dropout(i-1, layer.Value)
+			layer = autograd.Mul(layer, tape.Constant(network.dropoutMasks[i-1]))
+		}
+		layer = autograd.Add(autograd.MatMul(layer, autograd.Transpose(weights[i-1])), biases[i-1])
+		if normalization := network.normalization(i - 1); normalization != nil {
+			gamma, beta := rowTensor(tape, normalization.Gamma), rowTensor(tape, normalization.Beta)
+			normalizationParams = append(normalizationParams, gamma, beta)
+			layer = normalization.record(layer, gamma, beta, network.training)
+		}
+		layer = autograd.Activate(layer, network.ActivationFunctions[i-1])
+	}
+
+	params := []*autograd.Tensor{}
+	for i := range weights {
+		params = append(params, weights[i], biases[i])
+	}
+	return layer, append(params, normalizationParams...)
+}
+
+// recordPenalty is Penalty on tape, given the variables of the weights
+func (network *Network) recordPenalty(tape *autograd.Tape, weights []*autograd.Tensor) *autograd.Tensor {
+	penalty := tape.Scalar(0)
+	for i, regularization := range network.Regularization {
+		if regularization.L1 != 0 {
+			penalty = autograd.Add(penalty, autograd.Scale(autograd.Sum(autograd.Abs(weights[i])), regularization.L1))
+		}
+		if regularization.L2 != 0 {
+			penalty = autograd.Add(penalty, autograd.Scale(autograd.Sum(autograd.Mul(weights[i], weights[i])), regularization.L2))
+		}
+	}
+	return penalty
+}
+
+// AutogradGradients computes what DerivativeBatch does with package autograd instead of hand-written derivatives:
+// the gradients of the batch's average cost plus the L1 and L2 penalties, in the layout of Parameters.
+// It also returns that cost and the outputs.
+func (network *Network) AutogradGradients(inputs, groundTruth *mat.Dense, lossFunction loss.Loss) (float64, *mat.Dense, [][]float64) {
+	numSamples, _ := inputs.Dims()
+	tape := autograd.NewTape()
+	output, params := network.Record(tape, inputs)
+	outputGrad := lossFunction.Gradient(output.Value, groundTruth)
+	outputGrad.Scale(1/float64(numSamples), outputGrad)
+	output.BackwardWith(outputGrad)
+
+	weights := make([]*autograd.Tensor, network.NumLayers-1)
+	for i := range weights {
+		weights[i] = params[2*i]
+	}
+	network.recordPenalty(tape, weights).Backward()
+
+	grads := make([][]float64, len(params))
+	for i, param := range params {
+		numRows, numCols := param.Dims()
+		grads[i] = make([]float64, numRows*numCols)
+		if param.Grad != nil {
+			copy(grads[i], param.Grad.RawMatrix().Data)
+		}
+	}
+	return lossFunction.Eval(output.Value, groundTruth) + network.Penalty(), output.Value, grads
+}
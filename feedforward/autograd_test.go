@@ -0,0 +1,53 @@
+package feedforward
+
+import (
+	"math"
+	"nn/activationfunction"
+	"nn/loss"
+	"nn/random"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestAutogradGradients(t *testing.T) {
+	network := NewNetwork([]int{3, 6, 5, 2}, []activationfunction.LayerActivationFunction{activationfunction.Tanh, activationfunction.Sigmoid, activationfunction.Softmax})
+	network.Randomize(-1, 1, -1, 1)
+	network.Normalizations = []*Normalization{NewBatchNorm(6, 0.1), NewLayerNorm(5)}
+	network.Normalizations[0].Gamma.SetVec(1, 1.7)
+	network.Normalizations[1].Beta.SetVec(2, 0.3)
+	network.Regularization = []Regularization{{L1: 0.1, L2: 0.05}, {}, {L2: 0.2}}
+	network.DropoutRates = []float64{0, 0.3, 0.2}
+	inputs := mat.NewDense(4, 3, []float64{0.1, 0.2, -0.3, 0.5, -0.1, 0.7, 0.9, 0.3, -0.2, -0.5, 0.4, 0.1})
+	groundTruth := mat.NewDense(4, 2, []float64{1, 0, 0, 1, 1, 0, 0, 1})
+
+	for _, lossFunction := range []loss.Loss{loss.CategoricalCrossEntropy, loss.SquaredError} {
+		network.training = true
+		random.Seed(5)
+		output, states, statesBeforeActivationFunctions := network.RunBatch(inputs, true, true)
+		weightDerivatives, biasDerivatives := network.DerivativeBatch(states, statesBeforeActivationFunctions, groundTruth, lossFunction)
+		want := append(Flatten(weightDerivatives, biasDerivatives), network.normalizationGradients()...)
+		wantCost := lossFunction.Eval(output, groundTruth) + network.Penalty()
+
+		random.Seed(5)
+		cost, autogradOutput, grads := network.AutogradGradients(inputs, groundTruth, lossFunction)
+		network.training = false
+
+		if !mat.EqualApprox(autogradOutput, output, 1e-12) {
+			t.Fatalf("%s: autograd output %v, RunBatch output %v", lossFunction.Name(), mat.Formatted(autogradOutput), mat.Formatted(output))
+		}
+		if math.Abs(cost-wantCost) > 1e-12 {
+			t.Errorf("%s: autograd cost %g, want %g", lossFunction.Name(), cost, wantCost)
+		}
+		if len(grads) != len(want) {
+			t.Fatalf("%s: autograd gave %d gradients, want %d", lossFunction.Name(), len(grads), len(want))
+		}
+		for i := range want {
+			for j := range want[i] {
+				if math.Abs(grads[i][j]-want[i][j]) > 1e-9 {
+					t.Errorf("%s: gradient %d[%d] is %g, DerivativeBatch gives %g", lossFunction.Name(), i, j, grads[i][j], want[i][j])
+				}
+			}
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package feedforward
 
 import (
+	"encoding/json"
+	"fmt"
 	"nn/activationfunction"
 	"nn/deepcopy"
+	"nn/loss"
+	"nn/model"
+	"nn/optimizer"
 	"nn/random"
 
 	"gonum.org/v1/gonum/mat"
@@ -34,9 +39,17 @@ import (
 type Network struct {
 	NumLayers           int
 	LayerSizes          []int
-	Weights             [][]*mat.VecDense
-	Biases              [][]float64
-	ActivationFunctions []*activationfunction.ActivationFunction //per layer
+	Weights             []*mat.Dense                                 //Weights[i] is LayerSizes[i+1] x LayerSizes[i]
+	Biases              []*mat.VecDense                              //Biases[i] has length LayerSizes[i+1]
+	ActivationFunctions []activationfunction.LayerActivationFunction //per layer
+	Loss                loss.Loss                                    //the loss the network was trained with, may be nil
+	Regularization      []Regularization                             //per layer, nil for none, only used in training and not saved
+	Normalizations      []*Normalization                             //Normalizations[i] is applied after Weights[i] and Biases[i] and before ActivationFunctions[i], nil for none
+	DropoutRates        []float64                                    //DropoutRates[i] is the fraction of layer i's values zeroed on their way into Weights[i] in training, nil for none
+	Autograd            bool                                         //LearnBatch computes gradients with AutogradGradients instead of DerivativeBatch, not saved
+
+	training     bool         //set by LearnBatch for its forward pass, every other forward pass is inference
+	dropoutMasks []*mat.Dense //of the last forward pass in training, already scaled by 1/(1-rate)
 }
 
 type JSONNetwork struct {
@@ -44,54 +57,177 @@ type JSONNetwork struct {
 	LayerSizes          []int
 	Weights             [][][]float64
 	Biases              [][]float64
-	ActivationFunctions []int //per layer
+	ActivationFunctions []JSONActivationFunction //per layer
+	Loss                string
+	Normalizations      []*JSONNormalization `json:",omitempty"`
+	DropoutRates        []float64            `json:",omitempty"`
+}
+
+// JSONActivationFunction is the registered name of an activation function.
+// Networks saved before names were introduced store integer codes, which are converted when decoding.
+type JSONActivationFunction string
+
+func (name *JSONActivationFunction) UnmarshalJSON(data []byte) error {
+	legacyInt := 0
+	if err := json.Unmarshal(data, &legacyInt); err == nil {
+		legacyName, ok := activationfunction.LegacyIntToName[legacyInt]
+		if !ok {
+			return fmt.Errorf("unknown activation function code %v", legacyInt)
+		}
+		*name = JSONActivationFunction(legacyName)
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(name))
 }
 
-func (network *Network) ToJSONNetwork() *JSONNetwork { //NOT DEEPCOPY!
+// ToJSONNetwork fails if an activation function isn't registered, e.g. one made by activationfunction.NewLeakyReLU with a custom slope
+func (network *Network) ToJSONNetwork() (*JSONNetwork, error) {
 	jsonNetwork := &JSONNetwork{}
 	jsonNetwork.NumLayers = network.NumLayers
-	jsonNetwork.Biases = network.Biases
 	jsonNetwork.LayerSizes = network.LayerSizes
-	jsonNetwork.ActivationFunctions = []int{}
+	jsonNetwork.ActivationFunctions = []JSONActivationFunction{}
 	for i := 0; i < network.NumLayers-1; i++ {
-		jsonNetwork.ActivationFunctions = append(jsonNetwork.ActivationFunctions, activationfunction.ActivationFunctionToInt[network.ActivationFunctions[i]])
+		name, ok := activationfunction.Name(network.ActivationFunctions[i])
+		if !ok {
+			return nil, fmt.Errorf("activation function of layer %v is not registered", i+1)
+		}
+		jsonNetwork.ActivationFunctions = append(jsonNetwork.ActivationFunctions, JSONActivationFunction(name))
+	}
+	if network.Loss != nil {
+		jsonNetwork.Loss = network.Loss.Name()
+	}
+	jsonNetwork.DropoutRates = network.DropoutRates
+	if network.Normalizations != nil {
+		jsonNetwork.Normalizations = make([]*JSONNormalization, len(network.Normalizations))
+		for i, normalization := range network.Normalizations {
+			if normalization != nil {
+				jsonNetwork.Normalizations[i] = normalization.ToJSONNormalization()
+			}
+		}
 	}
 	jsonNetwork.Weights = make([][][]float64, network.NumLayers-1)
+	jsonNetwork.Biases = make([][]float64, network.NumLayers-1)
 	for i := 0; i < network.NumLayers-1; i++ {
 		jsonNetwork.Weights[i] = make([][]float64, network.LayerSizes[i+1])
 		for j := 0; j < network.LayerSizes[i+1]; j++ {
-			jsonNetwork.Weights[i][j] = make([]float64, network.LayerSizes[i])
-			for k := 0; k < network.LayerSizes[i]; k++ {
-				jsonNetwork.Weights[i][j][k] = network.Weights[i][j].AtVec(k)
-			}
+			jsonNetwork.Weights[i][j] = mat.Row(nil, j, network.Weights[i])
 		}
+		jsonNetwork.Biases[i] = mat.Col(nil, 0, network.Biases[i])
 	}
-	return jsonNetwork
+	return jsonNetwork, nil
 }
 
-func (jsonNetwork *JSONNetwork) ToNetwork() *Network {
+// ToNetwork checks that the layer sizes, weights and activation functions are consistent before converting
+func (jsonNetwork *JSONNetwork) ToNetwork() (*Network, error) {
+	if jsonNetwork.NumLayers < 2 || len(jsonNetwork.LayerSizes) != jsonNetwork.NumLayers || len(jsonNetwork.Weights) != jsonNetwork.NumLayers-1 || len(jsonNetwork.Biases) != jsonNetwork.NumLayers-1 || len(jsonNetwork.ActivationFunctions) != jsonNetwork.NumLayers-1 {
+		return nil, fmt.Errorf("malformed network with %v layers", jsonNetwork.NumLayers)
+	}
+	for i, size := range jsonNetwork.LayerSizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("layer %v has %v neurons", i, size)
+		}
+	}
+	for i := 0; i < jsonNetwork.NumLayers-1; i++ {
+		if len(jsonNetwork.Weights[i]) != jsonNetwork.LayerSizes[i+1] || len(jsonNetwork.Biases[i]) != jsonNetwork.LayerSizes[i+1] {
+			return nil, fmt.Errorf("layer %v should have %v neurons", i+1, jsonNetwork.LayerSizes[i+1])
+		}
+		for _, row := range jsonNetwork.Weights[i] {
+			if len(row) != jsonNetwork.LayerSizes[i] {
+				return nil, fmt.Errorf("neurons of layer %v should have %v weights", i+1, jsonNetwork.LayerSizes[i])
+			}
+		}
+	}
 	network := &Network{}
 	network.NumLayers = jsonNetwork.NumLayers
-	network.Biases = jsonNetwork.Biases
 	network.LayerSizes = jsonNetwork.LayerSizes
-	network.ActivationFunctions = make([]*activationfunction.ActivationFunction, jsonNetwork.NumLayers)
+	network.ActivationFunctions = make([]activationfunction.LayerActivationFunction, jsonNetwork.NumLayers-1)
 	for i := 0; i < jsonNetwork.NumLayers-1; i++ {
-		network.ActivationFunctions[i] = activationfunction.IntToActivationFunction[jsonNetwork.ActivationFunctions[i]]
+		activationFunction, ok := activationfunction.Get(string(jsonNetwork.ActivationFunctions[i]))
+		if !ok {
+			return nil, fmt.Errorf("unknown activation function %q", jsonNetwork.ActivationFunctions[i])
+		}
+		network.ActivationFunctions[i] = activationFunction
+	}
+	if jsonNetwork.Loss != "" {
+		lossFunction, ok := loss.Get(jsonNetwork.Loss)
+		if !ok {
+			return nil, fmt.Errorf("unknown loss %q", jsonNetwork.Loss)
+		}
+		network.Loss = lossFunction
 	}
-	network.Weights = make([][]*mat.VecDense, jsonNetwork.NumLayers-1)
+	network.DropoutRates = jsonNetwork.DropoutRates
+	if jsonNetwork.Normalizations != nil {
+		network.Normalizations = make([]*Normalization, len(jsonNetwork.Normalizations))
+		for i, jsonNormalization := range jsonNetwork.Normalizations {
+			if jsonNormalization != nil {
+				normalization, err := jsonNormalization.ToNormalization()
+				if err != nil {
+					return nil, fmt.Errorf("layer %v: %w", i+1, err)
+				}
+				network.Normalizations[i] = normalization
+			}
+		}
+	}
+	network.Weights = make([]*mat.Dense, jsonNetwork.NumLayers-1)
+	network.Biases = make([]*mat.VecDense, jsonNetwork.NumLayers-1)
 	for i := 0; i < jsonNetwork.NumLayers-1; i++ {
-		network.Weights[i] = make([]*mat.VecDense, jsonNetwork.LayerSizes[i+1])
+		network.Weights[i] = mat.NewDense(jsonNetwork.LayerSizes[i+1], jsonNetwork.LayerSizes[i], nil)
 		for j := 0; j < jsonNetwork.LayerSizes[i+1]; j++ {
-			network.Weights[i][j] = mat.NewVecDense(jsonNetwork.LayerSizes[i], make([]float64, jsonNetwork.LayerSizes[i]))
-			for k := 0; k < jsonNetwork.LayerSizes[i]; k++ {
-				network.Weights[i][j].SetVec(k, jsonNetwork.Weights[i][j][k])
-			}
+			network.Weights[i].SetRow(j, jsonNetwork.Weights[i][j])
 		}
+		network.Biases[i] = mat.NewVecDense(jsonNetwork.LayerSizes[i+1], deepcopy.PrimitiveSlice1D(jsonNetwork.Biases[i]))
 	}
-	return network
+	if err := network.Validate(); err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// Validate checks that the per layer settings fit the layers
+func (network *Network) Validate() error {
+	if len(network.Normalizations) > network.NumLayers-1 {
+		return fmt.Errorf("%v normalizations for %v layers", len(network.Normalizations), network.NumLayers-1)
+	}
+	if len(network.Regularization) > network.NumLayers-1 {
+		return fmt.Errorf("%v regularizations for %v layers", len(network.Regularization), network.NumLayers-1)
+	}
+	if len(network.DropoutRates) > network.NumLayers-1 {
+		return fmt.Errorf("%v dropout rates for %v layers", len(network.DropoutRates), network.NumLayers-1)
+	}
+	for i, rate := range network.DropoutRates {
+		if rate < 0 || rate >= 1 {
+			return fmt.Errorf("dropout rate %v of layer %v is outside [0, 1)", rate, i)
+		}
+	}
+	for i, normalization := range network.Normalizations {
+		if normalization == nil {
+			continue
+		}
+		if err := normalization.Validate(network.LayerSizes[i+1]); err != nil {
+			return fmt.Errorf("layer %v: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (network *Network) MarshalJSON() ([]byte, error) {
+	jsonNetwork, err := network.ToJSONNetwork()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonNetwork)
+}
+
+// Decode reads a network saved as a JSONNetwork
+func Decode(data []byte) (*Network, error) {
+	jsonNetwork := &JSONNetwork{}
+	if err := json.Unmarshal(data, jsonNetwork); err != nil {
+		return nil, err
+	}
+	return jsonNetwork.ToNetwork()
 }
 
-func NewNetwork(layerSizes []int, activationFunctions []*activationfunction.ActivationFunction) *Network {
+func NewNetwork(layerSizes []int, activationFunctions []activationfunction.LayerActivationFunction) *Network {
 	network := &Network{}
 
 	numLayers := len(layerSizes)
@@ -99,17 +235,11 @@ func NewNetwork(layerSizes []int, activationFunctions []*activationfunction.Acti
 
 	network.LayerSizes = layerSizes
 
-	network.Weights = make([][]*mat.VecDense, numLayers-1)
+	network.Weights = make([]*mat.Dense, numLayers-1)
+	network.Biases = make([]*mat.VecDense, numLayers-1)
 	for i := 0; i < numLayers-1; i++ {
-		network.Weights[i] = make([]*mat.VecDense, layerSizes[i+1])
-		for j := 0; j < layerSizes[i+1]; j++ {
-			network.Weights[i][j] = mat.NewVecDense(layerSizes[i], make([]float64, layerSizes[i]))
-		}
-	}
-
-	network.Biases = make([][]float64, numLayers-1)
-	for i := 0; i < numLayers-1; i++ {
-		network.Biases[i] = make([]float64, layerSizes[i+1])
+		network.Weights[i] = mat.NewDense(layerSizes[i+1], layerSizes[i], nil)
+		network.Biases[i] = mat.NewVecDense(layerSizes[i+1], nil)
 	}
 	network.ActivationFunctions = activationFunctions
 	return network
@@ -117,45 +247,107 @@ func NewNetwork(layerSizes []int, activationFunctions []*activationfunction.Acti
 
 func (network *Network) Randomize(minWeight, maxWeight, minBias, maxBias float64) {
 	for i := 0; i < len(network.Weights); i++ {
-		for j := 0; j < len(network.Weights[i]); j++ {
-			for k := 0; k < network.Weights[i][j].Len(); k++ {
-				network.Weights[i][j].SetVec(k, random.RandomFloat64(minWeight, maxWeight))
-			}
-		}
+		network.Weights[i].Apply(func(_, _ int, _ float64) float64 {
+			return random.RandomFloat64(minWeight, maxWeight)
+		}, network.Weights[i])
 	}
 
-	for i := 0; i < len(network.Weights); i++ {
-		for j := 0; j < len(network.Weights[i]); j++ {
-			network.Biases[i][j] = random.RandomFloat64(minBias, maxBias)
+	for i := 0; i < len(network.Biases); i++ {
+		for j := 0; j < network.Biases[i].Len(); j++ {
+			network.Biases[i].SetVec(j, random.RandomFloat64(minBias, maxBias))
 		}
 	}
 }
 
-func (network *Network) Run(inputs *mat.VecDense, returnNonOutputStates, returnStatesBeforeActivationFunction bool) (*mat.VecDense, []*mat.VecDense, []*mat.VecDense) {
+// rowMatrix copies a vector into a 1 x n matrix so it can go through the batched code paths
+func rowMatrix(vec mat.Vector) *mat.Dense {
+	return mat.NewDense(1, vec.Len(), mat.Col(nil, 0, vec))
+}
+
+// rowVector copies row i of a matrix into a new vector
+func rowVector(matrix mat.Matrix, i int) *mat.VecDense {
+	row := mat.Row(nil, i, matrix)
+	return mat.NewVecDense(len(row), row)
+}
+
+func rowMatrices(vecs []*mat.VecDense) []*mat.Dense {
+	result := make([]*mat.Dense, len(vecs))
+	for i := 0; i < len(vecs); i++ {
+		result[i] = rowMatrix(vecs[i])
+	}
+	return result
+}
+
+func rowVectors(matrices []*mat.Dense, i int) []*mat.VecDense {
+	result := make([]*mat.VecDense, len(matrices))
+	for j := 0; j < len(matrices); j++ {
+		result[j] = rowVector(matrices[j], i)
+	}
+	return result
+}
+
+// dropout zeroes each value of layer i with probability DropoutRates[i] and scales the rest up to keep the expected sum,
+// keeping the mask for DerivativeBatch
+func (network *Network) dropout(i int, layer *mat.Dense) *mat.Dense {
+	rate := network.DropoutRates[i]
+	numSamples, size := layer.Dims()
+	network.dropoutMasks[i] = mat.NewDense(numSamples, size, nil)
+	network.dropoutMasks[i].Apply(func(_, _ int, _ float64) float64 {
+		if random.RandomFloat64(0, 1) < rate {
+			return 0
+		}
+		return 1 / (1 - rate)
+	}, network.dropoutMasks[i])
+	result := mat.NewDense(numSamples, size, nil)
+	result.MulElem(layer, network.dropoutMasks[i])
+	return result
+}
+
+// RunBatch runs every row of inputs (numSamples x LayerSizes[0]) through the network at once, applying dropout when called by LearnBatch.
+// States are returned per layer as numSamples x LayerSizes[i] matrices, after dropout.
+func (network *Network) RunBatch(inputs *mat.Dense, returnNonOutputStates, returnStatesBeforeActivationFunction bool) (*mat.Dense, []*mat.Dense, []*mat.Dense) {
+	numSamples, _ := inputs.Dims()
 	prevLayer := inputs
 
-	states := []*mat.VecDense{}
+	states := []*mat.Dense{}
 	if returnNonOutputStates {
 		states = append(states, inputs)
 	}
 
-	statesBeforeActivationFunctions := []*mat.VecDense{}
+	statesBeforeActivationFunctions := []*mat.Dense{}
 	if returnStatesBeforeActivationFunction {
 		statesBeforeActivationFunctions = append(statesBeforeActivationFunctions, inputs)
 	}
 
-	var nextLayer *mat.VecDense
+	network.dropoutMasks = nil
+	if network.training {
+		network.dropoutMasks = make([]*mat.Dense, network.NumLayers-1)
+	}
+
+	var nextLayer *mat.Dense
 	for i := 1; i < network.NumLayers; i++ {
-		nextLayer = mat.NewVecDense(network.LayerSizes[i], make([]float64, network.LayerSizes[i]))
-		for j := 0; j < network.LayerSizes[i]; j++ {
-			nextLayer.SetVec(j, mat.Dot(prevLayer, network.Weights[i-1][j])+network.Biases[i-1][j])
+		if network.training && i-1 < len(network.DropoutRates) && network.DropoutRates[i-1] > 0 {
+			prevLayer = network.dropout(i-1, prevLayer)
+			if returnNonOutputStates {
+				states[i-1] = prevLayer
+			}
 		}
-		if returnStatesBeforeActivationFunction {
-			statesBeforeActivationFunctions = append(statesBeforeActivationFunctions, deepcopy.Vector(nextLayer))
+		nextLayer = mat.NewDense(numSamples, network.LayerSizes[i], nil)
+		nextLayer.Mul(prevLayer, network.Weights[i-1].T())
+		bias := network.Biases[i-1].RawVector().Data
+		for j := 0; j < numSamples; j++ {
+			row := nextLayer.RawRowView(j)
+			for k := 0; k < len(row); k++ {
+				row[k] += bias[k]
+			}
 		}
-		for j := 0; j < network.LayerSizes[i]; j++ {
-			nextLayer.SetVec(j, network.ActivationFunctions[i-1].Eval(nextLayer.AtVec(j)))
+		if normalization := network.normalization(i - 1); normalization != nil {
+			nextLayer = normalization.Forward(nextLayer, network.training)
+		}
+		if returnStatesBeforeActivationFunction {
+			statesBeforeActivationFunctions = append(statesBeforeActivationFunctions, nextLayer)
 		}
+		nextLayer = activationfunction.EvalBatch(network.ActivationFunctions[i-1], nextLayer)
 		if returnNonOutputStates {
 			states = append(states, nextLayer)
 		}
@@ -164,18 +356,27 @@ func (network *Network) Run(inputs *mat.VecDense, returnNonOutputStates, returnS
 	return nextLayer, states, statesBeforeActivationFunctions
 }
 
+func (network *Network) Run(inputs *mat.VecDense, returnNonOutputStates, returnStatesBeforeActivationFunction bool) (*mat.VecDense, []*mat.VecDense, []*mat.VecDense) {
+	output, states, statesBeforeActivationFunctions := network.RunBatch(rowMatrix(inputs), returnNonOutputStates, returnStatesBeforeActivationFunction)
+	return rowVector(output, 0), rowVectors(states, 0), rowVectors(statesBeforeActivationFunctions, 0)
+}
+
+// Predict runs every row of inputs through the network in inference mode
+func (network *Network) Predict(inputs *mat.Dense) *mat.Dense {
+	output, _, _ := network.RunBatch(inputs, false, false)
+	return output
+}
+
 func (network *Network) Vary(maxDiff float64) {
 	for i := 0; i < len(network.Weights); i++ {
-		for j := 0; j < len(network.Weights[i]); j++ {
-			for k := 0; k < network.Weights[i][j].Len(); k++ {
-				network.Weights[i][j].SetVec(k, network.Weights[i][j].AtVec(k)+random.RandomFloat64(-maxDiff, maxDiff))
-			}
-		}
+		network.Weights[i].Apply(func(_, _ int, x float64) float64 {
+			return x + random.RandomFloat64(-maxDiff, maxDiff)
+		}, network.Weights[i])
 	}
 
-	for i := 0; i < len(network.Weights); i++ {
-		for j := 0; j < len(network.Weights[i]); j++ {
-			network.Biases[i][j] += random.RandomFloat64(-maxDiff, maxDiff)
+	for i := 0; i < len(network.Biases); i++ {
+		for j := 0; j < network.Biases[i].Len(); j++ {
+			network.Biases[i].SetVec(j, network.Biases[i].AtVec(j)+random.RandomFloat64(-maxDiff, maxDiff))
 		}
 	}
 }
@@ -183,72 +384,139 @@ func (network *Network) Vary(maxDiff float64) {
 func (network *Network) Copy() *Network {
 	result := &Network{}
 	result.NumLayers = network.NumLayers
-	result.Biases = deepcopy.PrimitiveSlice2D(network.Biases)
-	result.Weights = deepcopy.VectorSlice2D(network.Weights)
+	result.Biases = deepcopy.VectorSlice1D(network.Biases)
+	result.Weights = deepcopy.MatrixSlice1D(network.Weights)
 	result.LayerSizes = deepcopy.PrimitiveSlice1D(network.LayerSizes)
 	result.ActivationFunctions = deepcopy.PrimitiveSlice1D(network.ActivationFunctions)
+	result.Loss = network.Loss
+	result.Regularization = network.Regularization
+	result.Autograd = network.Autograd
+	result.DropoutRates = deepcopy.PrimitiveSlice1D(network.DropoutRates)
+	if network.Normalizations != nil {
+		result.Normalizations = make([]*Normalization, len(network.Normalizations))
+		for i, normalization := range network.Normalizations {
+			if normalization != nil {
+				result.Normalizations[i] = normalization.Copy()
+			}
+		}
+	}
 	return result
 }
 
-func (network *Network) Derivative(states []*mat.VecDense, statesBeforeActivationFunctions []*mat.VecDense, groundTruth *mat.VecDense) ([][]*mat.VecDense, [][]float64) {
-	weightDerivatives := make([][]*mat.VecDense, network.NumLayers-1)
-	for i := 0; i < network.NumLayers-1; i++ {
-		weightDerivatives[i] = make([]*mat.VecDense, network.LayerSizes[i+1])
-		for j := 0; j < network.LayerSizes[i+1]; j++ {
-			weightDerivatives[i][j] = mat.NewVecDense(network.LayerSizes[i], make([]float64, network.LayerSizes[i]))
-		}
-	}
-	biasDerivatives := make([][]float64, network.NumLayers-1)
-	for i := 0; i < network.NumLayers-1; i++ {
-		biasDerivatives[i] = make([]float64, network.LayerSizes[i+1])
-	}
+func (network *Network) Clone() (model.Model, error) {
+	return network.Copy(), nil
+}
 
-	currDerivatives := mat.NewVecDense(network.LayerSizes[network.NumLayers-1], make([]float64, network.LayerSizes[network.NumLayers-1]))
-	for i := 0; i < network.LayerSizes[network.NumLayers-1]; i++ {
-		currDerivatives.SetVec(i, 2*(states[network.NumLayers-1].AtVec(i)-groundTruth.AtVec(i)))
-	}
+func (network *Network) SetLoss(lossFunction loss.Loss) {
+	network.Loss = lossFunction
+}
+
+// DerivativeBatch backpropagates lossFunction over a batch and returns the gradients averaged over its rows,
+// plus the gradients of the network's L1 and L2 penalties. The states must come from the last forward pass,
+// since the dropout masks and what normalizations need for backpropagation are taken from it.
+// The gradients of the normalizations' gammas and betas are kept in the normalizations.
+func (network *Network) DerivativeBatch(states []*mat.Dense, statesBeforeActivationFunctions []*mat.Dense, groundTruth *mat.Dense, lossFunction loss.Loss) ([]*mat.Dense, []*mat.VecDense) {
+	numSamples, _ := groundTruth.Dims()
+	weightDerivatives := make([]*mat.Dense, network.NumLayers-1)
+	biasDerivatives := make([]*mat.VecDense, network.NumLayers-1)
+
+	currDerivatives := lossFunction.Gradient(states[network.NumLayers-1], groundTruth)
 
 	for i := network.NumLayers - 1; i >= 1; i-- {
-		for j := 0; j < network.LayerSizes[i]; j++ {
-			currDerivatives.SetVec(j, currDerivatives.AtVec(j)*network.ActivationFunctions[i-1].Derivative(statesBeforeActivationFunctions[i].AtVec(j)))
+		currDerivatives = activationfunction.JacobianVectorProductBatch(network.ActivationFunctions[i-1], statesBeforeActivationFunctions[i], currDerivatives)
+		if normalization := network.normalization(i - 1); normalization != nil {
+			currDerivatives = normalization.Backward(currDerivatives)
 		}
 
-		newDerivatives := mat.NewVecDense(network.LayerSizes[i-1], make([]float64, network.LayerSizes[i-1]))
+		weightDerivatives[i-1] = mat.NewDense(network.LayerSizes[i], network.LayerSizes[i-1], nil)
+		weightDerivatives[i-1].Mul(currDerivatives.T(), states[i-1])
+		weightDerivatives[i-1].Scale(1/float64(numSamples), weightDerivatives[i-1])
 
-		for j := 0; j < network.LayerSizes[i]; j++ {
-			for k := 0; k < network.LayerSizes[i-1]; k++ {
-				weightDerivatives[i-1][j].SetVec(k, states[i-1].AtVec(k)*currDerivatives.AtVec(j))
-				newDerivatives.SetVec(k, newDerivatives.AtVec(k)+network.Weights[i-1][j].AtVec(k)*currDerivatives.AtVec(j))
-			}
+		biasDerivatives[i-1] = mat.NewVecDense(network.LayerSizes[i], nil)
+		for j := 0; j < numSamples; j++ {
+			biasDerivatives[i-1].AddVec(biasDerivatives[i-1], currDerivatives.RowView(j))
 		}
-		for j := 0; j < network.LayerSizes[i]; j++ {
-			biasDerivatives[i-1][j] = currDerivatives.AtVec(j)
+		biasDerivatives[i-1].ScaleVec(1/float64(numSamples), biasDerivatives[i-1])
+
+		if i > 1 {
+			newDerivatives := mat.NewDense(numSamples, network.LayerSizes[i-1], nil)
+			newDerivatives.Mul(currDerivatives, network.Weights[i-1])
+			if network.dropoutMasks != nil && network.dropoutMasks[i-1] != nil {
+				newDerivatives.MulElem(newDerivatives, network.dropoutMasks[i-1])
+			}
+			currDerivatives = newDerivatives
 		}
-		currDerivatives = newDerivatives
 	}
+	network.addPenaltyGradients(weightDerivatives)
 	return weightDerivatives, biasDerivatives
 }
 
-func (network *Network) Learn(inputs *mat.VecDense, groundTruth *mat.VecDense, learnRate float64) (float64, mat.Vector) {
-	output, states, statesBeforeActivationFunctions := network.Run(inputs, true, true)
-	weightDerivatives, biasDerivatives := network.Derivative(states, statesBeforeActivationFunctions, groundTruth)
+func (network *Network) Derivative(states []*mat.VecDense, statesBeforeActivationFunctions []*mat.VecDense, groundTruth *mat.VecDense, lossFunction loss.Loss) ([]*mat.Dense, []*mat.VecDense) {
+	return network.DerivativeBatch(rowMatrices(states), rowMatrices(statesBeforeActivationFunctions), rowMatrix(groundTruth), lossFunction)
+}
 
-	cost := float64(0)
-	for i := 0; i < network.LayerSizes[network.NumLayers-1]; i++ {
-		cost += (output.AtVec(i) - groundTruth.AtVec(i)) * (output.AtVec(i) - groundTruth.AtVec(i))
+// Flatten lists the raw data of each layer's weights followed by its biases, the layout optimizers work on
+func Flatten(weights []*mat.Dense, biases []*mat.VecDense) [][]float64 {
+	result := [][]float64{}
+	for i := 0; i < len(weights); i++ {
+		result = append(result, weights[i].RawMatrix().Data, biases[i].RawVector().Data)
 	}
+	return result
+}
 
-	for i := 0; i < network.NumLayers-1; i++ {
-		for j := 0; j < network.LayerSizes[i+1]; j++ {
-			for k := 0; k < network.LayerSizes[i]; k++ {
-				network.Weights[i][j].SetVec(k, network.Weights[i][j].AtVec(k)-learnRate*weightDerivatives[i][j].AtVec(k))
-			}
+// normalization returns the normalization of layer i, or nil if it has none
+func (network *Network) normalization(i int) *Normalization {
+	if i < len(network.Normalizations) {
+		return network.Normalizations[i]
+	}
+	return nil
+}
+
+// Parameters aliases the network's weights and biases, followed by the gammas and betas of its normalizations,
+// so updating the returned slices updates the network
+func (network *Network) Parameters() [][]float64 {
+	result := Flatten(network.Weights, network.Biases)
+	for _, normalization := range network.Normalizations {
+		if normalization != nil {
+			result = append(result, normalization.Params()...)
 		}
 	}
-	for i := 0; i < network.NumLayers-1; i++ {
-		for j := 0; j < network.LayerSizes[i+1]; j++ {
-			network.Biases[i][j] -= biasDerivatives[i][j] * learnRate
+	return result
+}
+
+// normalizationGradients lists the gradients of the gammas and betas kept by the last DerivativeBatch, in the order of Parameters
+func (network *Network) normalizationGradients() [][]float64 {
+	result := [][]float64{}
+	for _, normalization := range network.Normalizations {
+		if normalization != nil {
+			result = append(result, normalization.Grads()...)
 		}
 	}
+	return result
+}
+
+// LearnBatch takes one optimizer step on a batch, applies the network's weight decay and max-norm constraints,
+// and returns the batch's average cost including the L1 and L2 penalties.
+func (network *Network) LearnBatch(inputs *mat.Dense, groundTruth *mat.Dense, lossFunction loss.Loss, opt optimizer.Optimizer) (float64, *mat.Dense) {
+	network.training = true
+	if network.Autograd {
+		cost, output, grads := network.AutogradGradients(inputs, groundTruth, lossFunction)
+		network.training = false
+		opt.Update(network.Parameters(), grads)
+		network.constrain(opt.LearnRate())
+		return cost, output
+	}
+	output, states, statesBeforeActivationFunctions := network.RunBatch(inputs, true, true)
+	weightDerivatives, biasDerivatives := network.DerivativeBatch(states, statesBeforeActivationFunctions, groundTruth, lossFunction)
+	network.training = false
+
+	cost := lossFunction.Eval(output, groundTruth) + network.Penalty()
+	opt.Update(network.Parameters(), append(Flatten(weightDerivatives, biasDerivatives), network.normalizationGradients()...))
+	network.constrain(opt.LearnRate())
 	return cost, output
 }
+
+func (network *Network) Learn(inputs *mat.VecDense, groundTruth *mat.VecDense, learnRate float64, lossFunction loss.Loss) (float64, mat.Vector) {
+	cost, output := network.LearnBatch(rowMatrix(inputs), rowMatrix(groundTruth), lossFunction, optimizer.NewSGD(learnRate))
+	return cost, rowVector(output, 0)
+}
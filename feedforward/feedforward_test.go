@@ -0,0 +1,111 @@
+package feedforward
+
+import (
+	"encoding/json"
+	"math"
+	"nn/activationfunction"
+	"nn/loss"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func newTestNetwork() *Network {
+	network := NewNetwork([]int{3, 4, 2}, []activationfunction.LayerActivationFunction{activationfunction.Sigmoid, activationfunction.Softmax})
+	network.Randomize(-1, 1, -1, 1)
+	return network
+}
+
+func TestDerivativeBatch(t *testing.T) {
+	network := newTestNetwork()
+	inputs := mat.NewDense(2, 3, []float64{1, 2, 3, -1, 0.5, 0})
+	groundTruth := mat.NewDense(2, 2, []float64{1, 0, 0, 1})
+	cost := func() float64 {
+		output, _, _ := network.RunBatch(inputs, false, false)
+		return loss.SquaredError.Eval(output, groundTruth)
+	}
+	_, states, statesBeforeActivationFunctions := network.RunBatch(inputs, true, true)
+	weightDerivatives, biasDerivatives := network.DerivativeBatch(states, statesBeforeActivationFunctions, groundTruth, loss.SquaredError)
+	params := network.Parameters()
+	grads := Flatten(weightDerivatives, biasDerivatives)
+	for i := range params {
+		for j := range params[i] {
+			value := params[i][j]
+			params[i][j] = value + 1e-6
+			above := cost()
+			params[i][j] = value - 1e-6
+			below := cost()
+			params[i][j] = value
+			if want := (above - below) / 2e-6; math.Abs(grads[i][j]-want) > 1e-6 {
+				t.Errorf("parameter %d[%d]: gradient %g, finite differences give %g", i, j, grads[i][j], want)
+			}
+		}
+	}
+}
+
+func TestRunMatchesRunBatch(t *testing.T) {
+	network := newTestNetwork()
+	inputs := mat.NewDense(2, 3, []float64{1, 2, 3, -1, 0.5, 0})
+	outputs, _, _ := network.RunBatch(inputs, false, false)
+	for i := 0; i < 2; i++ {
+		output, _, _ := network.Run(mat.VecDenseCopyOf(inputs.RowView(i)), false, false)
+		if !mat.Equal(output, outputs.RowView(i)) {
+			t.Errorf("sample %d: Run gives %v, RunBatch gives %v", i, mat.Formatted(output.T()), mat.Formatted(outputs.RowView(i).T()))
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	network := newTestNetwork()
+	network.Loss = loss.NewHuber(0.5)
+	encoded, err := json.Marshal(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reencoded) != string(encoded) {
+		t.Errorf("re-encoding gave\n%s\nwant\n%s", reencoded, encoded)
+	}
+	inputs := mat.NewDense(2, 3, []float64{1, 2, 3, -1, 0.5, 0})
+	if !mat.Equal(decoded.Predict(inputs), network.Predict(inputs)) {
+		t.Error("decoded network predicts differently")
+	}
+}
+
+func TestDecodeUnknownLoss(t *testing.T) {
+	document := `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":["sigmoid"],"Loss":"squaredEror"}`
+	if _, err := Decode([]byte(document)); err == nil {
+		t.Error("decoded a misspelled loss without an error")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	documents := map[string]string{
+		"one layer":           `{"NumLayers":1,"LayerSizes":[1],"Weights":[],"Biases":[],"ActivationFunctions":[]}`,
+		"no layers":           `{"NumLayers":0}`,
+		"empty layer":         `{"NumLayers":2,"LayerSizes":[1,0],"Weights":[[]],"Biases":[[]],"ActivationFunctions":["sigmoid"]}`,
+		"negative layer size": `{"NumLayers":2,"LayerSizes":[-1,1],"Weights":[[[]]],"Biases":[[0]],"ActivationFunctions":["sigmoid"]}`,
+		"missing weights":     `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[],"Biases":[[0]],"ActivationFunctions":["sigmoid"]}`,
+		"short weight row":    `{"NumLayers":2,"LayerSizes":[2,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":["sigmoid"]}`,
+		"unknown activation":  `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":["nope"]}`,
+		"unregistered legacy": `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":[2]}`,
+		"dropout rate of one": `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":["sigmoid"],"DropoutRates":[1]}`,
+		"too many dropouts":   `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":["sigmoid"],"DropoutRates":[0,0]}`,
+	}
+	for name, document := range documents {
+		if _, err := Decode([]byte(document)); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+	legacy := `{"NumLayers":2,"LayerSizes":[1,1],"Weights":[[[1]]],"Biases":[[0]],"ActivationFunctions":[1]}`
+	if _, err := Decode([]byte(legacy)); err != nil {
+		t.Errorf("legacy sigmoid code: %v", err)
+	}
+}
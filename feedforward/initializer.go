@@ -0,0 +1,201 @@
+package feedforward
+
+import (
+	"fmt"
+	"math"
+	"nn/random"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initializer fills a layer's weights (LayerSizes[i+1] x LayerSizes[i]) or biases (LayerSizes[i+1] x 1)
+// using the layer's fan-in LayerSizes[i] and fan-out LayerSizes[i+1]
+type Initializer interface {
+	Init(values *mat.Dense, fanIn, fanOut int)
+}
+
+type uniform struct {
+	limit func(fanIn, fanOut int) float64
+}
+
+func (initializer uniform) Init(values *mat.Dense, fanIn, fanOut int) {
+	limit := initializer.limit(fanIn, fanOut)
+	values.Apply(func(_, _ int, _ float64) float64 {
+		return random.RandomFloat64(-limit, limit)
+	}, values)
+}
+
+type normal struct {
+	stddev func(fanIn, fanOut int) float64
+}
+
+func (initializer normal) Init(values *mat.Dense, fanIn, fanOut int) {
+	stddev := initializer.stddev(fanIn, fanOut)
+	values.Apply(func(_, _ int, _ float64) float64 {
+		return random.RandomNormal(0, stddev)
+	}, values)
+}
+
+type constant struct {
+	value float64
+}
+
+func (initializer constant) Init(values *mat.Dense, fanIn, fanOut int) {
+	values.Apply(func(_, _ int, _ float64) float64 {
+		return initializer.value
+	}, values)
+}
+
+func NewConstant(value float64) Initializer {
+	return constant{value: value}
+}
+
+type truncatedNormal struct {
+	mean   float64
+	stddev float64
+}
+
+// Init redraws values more than 2 standard deviations from the mean
+func (initializer truncatedNormal) Init(values *mat.Dense, fanIn, fanOut int) {
+	values.Apply(func(_, _ int, _ float64) float64 {
+		for {
+			value := random.RandomNormal(initializer.mean, initializer.stddev)
+			if math.Abs(value-initializer.mean) <= 2*initializer.stddev {
+				return value
+			}
+		}
+	}, values)
+}
+
+func NewTruncatedNormal(mean, stddev float64) Initializer {
+	return truncatedNormal{mean: mean, stddev: stddev}
+}
+
+type orthogonal struct {
+	gain float64
+}
+
+// Init fills values with gain times a random matrix with orthonormal rows or columns, whichever there are fewer of
+func (initializer orthogonal) Init(values *mat.Dense, fanIn, fanOut int) {
+	rows, cols := values.Dims()
+	transposed := rows < cols
+	if transposed {
+		rows, cols = cols, rows
+	}
+	gaussian := mat.NewDense(rows, cols, nil)
+	gaussian.Apply(func(_, _ int, _ float64) float64 {
+		return random.RandomNormal(0, 1)
+	}, gaussian)
+	qr := mat.QR{}
+	qr.Factorize(gaussian)
+	q, r := &mat.Dense{}, &mat.Dense{}
+	qr.QTo(q)
+	qr.RTo(r)
+	//flipping columns by the signs of R's diagonal makes the distribution uniform over orthogonal matrices
+	orthonormal := mat.NewDense(rows, cols, nil)
+	orthonormal.Apply(func(i, j int, _ float64) float64 {
+		sign := 1.0
+		if r.At(j, j) < 0 {
+			sign = -1
+		}
+		return initializer.gain * sign * q.At(i, j)
+	}, orthonormal)
+	if transposed {
+		values.Copy(orthonormal.T())
+	} else {
+		values.Copy(orthonormal)
+	}
+}
+
+func NewOrthogonal(gain float64) Initializer {
+	return orthogonal{gain: gain}
+}
+
+var XavierUniform Initializer = uniform{limit: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(6 / float64(fanIn+fanOut))
+}}
+
+var XavierNormal Initializer = normal{stddev: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(2 / float64(fanIn+fanOut))
+}}
+
+var HeUniform Initializer = uniform{limit: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(6 / float64(fanIn))
+}}
+
+var HeNormal Initializer = normal{stddev: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(2 / float64(fanIn))
+}}
+
+var LeCunUniform Initializer = uniform{limit: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(3 / float64(fanIn))
+}}
+
+var LeCunNormal Initializer = normal{stddev: func(fanIn, fanOut int) float64 {
+	return math.Sqrt(1 / float64(fanIn))
+}}
+
+var Orthogonal = NewOrthogonal(1)
+var Zeros = NewConstant(0)
+var TruncatedNormal = NewTruncatedNormal(0, 0.05)
+
+var NameToInitializer = map[string]Initializer{
+	"xavierUniform":   XavierUniform,
+	"xavierNormal":    XavierNormal,
+	"glorotUniform":   XavierUniform,
+	"glorotNormal":    XavierNormal,
+	"heUniform":       HeUniform,
+	"heNormal":        HeNormal,
+	"kaimingUniform":  HeUniform,
+	"kaimingNormal":   HeNormal,
+	"lecunUniform":    LeCunUniform,
+	"lecunNormal":     LeCunNormal,
+	"orthogonal":      Orthogonal,
+	"zeros":           Zeros,
+	"truncatedNormal": TruncatedNormal,
+}
+
+// InitializeLayer fills the weights and biases of layer i, which maps LayerSizes[i] values to LayerSizes[i+1]
+func (network *Network) InitializeLayer(i int, weightInitializer, biasInitializer Initializer) {
+	fanIn, fanOut := network.LayerSizes[i], network.LayerSizes[i+1]
+	weightInitializer.Init(network.Weights[i], fanIn, fanOut)
+	biasInitializer.Init(mat.NewDense(fanOut, 1, network.Biases[i].RawVector().Data), fanIn, fanOut)
+}
+
+// Initialize fills every layer, taking one weight and one bias initializer per layer
+func (network *Network) Initialize(weightInitializers, biasInitializers []Initializer) {
+	if len(weightInitializers) != len(network.Weights) || len(biasInitializers) != len(network.Biases) {
+		panic(fmt.Sprintf("network has %v layers but got %v weight and %v bias initializers", len(network.Weights), len(weightInitializers), len(biasInitializers)))
+	}
+	for i := range network.Weights {
+		network.InitializeLayer(i, weightInitializers[i], biasInitializers[i])
+	}
+}
+
+// InitializeAll fills every layer with the same initializers
+func (network *Network) InitializeAll(weightInitializer, biasInitializer Initializer) {
+	for i := range network.Weights {
+		network.InitializeLayer(i, weightInitializer, biasInitializer)
+	}
+}
+
+// InitializeByName is Initialize with initializers from NameToInitializer
+func (network *Network) InitializeByName(weightInitializers, biasInitializers []string) error {
+	weights := make([]Initializer, len(weightInitializers))
+	biases := make([]Initializer, len(biasInitializers))
+	for i, name := range weightInitializers {
+		if weights[i] = NameToInitializer[name]; weights[i] == nil {
+			return fmt.Errorf("unknown initializer %q", name)
+		}
+	}
+	for i, name := range biasInitializers {
+		if biases[i] = NameToInitializer[name]; biases[i] == nil {
+			return fmt.Errorf("unknown initializer %q", name)
+		}
+	}
+	if len(weights) != len(network.Weights) || len(biases) != len(network.Biases) {
+		return fmt.Errorf("network has %v layers but got %v weight and %v bias initializers", len(network.Weights), len(weights), len(biases))
+	}
+	network.Initialize(weights, biases)
+	return nil
+}
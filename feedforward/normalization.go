@@ -0,0 +1,260 @@
+package feedforward
+
+import (
+	"fmt"
+	"math"
+	"nn/deepcopy"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type NormalizationKind string
+
+const (
+	BatchNorm NormalizationKind = "batchNorm" //normalizes each value over the batch, using running statistics outside of training
+	LayerNorm NormalizationKind = "layerNorm" //normalizes each sample over its values
+)
+
+// Normalization sits between a layer's weights and biases and its activation function,
+// normalizing the values and then scaling them by Gamma and shifting them by Beta, which are learned.
+type Normalization struct {
+	Kind            NormalizationKind
+	Gamma           *mat.VecDense
+	Beta            *mat.VecDense
+	RunningMean     *mat.VecDense //batch norm only
+	RunningVariance *mat.VecDense //batch norm only
+	Momentum        float64       //weight of the current batch in the running statistics
+	Epsilon         float64       //added to variances before dividing by their square root
+
+	//of the last forward pass, for backpropagation
+	normalized       *mat.Dense
+	invStds          []float64 //per column for batch norm, per row for layer norm
+	usedRunningStats bool
+	gammaGradient    *mat.VecDense
+	betaGradient     *mat.VecDense
+}
+
+type JSONNormalization struct {
+	Kind            NormalizationKind
+	Gamma           []float64
+	Beta            []float64
+	RunningMean     []float64 `json:",omitempty"`
+	RunningVariance []float64 `json:",omitempty"`
+	Momentum        float64   `json:",omitempty"`
+	Epsilon         float64
+}
+
+func newNormalization(kind NormalizationKind, size int) *Normalization {
+	gamma := mat.NewVecDense(size, nil)
+	for i := 0; i < size; i++ {
+		gamma.SetVec(i, 1)
+	}
+	return &Normalization{Kind: kind, Gamma: gamma, Beta: mat.NewVecDense(size, nil), Epsilon: 1e-5}
+}
+
+func NewBatchNorm(size int, momentum float64) *Normalization {
+	normalization := newNormalization(BatchNorm, size)
+	normalization.RunningMean = mat.NewVecDense(size, nil)
+	normalization.RunningVariance = mat.NewVecDense(size, nil)
+	for i := 0; i < size; i++ {
+		normalization.RunningVariance.SetVec(i, 1)
+	}
+	normalization.Momentum = momentum
+	return normalization
+}
+
+func NewLayerNorm(size int) *Normalization {
+	return newNormalization(LayerNorm, size)
+}
+
+func vecOrNil(data []float64) *mat.VecDense {
+	if data == nil {
+		return nil
+	}
+	return mat.NewVecDense(len(data), deepcopy.PrimitiveSlice1D(data))
+}
+
+func rawOrNil(vec *mat.VecDense) []float64 {
+	if vec == nil {
+		return nil
+	}
+	return mat.Col(nil, 0, vec)
+}
+
+func (normalization *Normalization) ToJSONNormalization() *JSONNormalization {
+	return &JSONNormalization{
+		Kind:            normalization.Kind,
+		Gamma:           rawOrNil(normalization.Gamma),
+		Beta:            rawOrNil(normalization.Beta),
+		RunningMean:     rawOrNil(normalization.RunningMean),
+		RunningVariance: rawOrNil(normalization.RunningVariance),
+		Momentum:        normalization.Momentum,
+		Epsilon:         normalization.Epsilon,
+	}
+}
+
+// ToNormalization fails for an unknown Kind or if the lengths of Gamma, Beta and the running statistics differ
+func (jsonNormalization *JSONNormalization) ToNormalization() (*Normalization, error) {
+	normalization := &Normalization{
+		Kind:            jsonNormalization.Kind,
+		Gamma:           vecOrNil(jsonNormalization.Gamma),
+		Beta:            vecOrNil(jsonNormalization.Beta),
+		RunningMean:     vecOrNil(jsonNormalization.RunningMean),
+		RunningVariance: vecOrNil(jsonNormalization.RunningVariance),
+		Momentum:        jsonNormalization.Momentum,
+		Epsilon:         jsonNormalization.Epsilon,
+	}
+	if err := normalization.Validate(len(jsonNormalization.Gamma)); err != nil {
+		return nil, err
+	}
+	return normalization, nil
+}
+
+// Validate checks that the normalization has a known Kind and parameters for size values
+func (normalization *Normalization) Validate(size int) error {
+	if normalization.Kind != BatchNorm && normalization.Kind != LayerNorm {
+		return fmt.Errorf("unknown normalization %q", normalization.Kind)
+	}
+	if normalization.Gamma == nil || normalization.Gamma.Len() != size || normalization.Beta == nil || normalization.Beta.Len() != size {
+		return fmt.Errorf("%v should have %v values of Gamma and Beta", normalization.Kind, size)
+	}
+	if normalization.Kind == BatchNorm && (normalization.RunningMean == nil || normalization.RunningMean.Len() != size || normalization.RunningVariance == nil || normalization.RunningVariance.Len() != size) {
+		return fmt.Errorf("%v should have a running mean and variance of %v values", normalization.Kind, size)
+	}
+	return nil
+}
+
+func (normalization *Normalization) Copy() *Normalization {
+	return &Normalization{
+		Kind:            normalization.Kind,
+		Gamma:           vecOrNil(rawOrNil(normalization.Gamma)),
+		Beta:            vecOrNil(rawOrNil(normalization.Beta)),
+		RunningMean:     vecOrNil(rawOrNil(normalization.RunningMean)),
+		RunningVariance: vecOrNil(rawOrNil(normalization.RunningVariance)),
+		Momentum:        normalization.Momentum,
+		Epsilon:         normalization.Epsilon,
+	}
+}
+
+// Params aliases Gamma and Beta
+func (normalization *Normalization) Params() [][]float64 {
+	return [][]float64{normalization.Gamma.RawVector().Data, normalization.Beta.RawVector().Data}
+}
+
+// Grads returns the gradients of Gamma and Beta kept by the last Backward
+func (normalization *Normalization) Grads() [][]float64 {
+	return [][]float64{normalization.gammaGradient.RawVector().Data, normalization.betaGradient.RawVector().Data}
+}
+
+// normalize computes the normalized value of x (numSamples x size) in place, grouping values by column for batch norm and by row for layer norm.
+// Batch norm uses the running statistics unless training, and updates them when training.
+func (normalization *Normalization) normalize(x *mat.Dense, training bool) {
+	numSamples, size := x.Dims()
+	normalization.usedRunningStats = normalization.Kind == BatchNorm && !training
+	if normalization.usedRunningStats {
+		normalization.invStds = make([]float64, size)
+		for j := 0; j < size; j++ {
+			normalization.invStds[j] = 1 / math.Sqrt(normalization.RunningVariance.AtVec(j)+normalization.Epsilon)
+		}
+		x.Apply(func(_, j int, value float64) float64 {
+			return (value - normalization.RunningMean.AtVec(j)) * normalization.invStds[j]
+		}, x)
+		return
+	}
+
+	numGroups, groupSize := size, numSamples
+	at := func(group, k int) float64 { return x.At(k, group) }
+	if normalization.Kind == LayerNorm {
+		numGroups, groupSize = numSamples, size
+		at = func(group, k int) float64 { return x.At(group, k) }
+	}
+	means := make([]float64, numGroups)
+	normalization.invStds = make([]float64, numGroups)
+	for group := 0; group < numGroups; group++ {
+		for k := 0; k < groupSize; k++ {
+			means[group] += at(group, k)
+		}
+		means[group] /= float64(groupSize)
+		variance := float64(0)
+		for k := 0; k < groupSize; k++ {
+			variance += (at(group, k) - means[group]) * (at(group, k) - means[group])
+		}
+		variance /= float64(groupSize)
+		normalization.invStds[group] = 1 / math.Sqrt(variance+normalization.Epsilon)
+
+		if normalization.Kind == BatchNorm {
+			unbiasedVariance := variance
+			if groupSize > 1 {
+				unbiasedVariance *= float64(groupSize) / float64(groupSize-1)
+			}
+			normalization.RunningMean.SetVec(group, (1-normalization.Momentum)*normalization.RunningMean.AtVec(group)+normalization.Momentum*means[group])
+			normalization.RunningVariance.SetVec(group, (1-normalization.Momentum)*normalization.RunningVariance.AtVec(group)+normalization.Momentum*unbiasedVariance)
+		}
+	}
+	x.Apply(func(i, j int, value float64) float64 {
+		if normalization.Kind == LayerNorm {
+			return (value - means[i]) * normalization.invStds[i]
+		}
+		return (value - means[j]) * normalization.invStds[j]
+	}, x)
+}
+
+// Forward normalizes x (numSamples x size) and applies Gamma and Beta, keeping what Backward needs
+func (normalization *Normalization) Forward(x *mat.Dense, training bool) *mat.Dense {
+	normalization.normalized = mat.DenseCopyOf(x)
+	normalization.normalize(normalization.normalized, training)
+	result := mat.NewDense(x.RawMatrix().Rows, x.RawMatrix().Cols, nil)
+	result.Apply(func(_, j int, value float64) float64 {
+		return normalization.Gamma.AtVec(j)*value + normalization.Beta.AtVec(j)
+	}, normalization.normalized)
+	return result
+}
+
+// Backward turns the gradients with respect to the last Forward's outputs into gradients with respect to its inputs.
+// Gamma's and Beta's gradients are averaged over the batch and kept for the optimizer.
+func (normalization *Normalization) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, size := grad.Dims()
+	normalized := normalization.normalized
+	normalization.gammaGradient = mat.NewVecDense(size, nil)
+	normalization.betaGradient = mat.NewVecDense(size, nil)
+	for i := 0; i < numSamples; i++ {
+		for j := 0; j < size; j++ {
+			normalization.gammaGradient.SetVec(j, normalization.gammaGradient.AtVec(j)+grad.At(i, j)*normalized.At(i, j)/float64(numSamples))
+			normalization.betaGradient.SetVec(j, normalization.betaGradient.AtVec(j)+grad.At(i, j)/float64(numSamples))
+		}
+	}
+
+	normalizedGrad := mat.NewDense(numSamples, size, nil)
+	normalizedGrad.Apply(func(_, j int, value float64) float64 {
+		return value * normalization.Gamma.AtVec(j)
+	}, grad)
+	result := mat.NewDense(numSamples, size, nil)
+	if normalization.usedRunningStats {
+		result.Apply(func(_, j int, value float64) float64 {
+			return value * normalization.invStds[j]
+		}, normalizedGrad)
+		return result
+	}
+
+	//the mean and variance depend on every value of their group, which adds
+	//- mean(normalizedGrad) - normalized * mean(normalizedGrad * normalized) within each group
+	numGroups, groupSize := size, numSamples
+	index := func(group, k int) (int, int) { return k, group }
+	if normalization.Kind == LayerNorm {
+		numGroups, groupSize = numSamples, size
+		index = func(group, k int) (int, int) { return group, k }
+	}
+	for group := 0; group < numGroups; group++ {
+		meanGrad, meanGradNormalized := float64(0), float64(0)
+		for k := 0; k < groupSize; k++ {
+			i, j := index(group, k)
+			meanGrad += normalizedGrad.At(i, j) / float64(groupSize)
+			meanGradNormalized += normalizedGrad.At(i, j) * normalized.At(i, j) / float64(groupSize)
+		}
+		for k := 0; k < groupSize; k++ {
+			i, j := index(group, k)
+			result.Set(i, j, normalization.invStds[group]*(normalizedGrad.At(i, j)-meanGrad-normalized.At(i, j)*meanGradNormalized))
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package feedforward
+
+import (
+	"math"
+	"nn/mathext"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Regularization constrains the weights of one layer, biases are left alone. Zero fields are off.
+type Regularization struct {
+	L1          float64 //adds L1 * sum(|w|) to the cost
+	L2          float64 //adds L2 * sum(w^2) to the cost
+	WeightDecay float64 //after each update, w -= learnRate * WeightDecay * w, without going through the optimizer
+	MaxNorm     float64 //after each update, the incoming weights of each neuron are scaled down to at most this L2 norm
+}
+
+// UniformRegularization gives every layer of a network with numLayers layers the same regularization
+func UniformRegularization(numLayers int, regularization Regularization) []Regularization {
+	result := make([]Regularization, numLayers-1)
+	for i := range result {
+		result[i] = regularization
+	}
+	return result
+}
+
+// Penalty is the L1 and L2 cost of the network's weights
+func (network *Network) Penalty() float64 {
+	penalty := float64(0)
+	for i, regularization := range network.Regularization {
+		if regularization.L1 == 0 && regularization.L2 == 0 {
+			continue
+		}
+		for _, w := range network.Weights[i].RawMatrix().Data {
+			penalty += regularization.L1*math.Abs(w) + regularization.L2*w*w
+		}
+	}
+	return penalty
+}
+
+// addPenaltyGradients adds the gradients of Penalty to weightDerivatives
+func (network *Network) addPenaltyGradients(weightDerivatives []*mat.Dense) {
+	for i, regularization := range network.Regularization {
+		if regularization.L1 == 0 && regularization.L2 == 0 {
+			continue
+		}
+		weightDerivatives[i].Apply(func(j, k int, derivative float64) float64 {
+			w := network.Weights[i].At(j, k)
+			return derivative + regularization.L1*mathext.Sign(w) + 2*regularization.L2*w
+		}, weightDerivatives[i])
+	}
+}
+
+// constrain applies weight decay and max-norm constraints after an update with the given learning rate
+func (network *Network) constrain(learnRate float64) {
+	for i, regularization := range network.Regularization {
+		if regularization.WeightDecay != 0 {
+			network.Weights[i].Scale(1-learnRate*regularization.WeightDecay, network.Weights[i])
+		}
+		if regularization.MaxNorm != 0 {
+			rows, _ := network.Weights[i].Dims()
+			for j := 0; j < rows; j++ {
+				row := network.Weights[i].RowView(j).(*mat.VecDense)
+				if norm := mat.Norm(row, 2); norm > regularization.MaxNorm {
+					row.ScaleVec(regularization.MaxNorm/norm, row)
+				}
+			}
+		}
+	}
+}
@@ -1,66 +1,103 @@
 package geneticalgorithm
 
 import (
-	"fmt"
 	"math"
 	"nn/activationfunction"
+	"nn/callback"
+	"nn/checkpoint"
 	"nn/codec"
+	"nn/dataset"
+	"nn/deepcopy"
 	"nn/feedforward"
+	"nn/loss"
+	"nn/random"
 	"nn/render"
+	"os"
 	"sort"
 
 	"github.com/goccy/go-graphviz"
 	"gonum.org/v1/gonum/mat"
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
-	"gonum.org/v1/plot/vg"
 )
 
-func calcCost(network *feedforward.Network, numSamples int, genInput func() (*mat.VecDense, *mat.VecDense)) float64 {
-	totalCost := float64(0)
-	for i := 0; i < numSamples; i++ {
-		input, groundTruthOutput := genInput()
-		output, _, _ := network.Run(input, false, false)
-
-		currCost := float64(0)
-		for j := 0; j < input.Len(); j++ {
-			currCost += (output.AtVec(j) - groundTruthOutput.AtVec(j)) * (output.AtVec(j) - groundTruthOutput.AtVec(j))
+// notify calls event on every callback in order, panicking if one fails, and reports whether one of them stopped the run
+func notify(callbacks []callback.Callback, state *callback.State, event func(callback.Callback, *callback.State)) bool {
+	for _, currCallback := range callbacks {
+		event(currCallback, state)
+		if state.Err != nil {
+			panic(state.Err)
 		}
-		totalCost += currCost
 	}
-	return totalCost / float64(numSamples)
+	return state.Stop
+}
+
+func calcCost(network *feedforward.Network, numSamples int, lossFunction loss.Loss, data dataset.Dataset) float64 {
+	inputs, groundTruthOutputs := dataset.RandomBatch(data, numSamples)
+	outputs, _, _ := network.RunBatch(inputs, false, false)
+	return lossFunction.Eval(outputs, groundTruthOutputs)
 }
 
-func Run(poolSize, numSelected, numSteps, numSamples int, layerSizes []int, activationFunctions []*activationfunction.ActivationFunction, genInput func() (*mat.VecDense, *mat.VecDense)) {
+// Run evolves a pool of networks for numSteps generations.
+// Checkpoints are saved every checkpoints.Every generations if checkpoints isn't nil, and resumeFrom continues a run from one.
+// callbacks are notified after every generation and can stop the run early.
+func Run(poolSize, numSelected, numSteps, numSamples int, layerSizes []int, activationFunctions []activationfunction.LayerActivationFunction, lossFunction loss.Loss, data dataset.Dataset, checkpoints *checkpoint.Manager, resumeFrom *checkpoint.Checkpoint, callbacks ...callback.Callback) {
 	avgCostRange := 1
 
-	avgCostPlot := plot.New()
-	avgCostPlot.X.Label.Text = "step"
-	avgCostPlot.Y.Label.Text = "avg cost (last 100 steps)"
+	callbacks = append(callbacks, &callback.Progress{Writer: os.Stdout})
+	if checkpoints != nil {
+		if checkpoints.Every <= 0 {
+			defaultCheckpoints := *checkpoints
+			defaultCheckpoints.Every = 1
+			checkpoints = &defaultCheckpoints
+		}
+		callbacks = append(callbacks, &callback.Checkpoint{Manager: checkpoints})
+	}
+	callbacks = append(callbacks, &callback.Plot{Path: "output/cost.png", AvgCostRange: avgCostRange})
 
-	currCostSamples := []float64{}
-	avgCosts := []float64{}
+	bestCosts := []float64{}
 
 	pool := []*feedforward.Network{}
-	for i := 0; i < poolSize; i++ {
-		network := feedforward.NewNetwork(layerSizes, activationFunctions)
-		network.Randomize(-1, 1, -1, 1)
-		pool = append(pool, network)
+	var bestNetwork *feedforward.Network
+	bestCost := math.MaxFloat64
+	firstStep := 0
+	if resumeFrom == nil {
+		for i := 0; i < poolSize; i++ {
+			network := feedforward.NewNetwork(layerSizes, activationFunctions)
+			network.Randomize(-1, 1, -1, 1)
+			network.Loss = lossFunction
+			pool = append(pool, network)
+		}
+	} else {
+		for _, jsonNetwork := range resumeFrom.Pool {
+			network, err := jsonNetwork.ToNetwork()
+			if err != nil {
+				panic(err)
+			}
+			network.Loss = lossFunction
+			pool = append(pool, network)
+		}
+		var err error
+		bestNetwork, err = feedforward.Decode(resumeFrom.Network)
+		if err != nil {
+			panic(err)
+		}
+		bestNetwork.Loss = lossFunction
+		bestCost = resumeFrom.Cost
+		bestCosts = deepcopy.PrimitiveSlice1D(resumeFrom.CostHistory)
+		firstStep = resumeFrom.Step
+		random.SetState(resumeFrom.RandomState)
 	}
 
 	nextPool := []*feedforward.Network{}
+	state := &callback.State{Generation: firstStep}
 
-	var bestNetwork *feedforward.Network
-	bestCost := math.MaxFloat64
-	for i := 0; i < numSteps; i++ {
+	for i := firstStep; i < numSteps; i++ {
 		costSum := float64(0)
 
 		costs := make([]float64, poolSize)
 		indices := make([]int, poolSize)
 		for j := 0; j < poolSize; j++ {
 			indices[j] = j
-			costs[j] = calcCost(pool[j], numSamples, genInput)
+			costs[j] = calcCost(pool[j], numSamples, lossFunction, data)
 			costSum += costs[j]
 			if costs[j] < bestCost {
 				bestCost = costs[j]
@@ -81,29 +118,21 @@ func Run(poolSize, numSelected, numSteps, numSamples int, layerSizes []int, acti
 		}
 		pool = nextPool
 		nextPool = []*feedforward.Network{}
-		fmt.Printf("Step %v | avg cost %v | best cost %v\n", i, costSum/float64(poolSize), bestCost)
-
-		if len(currCostSamples) == avgCostRange {
-			currCostSamples = currCostSamples[1:]
+		bestCosts = append(bestCosts, bestCost)
+
+		state.Network = bestNetwork
+		state.Pool = pool
+		state.Generation = i + 1
+		state.Cost = bestCost
+		state.AvgCost = costSum / float64(poolSize)
+		state.Costs = bestCosts
+		if notify(callbacks, state, callback.Callback.OnGenerationEnd) {
+			break
 		}
-		currCostSamples = append(currCostSamples, bestCost)
-
-		currCostSampleSum := float64(0)
-		for _, cost := range currCostSamples {
-			currCostSampleSum += cost
-		}
-		avgCosts = append(avgCosts, currCostSampleSum/float64(len(currCostSamples)))
-	}
-
-	avgCostPlotPoints := make(plotter.XYs, numSteps)
-	for i := 0; i < numSteps; i++ {
-		avgCostPlotPoints[i].X = float64(i)
-		avgCostPlotPoints[i].Y = avgCosts[i]
-	}
-	plotutil.AddLinePoints(avgCostPlot, "avg cost", avgCostPlotPoints)
-	if err := avgCostPlot.Save(4*vg.Inch, 4*vg.Inch, "output/cost.png"); err != nil {
-		panic(err)
 	}
+	state.Network = bestNetwork
+	state.Costs = bestCosts
+	notify(callbacks, state, callback.Callback.OnTrainEnd)
 
 	render.RenderFeedForward(bestNetwork, mat.NewVecDense(2, make([]float64, 2)), 20, 20, graphviz.PNG, "output/feedforward.png")
 
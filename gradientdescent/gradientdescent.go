@@ -1,57 +1,71 @@
 package gradientdescent
 
 import (
-	"fmt"
 	"nn/activationfunction"
-	"nn/codec"
+	"nn/checkpoint"
+	"nn/dataset"
 	"nn/feedforward"
-
-	"gonum.org/v1/gonum/mat"
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
-	"gonum.org/v1/plot/vg"
+	"nn/loss"
+	"nn/optimizer"
+	"os"
 )
 
-func Run(numSteps int, layerSizes []int, activationFunctions []*activationfunction.ActivationFunction, genInput func() (*mat.VecDense, *mat.VecDense)) {
-	avgCostRange := 1000
-
-	avgCostPlot := plot.New()
-	avgCostPlot.X.Label.Text = "step"
-	avgCostPlot.Y.Label.Text = "avg cost (last 100 steps)"
-
-	currCostSamples := []float64{}
-	avgCosts := []float64{}
-
-	network := feedforward.NewNetwork(layerSizes, activationFunctions)
-	network.Randomize(-1, 1, -1, 1)
-	for i := 0; i < numSteps; i++ {
-		input, groundTruthOutput := genInput()
+// Validation evaluates the network on a held-out dataset during training
+type Validation struct {
+	Data          dataset.Dataset
+	Every         int            //number of steps between evaluations when training by steps, defaults to 1, training by epochs evaluates after every epoch
+	EarlyStopping *EarlyStopping //nil to always train for the full length
+}
 
-		currCost, _ := network.Learn(input, groundTruthOutput, 0.02)
-		if len(currCostSamples) == avgCostRange {
-			currCostSamples = currCostSamples[1:]
-		}
-		currCostSamples = append(currCostSamples, currCost)
+type EarlyStopping struct {
+	Patience           int     //number of evaluations without improvement before training stops
+	MinDelta           float64 //smallest decrease in validation loss that counts as an improvement
+	RestoreBestWeights bool    //end training with the best network seen instead of the latest one
+}
 
-		currCostSampleSum := float64(0)
-		for _, cost := range currCostSamples {
-			currCostSampleSum += cost
-		}
-		avgCosts = append(avgCosts, currCostSampleSum/float64(len(currCostSamples)))
-		fmt.Printf("Step %v | cost %v\n", i, currCostSampleSum/float64(len(currCostSamples)))
+// Run takes numSteps single-sample steps on randomly drawn samples of data, logging to stdout and writing its results to output/.
+// Checkpoints are saved every checkpoints.Every steps if checkpoints isn't nil. When resumeFrom isn't nil,
+// training continues from it up to numSteps total steps and its optimizer replaces opt.
+func Run(numSteps int, layerSizes []int, activationFunctions []activationfunction.LayerActivationFunction, lossFunction loss.Loss, opt optimizer.Optimizer, data dataset.Dataset, validation *Validation, checkpoints *checkpoint.Manager, resumeFrom *checkpoint.Checkpoint) *feedforward.Network {
+	options := defaultOptions(layerSizes, activationFunctions, lossFunction, opt, validation, checkpoints, resumeFrom)
+	options.NumSteps = numSteps
+	network, _, err := NewTrainer(options).Train(data)
+	if err != nil {
+		panic(err)
 	}
+	return network.(*feedforward.Network)
+}
 
-	avgCostPlotPoints := make(plotter.XYs, numSteps)
-	for i := 0; i < numSteps; i++ {
-		avgCostPlotPoints[i].X = float64(i)
-		avgCostPlotPoints[i].Y = avgCosts[i]
-	}
-	plotutil.AddLinePoints(avgCostPlot, "avg cost", avgCostPlotPoints)
-	if err := avgCostPlot.Save(4*vg.Inch, 4*vg.Inch, "output/cost.png"); err != nil {
+// RunEpochs trains on data, visiting every sample once per epoch in a freshly shuffled order.
+// Gradients are averaged over each batch of batchSize samples. If the dataset size isn't a multiple of batchSize,
+// the smaller last batch is skipped when dropLastBatch is set.
+// Checkpoints are saved every checkpoints.Every epochs, and resumeFrom works as in Run with numEpochs total epochs.
+func RunEpochs(numEpochs, batchSize int, dropLastBatch bool, layerSizes []int, activationFunctions []activationfunction.LayerActivationFunction, lossFunction loss.Loss, opt optimizer.Optimizer, data dataset.Dataset, validation *Validation, checkpoints *checkpoint.Manager, resumeFrom *checkpoint.Checkpoint) *feedforward.Network {
+	options := defaultOptions(layerSizes, activationFunctions, lossFunction, opt, validation, checkpoints, resumeFrom)
+	options.NumEpochs = numEpochs
+	options.BatchSize = batchSize
+	options.DropLastBatch = dropLastBatch
+	network, _, err := NewTrainer(options).Train(data)
+	if err != nil {
 		panic(err)
 	}
+	return network.(*feedforward.Network)
+}
 
-	// render.RenderFeedForward(network, mat.NewVecDense(network.LayerSizes[0], make([]float64, network.LayerSizes[0])), 20, 20, graphviz.PNG, "output/feedforward.png")
-	codec.EncodeNetwork(network, "output/network.json")
+// defaultOptions are the settings Run and RunEpochs have always used
+func defaultOptions(layerSizes []int, activationFunctions []activationfunction.LayerActivationFunction, lossFunction loss.Loss, opt optimizer.Optimizer, validation *Validation, checkpoints *checkpoint.Manager, resumeFrom *checkpoint.Checkpoint) Options {
+	return Options{
+		LayerSizes:          layerSizes,
+		ActivationFunctions: activationFunctions,
+		Loss:                lossFunction,
+		Optimizer:           opt,
+		Validation:          validation,
+		Checkpoints:         checkpoints,
+		ResumeFrom:          resumeFrom,
+		Log:                 os.Stdout,
+		CostPlotPath:        "output/cost.png",
+		NetworkPath:         "output/network.json",
+		BestNetworkPath:     "output/best_network.json",
+		OptimizerPath:       "output/optimizer.json",
+	}
 }
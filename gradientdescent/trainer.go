@@ -0,0 +1,338 @@
+package gradientdescent
+
+import (
+	"fmt"
+	"io"
+	"nn/activationfunction"
+	"nn/callback"
+	"nn/checkpoint"
+	"nn/codec"
+	"nn/dataset"
+	"nn/deepcopy"
+	"nn/feedforward"
+	"nn/layer"
+	"nn/loss"
+	"nn/metrics"
+	"nn/model"
+	"nn/optimizer"
+	"nn/random"
+	"nn/schedule"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Options configures a Trainer. Zero values fall back to the defaults noted on each field,
+// and empty paths mean nothing is written to disk.
+type Options struct {
+	Model               model.Model //if set, it is trained instead of a feedforward network built from the options up to Normalizations
+	LayerSizes          []int
+	ActivationFunctions []activationfunction.LayerActivationFunction
+	Loss                loss.Loss                          //defaults to loss.SquaredError
+	Optimizer           optimizer.Optimizer                //defaults to SGD with a learning rate of 0.02
+	Init                func(network *feedforward.Network) //defaults to uniform weights and biases in [-1, 1], see Network.Initialize for other initializers
+	Regularization      []feedforward.Regularization       //per layer, see feedforward.UniformRegularization
+	DropoutRates        []float64                          //per layer, see feedforward.Network.DropoutRates, nil keeps the rates of ResumeFrom
+	Normalizations      []*feedforward.Normalization       //per layer for a new network, nil entries for none, ResumeFrom keeps its own
+	Autograd            bool                               //compute the feedforward network's gradients with package autograd, see feedforward.Network.Autograd
+	Schedule            schedule.Schedule                  //nil keeps the optimizer's learning rate, schedules that are also callbacks are notified along with Callbacks and checkpointed if callback.Resumable
+
+	NumEpochs     int //if positive, train for this many passes over the data in a shuffled order
+	NumSteps      int //otherwise take this many steps on randomly drawn batches
+	BatchSize     int //defaults to 1
+	DropLastBatch bool
+
+	Validation  *Validation
+	Callbacks   []callback.Callback    //run after early stopping and before progress logging, checkpoints and the cost plot
+	Checkpoints *checkpoint.Manager    //counts epochs when NumEpochs is set and steps otherwise
+	ResumeFrom  *checkpoint.Checkpoint //its optimizer replaces Optimizer
+
+	AvgCostRange    int       //number of steps averaged in the logged cost when training by steps, defaults to 1000
+	Log             io.Writer //progress messages, nil is silent
+	CostPlotPath    string
+	NetworkPath     string
+	BestNetworkPath string //best network on the validation set
+	OptimizerPath   string
+}
+
+type History struct {
+	Costs             []float64 //average cost of every step, or of every epoch when training by epochs
+	ValidationReports []*metrics.Report
+	StoppedEarly      bool
+}
+
+type Trainer struct {
+	options Options
+	log     io.Writer
+}
+
+func NewTrainer(options Options) *Trainer {
+	if options.Loss == nil {
+		options.Loss = loss.SquaredError
+	}
+	if options.Optimizer == nil {
+		options.Optimizer = optimizer.NewSGD(0.02)
+	}
+	if options.Init == nil {
+		options.Init = func(network *feedforward.Network) {
+			network.Randomize(-1, 1, -1, 1)
+		}
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = 1
+	}
+	if options.AvgCostRange == 0 {
+		options.AvgCostRange = 1000
+	}
+	if options.Validation != nil && options.Validation.Every <= 0 {
+		validation := *options.Validation
+		validation.Every = 1
+		options.Validation = &validation
+	}
+	if options.Checkpoints != nil && options.Checkpoints.Every <= 0 {
+		checkpoints := *options.Checkpoints
+		checkpoints.Every = 1
+		options.Checkpoints = &checkpoints
+	}
+	trainer := &Trainer{options: options, log: options.Log}
+	if trainer.log == nil {
+		trainer.log = io.Discard
+	}
+	return trainer
+}
+
+// callbacks builds the built-in callbacks the options ask for around the user's callbacks.
+// Early stopping goes first so every other callback sees its decision, and checkpoints go after the user's callbacks for the same reason.
+func (trainer *Trainer) callbacks() ([]callback.Callback, error) {
+	options := trainer.options
+	callbacks := []callback.Callback{}
+	var earlyStopping *callback.EarlyStopping
+	if options.Validation != nil {
+		earlyStopping = callback.NewEarlyStopping(0, 0, false, options.BestNetworkPath)
+		if options.Validation.EarlyStopping != nil {
+			earlyStopping.Patience = options.Validation.EarlyStopping.Patience
+			earlyStopping.MinDelta = options.Validation.EarlyStopping.MinDelta
+			earlyStopping.RestoreBestWeights = options.Validation.EarlyStopping.RestoreBestWeights
+		}
+		if options.ResumeFrom != nil {
+			if err := earlyStopping.Restore(options.ResumeFrom); err != nil {
+				return nil, err
+			}
+		}
+		callbacks = append(callbacks, earlyStopping)
+	}
+	if scheduleCallback, ok := options.Schedule.(callback.Callback); ok {
+		callbacks = append(callbacks, scheduleCallback)
+	}
+	resumableSchedule, _ := options.Schedule.(callback.Resumable)
+	if resumableSchedule != nil && options.ResumeFrom != nil && options.ResumeFrom.ScheduleState != nil {
+		if err := resumableSchedule.RestoreState(options.ResumeFrom.ScheduleState); err != nil {
+			return nil, err
+		}
+	}
+	callbacks = append(callbacks, options.Callbacks...)
+	callbacks = append(callbacks, &callback.Progress{Writer: trainer.log, AvgCostRange: options.AvgCostRange})
+	if options.Checkpoints != nil {
+		callbacks = append(callbacks, &callback.Checkpoint{Manager: options.Checkpoints, EarlyStopping: earlyStopping, Schedule: resumableSchedule})
+	}
+	if options.CostPlotPath != "" {
+		callbacks = append(callbacks, &callback.Plot{Path: options.CostPlotPath, AvgCostRange: options.AvgCostRange})
+	}
+	return callbacks, nil
+}
+
+// start creates and initializes a new network or takes Model, or restores the network, optimizer and random state of ResumeFrom
+func (trainer *Trainer) start() (model.Model, optimizer.Optimizer, error) {
+	options := trainer.options
+	if options.ResumeFrom == nil {
+		if options.Model != nil {
+			options.Model.SetLoss(options.Loss)
+			return options.Model, options.Optimizer, nil
+		}
+		network := feedforward.NewNetwork(options.LayerSizes, options.ActivationFunctions)
+		options.Init(network)
+		network.Loss = options.Loss
+		network.Regularization = options.Regularization
+		network.DropoutRates = options.DropoutRates
+		network.Normalizations = options.Normalizations
+		network.Autograd = options.Autograd
+		if err := network.Validate(); err != nil {
+			return nil, nil, err
+		}
+		return network, options.Optimizer, nil
+	}
+
+	resumedModel, err := layer.DecodeModel(options.ResumeFrom.Network)
+	if err != nil {
+		return nil, nil, err
+	}
+	resumedModel.SetLoss(options.Loss)
+	if network, ok := resumedModel.(*feedforward.Network); ok {
+		network.Regularization = options.Regularization
+		network.Autograd = options.Autograd
+		if options.DropoutRates != nil {
+			network.DropoutRates = options.DropoutRates
+		}
+		if err := network.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	opt, err := options.ResumeFrom.Optimizer.ToOptimizer()
+	if err != nil {
+		return nil, nil, err
+	}
+	random.SetState(options.ResumeFrom.RandomState)
+	return resumedModel, opt, nil
+}
+
+// learn takes one optimizer step on a batch, updating the learning rate from the schedule first
+func (trainer *Trainer) learn(network model.Model, opt optimizer.Optimizer, step int, inputs, groundTruthOutputs *mat.Dense) float64 {
+	if trainer.options.Schedule != nil {
+		opt.SetLearnRate(trainer.options.Schedule.LearnRate(step))
+	}
+	cost, _ := network.LearnBatch(inputs, groundTruthOutputs, trainer.options.Loss, opt)
+	return cost
+}
+
+// notify calls event on every callback in order and reports whether one of them stopped training or failed
+func notify(callbacks []callback.Callback, state *callback.State, event func(callback.Callback, *callback.State)) bool {
+	for _, currCallback := range callbacks {
+		event(currCallback, state)
+		if state.Err != nil {
+			return true
+		}
+	}
+	return state.Stop
+}
+
+// Train fits a network to data and returns it with its training history
+func (trainer *Trainer) Train(data dataset.Dataset) (model.Model, *History, error) {
+	options := trainer.options
+	if data.Len() == 0 {
+		return nil, nil, fmt.Errorf("no training data")
+	}
+	network, opt, err := trainer.start()
+	if err != nil {
+		return nil, nil, err
+	}
+	callbacks, err := trainer.callbacks()
+	if err != nil {
+		return nil, nil, err
+	}
+	history := &History{}
+	state := &callback.State{Network: network, Optimizer: opt, NumEpochs: options.NumEpochs}
+	firstIteration := 0
+	if options.ResumeFrom != nil {
+		history.Costs = deepcopy.PrimitiveSlice1D(options.ResumeFrom.CostHistory)
+		firstIteration = options.ResumeFrom.Step
+		state.Step = options.ResumeFrom.Step
+		if options.NumEpochs > 0 {
+			firstIteration = options.ResumeFrom.Epoch
+			state.Epoch = options.ResumeFrom.Epoch
+			state.Step = options.ResumeFrom.Epoch*dataset.Batch(data, options.BatchSize, options.DropLastBatch).Len() + options.ResumeFrom.Batch
+		}
+		//the history has a cost for every step, or for every epoch when training by epochs
+		if len(history.Costs) != firstIteration {
+			return nil, nil, fmt.Errorf("checkpoint has %v costs for %v completed iterations", len(history.Costs), firstIteration)
+		}
+	}
+	// evaluate reports on the validation set so the callbacks about to be notified see it
+	evaluate := func() error {
+		report, err := metrics.Evaluate(state.Network, options.Validation.Data, options.Loss)
+		if err != nil {
+			return fmt.Errorf("validation: %w", err)
+		}
+		state.Validation = report
+		history.ValidationReports = append(history.ValidationReports, state.Validation)
+		return nil
+	}
+
+	numIterations := options.NumSteps
+	if options.NumEpochs > 0 {
+		numIterations = options.NumEpochs
+	}
+	for i := firstIteration; i < numIterations; i++ {
+		if options.NumEpochs > 0 {
+			//an epoch stopped partway is finished first, in the order it was shuffled in
+			resumeBatch := i == firstIteration && options.ResumeFrom != nil && options.ResumeFrom.Batch > 0
+			if resumeBatch {
+				random.SetState(options.ResumeFrom.EpochRandomState)
+			}
+			state.EpochRandomState = random.State()
+			batches := dataset.Batch(dataset.Shuffle(data), options.BatchSize, options.DropLastBatch)
+			if batches.Len() == 0 {
+				return nil, nil, fmt.Errorf("batch size %v is larger than the dataset of %v samples and the last batch is dropped", options.BatchSize, data.Len())
+			}
+			state.Batch, state.EpochCost = 0, 0
+			if resumeBatch {
+				random.SetState(options.ResumeFrom.RandomState)
+				state.Batch, state.EpochCost = options.ResumeFrom.Batch, options.ResumeFrom.EpochCost
+			}
+			for stop := false; state.Batch < batches.Len() && !stop; {
+				inputs, groundTruthOutputs := batches.Get(state.Batch)
+				state.Cost = trainer.learn(state.Network, opt, state.Step, inputs, groundTruthOutputs)
+				state.EpochCost += state.Cost
+				state.Step++
+				state.Batch++
+				state.Validation = nil
+				stop = notify(callbacks, state, callback.Callback.OnStepEnd)
+			}
+			if state.Err != nil {
+				return nil, nil, state.Err
+			}
+			if state.Batch < batches.Len() {
+				break //stopped partway, the checkpoint saved on the last step records the position in the epoch
+			}
+			costSum, numBatches := state.EpochCost, state.Batch
+			state.Batch, state.EpochCost = 0, 0
+			state.Epoch++
+			history.Costs = append(history.Costs, costSum/float64(numBatches))
+			state.Cost = history.Costs[len(history.Costs)-1]
+			state.Costs = history.Costs
+			state.Validation = nil
+			if options.Validation != nil {
+				if err := evaluate(); err != nil {
+					return nil, nil, err
+				}
+			}
+			notify(callbacks, state, callback.Callback.OnEpochEnd)
+		} else {
+			inputs, groundTruthOutputs := dataset.RandomBatch(data, options.BatchSize)
+			state.Cost = trainer.learn(state.Network, opt, state.Step, inputs, groundTruthOutputs)
+			state.Step++
+			history.Costs = append(history.Costs, state.Cost)
+			state.Costs = history.Costs
+			state.Validation = nil
+			if options.Validation != nil && (i+1)%options.Validation.Every == 0 {
+				if err := evaluate(); err != nil {
+					return nil, nil, err
+				}
+			}
+			notify(callbacks, state, callback.Callback.OnStepEnd)
+		}
+		if state.Err != nil {
+			return nil, nil, state.Err
+		}
+		if state.Stop {
+			break
+		}
+	}
+	history.StoppedEarly = state.Stop
+	state.Costs = history.Costs
+	notify(callbacks, state, callback.Callback.OnTrainEnd)
+	if state.Err != nil {
+		return nil, nil, state.Err
+	}
+	network = state.Network
+
+	if options.NetworkPath != "" {
+		if err := codec.EncodeModel(network, options.NetworkPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	if options.OptimizerPath != "" {
+		if err := codec.EncodeOptimizer(opt, options.OptimizerPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	return network, history, nil
+}
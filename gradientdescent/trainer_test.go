@@ -0,0 +1,152 @@
+package gradientdescent
+
+import (
+	"math"
+	"nn/activationfunction"
+	"nn/callback"
+	"nn/checkpoint"
+	"nn/dataset"
+	"nn/loss"
+	"nn/optimizer"
+	"nn/random"
+	"nn/schedule"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// newTestData classifies deterministic points by whether their coordinates sum to more than 0
+func newTestData(numSamples int, seed float64) dataset.Dataset {
+	inputs, groundTruths := []*mat.VecDense{}, []*mat.VecDense{}
+	for i := 0; i < numSamples; i++ {
+		input := mat.NewVecDense(2, []float64{math.Sin(seed + float64(3*i)), math.Cos(seed + float64(7*i))})
+		groundTruth := mat.NewVecDense(2, []float64{1, 0})
+		if input.AtVec(0)+input.AtVec(1) > 0 {
+			groundTruth = mat.NewVecDense(2, []float64{0, 1})
+		}
+		inputs = append(inputs, input)
+		groundTruths = append(groundTruths, groundTruth)
+	}
+	return dataset.FromSlices(inputs, groundTruths)
+}
+
+func newTestOptions() Options {
+	return Options{
+		LayerSizes:          []int{2, 5, 2},
+		ActivationFunctions: []activationfunction.LayerActivationFunction{activationfunction.Tanh, activationfunction.Softmax},
+		Loss:                loss.CategoricalCrossEntropy,
+		Optimizer:           optimizer.NewAdam(0.01, 0.9, 0.999),
+		BatchSize:           4,
+	}
+}
+
+func TestNewTrainerDoesNotChangeOptions(t *testing.T) {
+	checkpoints := &checkpoint.Manager{Dir: t.TempDir()}
+	validation := &Validation{Data: dataset.FromSlices(nil, nil)}
+	trainer := NewTrainer(Options{Checkpoints: checkpoints, Validation: validation})
+	if checkpoints.Every != 0 || validation.Every != 0 {
+		t.Errorf("the caller's intervals became %v and %v", checkpoints.Every, validation.Every)
+	}
+	if trainer.options.Checkpoints.Every != 1 || trainer.options.Validation.Every != 1 {
+		t.Errorf("the trainer's intervals are %v and %v, want 1", trainer.options.Checkpoints.Every, trainer.options.Validation.Every)
+	}
+}
+
+func TestResumeRejectsMismatchedCostHistory(t *testing.T) {
+	data := newTestData(20, 0)
+	for name, byEpochs := range map[string]bool{"epochs": true, "steps": false} {
+		dir := t.TempDir()
+		options := newTestOptions()
+		options.Checkpoints = &checkpoint.Manager{Dir: dir}
+		if byEpochs {
+			options.NumEpochs = 2
+		} else {
+			options.NumSteps = 2
+		}
+		if _, _, err := NewTrainer(options).Train(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resumeFrom, err := checkpoint.Load(filepath.Join(dir, "checkpoint-2.json"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		options.NumEpochs *= 2
+		options.NumSteps *= 2
+		options.Checkpoints = nil
+		options.ResumeFrom = resumeFrom
+		if _, _, err := NewTrainer(options).Train(data); err != nil {
+			t.Errorf("%s: resuming failed: %v", name, err)
+		}
+		resumeFrom.CostHistory = resumeFrom.CostHistory[:1]
+		if _, _, err := NewTrainer(options).Train(data); err == nil {
+			t.Errorf("%s: resuming with a cost history shorter than the run didn't fail", name)
+		}
+	}
+}
+
+// stopAtStep stops training once Step steps are done, like an interrupted run
+type stopAtStep struct {
+	callback.Base
+	Step int
+}
+
+func (stop *stopAtStep) OnStepEnd(state *callback.State) {
+	if state.Step == stop.Step {
+		state.Stop = true
+	}
+}
+
+func TestResumeReproducesRun(t *testing.T) {
+	data := newTestData(30, 0)
+	validation := newTestData(10, 100)
+	//8 batches per epoch with a smaller last one, and a learning rate halved after every epoch but the first since no decrease counts as an improvement
+	newOptions := func() Options {
+		options := newTestOptions()
+		options.NumEpochs = 6
+		options.Schedule = schedule.NewReduceOnPlateau(schedule.NewConstant(0.05), 0.5, 1, 1, 0)
+		options.Validation = &Validation{Data: validation, EarlyStopping: &EarlyStopping{Patience: 100, RestoreBestWeights: true}}
+		return options
+	}
+
+	random.Seed(1)
+	uninterrupted, uninterruptedHistory, err := NewTrainer(newOptions()).Train(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random.Seed(1)
+	manager := &checkpoint.Manager{Dir: t.TempDir()}
+	options := newOptions()
+	options.Checkpoints = manager
+	options.Callbacks = []callback.Callback{&stopAtStep{Step: 19}} //partway through the third epoch
+	if _, _, err := NewTrainer(options).Train(data); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := manager.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumeFrom, err := checkpoint.Load(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumeFrom.Epoch != 2 || resumeFrom.Batch != 3 {
+		t.Fatalf("checkpoint is at epoch %v batch %v, want epoch 2 batch 3", resumeFrom.Epoch, resumeFrom.Batch)
+	}
+
+	random.Seed(2)
+	options = newOptions()
+	options.ResumeFrom = resumeFrom
+	resumed, resumedHistory, err := NewTrainer(options).Train(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resumed.Parameters(), uninterrupted.Parameters()) {
+		t.Error("the resumed run ended with different parameters")
+	}
+	if !reflect.DeepEqual(resumedHistory.Costs, uninterruptedHistory.Costs) {
+		t.Errorf("the resumed run's costs are %v, want %v", resumedHistory.Costs, uninterruptedHistory.Costs)
+	}
+}
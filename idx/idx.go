@@ -0,0 +1,256 @@
+package idx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"nn/dataset"
+	"os"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DataType is the third byte of an IDX file's magic number
+type DataType byte
+
+const (
+	UnsignedByte DataType = 0x08
+	SignedByte   DataType = 0x09
+	Short        DataType = 0x0B
+	Int          DataType = 0x0C
+	Float        DataType = 0x0D
+	Double       DataType = 0x0E
+)
+
+var dataTypeSizes = map[DataType]int{UnsignedByte: 1, SignedByte: 1, Short: 2, Int: 4, Float: 4, Double: 8}
+
+// IDX is an n-dimensional array as stored in MNIST-style files. Data is in row-major order.
+type IDX struct {
+	Type       DataType
+	Dimensions []int
+	Data       []float64
+}
+
+// maxDataBytes bounds the data size a header may announce, so a corrupt header can't make Read allocate unbounded memory
+const maxDataBytes = 1 << 30
+
+// dataSize is the number of elements and bytes of data described by dimensions, or an error if it overflows or exceeds maxDataBytes
+func dataSize(dimensions []int, elementSize int) (int, int, error) {
+	elements := 1
+	for _, dimension := range dimensions {
+		if dimension == 0 {
+			return 0, 0, nil
+		}
+		if dimension < 0 || elements > maxDataBytes/elementSize/dimension {
+			return 0, 0, fmt.Errorf("dimensions %v exceed %v bytes of data", dimensions, maxDataBytes)
+		}
+		elements *= dimension
+	}
+	return elements, elements * elementSize, nil
+}
+
+func numElements(dimensions []int) int {
+	result := 1
+	for _, dimension := range dimensions {
+		result *= dimension
+	}
+	return result
+}
+
+func decodeElement(dataType DataType, bytes []byte) float64 {
+	switch dataType {
+	case UnsignedByte:
+		return float64(bytes[0])
+	case SignedByte:
+		return float64(int8(bytes[0]))
+	case Short:
+		return float64(int16(binary.BigEndian.Uint16(bytes)))
+	case Int:
+		return float64(int32(binary.BigEndian.Uint32(bytes)))
+	case Float:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(bytes)))
+	default:
+		return math.Float64frombits(binary.BigEndian.Uint64(bytes))
+	}
+}
+
+func encodeElement(dataType DataType, value float64, bytes []byte) {
+	switch dataType {
+	case UnsignedByte:
+		bytes[0] = byte(value)
+	case SignedByte:
+		bytes[0] = byte(int8(value))
+	case Short:
+		binary.BigEndian.PutUint16(bytes, uint16(int16(value)))
+	case Int:
+		binary.BigEndian.PutUint32(bytes, uint32(int32(value)))
+	case Float:
+		binary.BigEndian.PutUint32(bytes, math.Float32bits(float32(value)))
+	default:
+		binary.BigEndian.PutUint64(bytes, math.Float64bits(value))
+	}
+}
+
+// Read decodes a whole IDX file and fails if the header is invalid or the data is shorter or longer than the header says
+func Read(reader io.Reader) (*IDX, error) {
+	reader = bufio.NewReader(reader)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, fmt.Errorf("reading magic number: %w", err)
+	}
+	if magic[0] != 0 || magic[1] != 0 {
+		return nil, fmt.Errorf("bad magic number %x", magic)
+	}
+	result := &IDX{}
+	result.Type = DataType(magic[2])
+	elementSize, ok := dataTypeSizes[result.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown element type 0x%02x", magic[2])
+	}
+	numDimensions := int(magic[3])
+	if numDimensions == 0 {
+		return nil, errors.New("no dimensions")
+	}
+
+	dimensionBytes := make([]byte, 4*numDimensions)
+	if _, err := io.ReadFull(reader, dimensionBytes); err != nil {
+		return nil, fmt.Errorf("reading dimensions: %w", err)
+	}
+	result.Dimensions = make([]int, numDimensions)
+	for i := 0; i < numDimensions; i++ {
+		result.Dimensions[i] = int(binary.BigEndian.Uint32(dimensionBytes[4*i:]))
+	}
+	for _, dimension := range result.Dimensions[1:] {
+		if dimension == 0 {
+			return nil, fmt.Errorf("items of dimensions %v are empty", result.Dimensions)
+		}
+	}
+
+	elements, size, err := dataSize(result.Dimensions, elementSize)
+	if err != nil {
+		return nil, err
+	}
+	dataBytes := make([]byte, size)
+	if _, err := io.ReadFull(reader, dataBytes); err != nil {
+		return nil, fmt.Errorf("expected %v bytes of data for dimensions %v: %w", len(dataBytes), result.Dimensions, err)
+	}
+	if _, err := reader.Read(make([]byte, 1)); err != io.EOF {
+		return nil, fmt.Errorf("data is longer than dimensions %v", result.Dimensions)
+	}
+	result.Data = make([]float64, elements)
+	for i := 0; i < len(result.Data); i++ {
+		result.Data[i] = decodeElement(result.Type, dataBytes[i*elementSize:(i+1)*elementSize])
+	}
+	return result, nil
+}
+
+func ReadFile(filename string) (*IDX, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+	return result, nil
+}
+
+func Write(writer io.Writer, idx *IDX) error {
+	elementSize, ok := dataTypeSizes[idx.Type]
+	if !ok {
+		return fmt.Errorf("unknown element type 0x%02x", byte(idx.Type))
+	}
+	if len(idx.Dimensions) == 0 || len(idx.Dimensions) > 255 {
+		return fmt.Errorf("cannot store %v dimensions", len(idx.Dimensions))
+	}
+	if numElements(idx.Dimensions) != len(idx.Data) {
+		return fmt.Errorf("%v elements don't fit dimensions %v", len(idx.Data), idx.Dimensions)
+	}
+
+	bytes := make([]byte, 4+4*len(idx.Dimensions)+elementSize*len(idx.Data))
+	bytes[2] = byte(idx.Type)
+	bytes[3] = byte(len(idx.Dimensions))
+	for i, dimension := range idx.Dimensions {
+		binary.BigEndian.PutUint32(bytes[4+4*i:], uint32(dimension))
+	}
+	dataBytes := bytes[4+4*len(idx.Dimensions):]
+	for i, value := range idx.Data {
+		encodeElement(idx.Type, value, dataBytes[i*elementSize:(i+1)*elementSize])
+	}
+	_, err := writer.Write(bytes)
+	return err
+}
+
+func WriteFile(filename string, idx *IDX) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, idx); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ConvertRaw turns a headerless file of unsigned bytes into an IDX file.
+// itemDimensions are the dimensions of a single item (empty for scalars like labels); the number of items comes from the file size.
+func ConvertRaw(rawFilename, idxFilename string, itemDimensions []int) error {
+	result, err := ReadRaw(rawFilename, itemDimensions)
+	if err != nil {
+		return err
+	}
+	return WriteFile(idxFilename, result)
+}
+
+// ReadRaw reads a file of unsigned bytes without a header, as items of itemDimensions one after another
+func ReadRaw(rawFilename string, itemDimensions []int) (*IDX, error) {
+	rawBytes, err := os.ReadFile(rawFilename)
+	if err != nil {
+		return nil, err
+	}
+	for _, dimension := range itemDimensions {
+		if dimension <= 0 {
+			return nil, fmt.Errorf("item dimensions %v must be positive", itemDimensions)
+		}
+	}
+	itemSize := numElements(itemDimensions)
+	if len(rawBytes)%itemSize != 0 {
+		return nil, fmt.Errorf("%v: %v bytes is not a whole number of %v byte items", rawFilename, len(rawBytes), itemSize)
+	}
+	result := &IDX{Type: UnsignedByte}
+	result.Dimensions = append([]int{len(rawBytes) / itemSize}, itemDimensions...)
+	result.Data = make([]float64, len(rawBytes))
+	for i, rawByte := range rawBytes {
+		result.Data[i] = float64(rawByte)
+	}
+	return result, nil
+}
+
+// ToDataset pairs every item of inputs (flattened) with the one-hot encoding of the matching label
+func ToDataset(inputs, labels *IDX, numClasses int) (dataset.Dataset, error) {
+	if len(labels.Dimensions) != 1 {
+		return nil, fmt.Errorf("labels should have 1 dimension, got %v", labels.Dimensions)
+	}
+	if inputs.Dimensions[0] != labels.Dimensions[0] {
+		return nil, fmt.Errorf("%v inputs but %v labels", inputs.Dimensions[0], labels.Dimensions[0])
+	}
+	inputSize := numElements(inputs.Dimensions[1:])
+	inputVecs := make([]*mat.VecDense, inputs.Dimensions[0])
+	groundTruths := make([]*mat.VecDense, inputs.Dimensions[0])
+	for i := 0; i < inputs.Dimensions[0]; i++ {
+		label := int(labels.Data[i])
+		if label < 0 || label >= numClasses {
+			return nil, fmt.Errorf("label %v of item %v is not in [0, %v)", label, i, numClasses)
+		}
+		inputVecs[i] = mat.NewVecDense(inputSize, inputs.Data[i*inputSize:(i+1)*inputSize])
+		groundTruths[i] = mat.NewVecDense(numClasses, nil)
+		groundTruths[i].SetVec(label, 1)
+	}
+	return dataset.FromSlices(inputVecs, groundTruths), nil
+}
@@ -0,0 +1,81 @@
+package idx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	for _, dataType := range []DataType{UnsignedByte, SignedByte, Short, Int, Float, Double} {
+		original := &IDX{Type: dataType, Dimensions: []int{2, 3}, Data: []float64{0, 1, 2, 3, 4, 5}}
+		var buffer bytes.Buffer
+		if err := Write(&buffer, original); err != nil {
+			t.Fatal(err)
+		}
+		read, err := Read(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, original) {
+			t.Errorf("type 0x%02x: read %v, wrote %v", byte(dataType), read, original)
+		}
+	}
+}
+
+func TestReadMalformedHeaders(t *testing.T) {
+	headers := map[string][]byte{
+		"empty":              {},
+		"bad magic":          {1, 0, 8, 1, 0, 0, 0, 0},
+		"unknown type":       {0, 0, 7, 1, 0, 0, 0, 0},
+		"no dimensions":      {0, 0, 8, 0},
+		"short dimensions":   {0, 0, 8, 2, 0, 0, 0, 1},
+		"overflowing size":   {0, 0, 8, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"oversized data":     {0, 0, 0x0E, 1, 0x7f, 0xff, 0xff, 0xff},
+		"short data":         {0, 0, 8, 1, 0, 0, 0, 2, 1},
+		"long data":          {0, 0, 8, 1, 0, 0, 0, 1, 1, 2},
+		"huge 3d dimensions": {0, 0, 8, 3, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0},
+		"empty items":        {0, 0, 8, 2, 0, 0, 0, 2, 0, 0, 0, 0},
+	}
+	for name, header := range headers {
+		if _, err := Read(bytes.NewReader(header)); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestConvertRaw(t *testing.T) {
+	directory := t.TempDir()
+	rawFilename := filepath.Join(directory, "raw")
+	idxFilename := filepath.Join(directory, "idx")
+	if err := os.WriteFile(rawFilename, []byte{1, 2, 3, 4, 5, 6}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, itemDimensions := range [][]int{{0}, {3, 0}, {-2}} {
+		if err := ConvertRaw(rawFilename, idxFilename, itemDimensions); err == nil {
+			t.Errorf("item dimensions %v: expected an error", itemDimensions)
+		}
+	}
+	if err := ConvertRaw(rawFilename, idxFilename, []int{3}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ReadFile(idxFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Dimensions, []int{2, 3}) {
+		t.Errorf("dimensions %v, expected [2 3]", result.Dimensions)
+	}
+}
+
+func TestReadNoItems(t *testing.T) {
+	read, err := Read(bytes.NewReader([]byte{0, 0, 8, 2, 0, 0, 0, 0, 0, 0, 0, 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Dimensions, []int{0, 3}) || len(read.Data) != 0 {
+		t.Errorf("read %v", read)
+	}
+}
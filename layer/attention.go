@@ -0,0 +1,471 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/optimizer"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PositionalEncoding adds the sinusoidal encoding of each step's position to it, so attention can tell steps apart.
+// Samples are sequences of steps of ModelSize values, of any length.
+type PositionalEncoding struct {
+	ModelSize int
+}
+
+type jsonPositionalEncoding struct {
+	ModelSize int
+}
+
+func NewPositionalEncoding(modelSize int) *PositionalEncoding {
+	return &PositionalEncoding{ModelSize: modelSize}
+}
+
+// Encoding is the value added to dimension i of step t
+func (positionalEncoding *PositionalEncoding) Encoding(t, i int) float64 {
+	angle := float64(t) / math.Pow(10000, float64(i-i%2)/float64(positionalEncoding.ModelSize))
+	if i%2 == 0 {
+		return math.Sin(angle)
+	}
+	return math.Cos(angle)
+}
+
+func (positionalEncoding *PositionalEncoding) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	_, numValues := inputs.Dims()
+	if numValues%positionalEncoding.ModelSize != 0 {
+		panic(fmt.Sprintf("samples of %v values can't be split into steps of %v", numValues, positionalEncoding.ModelSize))
+	}
+	result := &mat.Dense{}
+	result.Apply(func(_, j int, value float64) float64 {
+		return value + positionalEncoding.Encoding(j/positionalEncoding.ModelSize, j%positionalEncoding.ModelSize)
+	}, inputs)
+	return result
+}
+
+func (positionalEncoding *PositionalEncoding) Backward(grad *mat.Dense) *mat.Dense {
+	return grad
+}
+
+func (positionalEncoding *PositionalEncoding) Params() [][]float64 {
+	return nil
+}
+
+func (positionalEncoding *PositionalEncoding) Grads() [][]float64 {
+	return nil
+}
+
+func (positionalEncoding *PositionalEncoding) Serialize() (*JSONLayer, error) {
+	return serialize("positionalEncoding", jsonPositionalEncoding{ModelSize: positionalEncoding.ModelSize})
+}
+
+// MultiHeadAttention is scaled dot-product self-attention over the steps of each sample.
+// Queries, keys and values are projections of the steps split into NumHeads heads of ModelSize / NumHeads values,
+// and the heads' outputs are concatenated and projected back to ModelSize.
+type MultiHeadAttention struct {
+	ModelSize int
+	NumHeads  int
+	Causal    bool //if set, steps only attend to themselves and earlier steps
+
+	QueryWeights  *mat.Dense //ModelSize x ModelSize
+	QueryBiases   *mat.VecDense
+	KeyWeights    *mat.Dense
+	KeyBiases     *mat.VecDense
+	ValueWeights  *mat.Dense
+	ValueBiases   *mat.VecDense
+	OutputWeights *mat.Dense
+	OutputBiases  *mat.VecDense
+
+	//of the last Forward, with the steps of every sample as rows
+	inputs           *mat.Dense
+	queries          *mat.Dense
+	keys             *mat.Dense
+	values           *mat.Dense
+	attentionWeights []*mat.Dense //numSteps x numSteps for each sample and head
+	concatenated     *mat.Dense
+	gradients        [][]float64
+}
+
+type jsonMultiHeadAttention struct {
+	ModelSize     int
+	NumHeads      int
+	Causal        bool
+	QueryWeights  [][]float64
+	QueryBiases   []float64
+	KeyWeights    [][]float64
+	KeyBiases     []float64
+	ValueWeights  [][]float64
+	ValueBiases   []float64
+	OutputWeights [][]float64
+	OutputBiases  []float64
+}
+
+func NewMultiHeadAttention(modelSize, numHeads int, causal bool) *MultiHeadAttention {
+	if modelSize%numHeads != 0 {
+		panic(fmt.Sprintf("model size %v is not divisible by %v heads", modelSize, numHeads))
+	}
+	return &MultiHeadAttention{
+		ModelSize:     modelSize,
+		NumHeads:      numHeads,
+		Causal:        causal,
+		QueryWeights:  mat.NewDense(modelSize, modelSize, nil),
+		QueryBiases:   mat.NewVecDense(modelSize, nil),
+		KeyWeights:    mat.NewDense(modelSize, modelSize, nil),
+		KeyBiases:     mat.NewVecDense(modelSize, nil),
+		ValueWeights:  mat.NewDense(modelSize, modelSize, nil),
+		ValueBiases:   mat.NewVecDense(modelSize, nil),
+		OutputWeights: mat.NewDense(modelSize, modelSize, nil),
+		OutputBiases:  mat.NewVecDense(modelSize, nil),
+	}
+}
+
+func (attention *MultiHeadAttention) projections() []*mat.Dense {
+	return []*mat.Dense{attention.QueryWeights, attention.KeyWeights, attention.ValueWeights, attention.OutputWeights}
+}
+
+func (attention *MultiHeadAttention) biases() []*mat.VecDense {
+	return []*mat.VecDense{attention.QueryBiases, attention.KeyBiases, attention.ValueBiases, attention.OutputBiases}
+}
+
+func (attention *MultiHeadAttention) Initialize(weightInitializer, biasInitializer feedforward.Initializer) {
+	for i, weights := range attention.projections() {
+		weightInitializer.Init(weights, attention.ModelSize, attention.ModelSize)
+		biasInitializer.Init(mat.NewDense(attention.ModelSize, 1, attention.biases()[i].RawVector().Data), attention.ModelSize, attention.ModelSize)
+	}
+}
+
+func (attention *MultiHeadAttention) headSize() int {
+	return attention.ModelSize / attention.NumHeads
+}
+
+// head is the part of matrix (steps of every sample x ModelSize) for one sample and head
+func (attention *MultiHeadAttention) head(matrix *mat.Dense, sample, head, numSteps int) *mat.Dense {
+	headSize := attention.headSize()
+	return matrix.Slice(sample*numSteps, (sample+1)*numSteps, head*headSize, (head+1)*headSize).(*mat.Dense)
+}
+
+func (attention *MultiHeadAttention) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, numValues := inputs.Dims()
+	if numValues%attention.ModelSize != 0 {
+		panic(fmt.Sprintf("samples of %v values can't be split into steps of %v", numValues, attention.ModelSize))
+	}
+	numSteps := numValues / attention.ModelSize
+	attention.inputs = reshape(inputs, numSamples*numSteps)
+	attention.queries = affine(attention.inputs, attention.QueryWeights, attention.QueryBiases)
+	attention.keys = affine(attention.inputs, attention.KeyWeights, attention.KeyBiases)
+	attention.values = affine(attention.inputs, attention.ValueWeights, attention.ValueBiases)
+	attention.concatenated = mat.NewDense(numSamples*numSteps, attention.ModelSize, nil)
+	attention.attentionWeights = make([]*mat.Dense, numSamples*attention.NumHeads)
+	scale := 1 / math.Sqrt(float64(attention.headSize()))
+	for sample := 0; sample < numSamples; sample++ {
+		for head := 0; head < attention.NumHeads; head++ {
+			weights := &mat.Dense{}
+			weights.Mul(attention.head(attention.queries, sample, head, numSteps), attention.head(attention.keys, sample, head, numSteps).T())
+			for t := 0; t < numSteps; t++ {
+				row := weights.RawRowView(t)
+				max := math.Inf(-1)
+				for u := range row {
+					if attention.Causal && u > t {
+						continue
+					}
+					row[u] *= scale
+					max = math.Max(max, row[u])
+				}
+				sum := float64(0)
+				for u := range row {
+					if attention.Causal && u > t {
+						row[u] = 0
+						continue
+					}
+					row[u] = math.Exp(row[u] - max)
+					sum += row[u]
+				}
+				for u := range row {
+					row[u] /= sum
+				}
+			}
+			attention.attentionWeights[sample*attention.NumHeads+head] = weights
+			attention.head(attention.concatenated, sample, head, numSteps).Mul(weights, attention.head(attention.values, sample, head, numSteps))
+		}
+	}
+	return reshape(affine(attention.concatenated, attention.OutputWeights, attention.OutputBiases), numSamples)
+}
+
+func (attention *MultiHeadAttention) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	numRows, _ := attention.inputs.Dims()
+	numSteps := numRows / numSamples
+	outputGradient := reshape(grad, numRows)
+	concatenatedGradient := &mat.Dense{}
+	concatenatedGradient.Mul(outputGradient, attention.OutputWeights)
+
+	queriesGradient := mat.NewDense(numRows, attention.ModelSize, nil)
+	keysGradient := mat.NewDense(numRows, attention.ModelSize, nil)
+	valuesGradient := mat.NewDense(numRows, attention.ModelSize, nil)
+	scale := 1 / math.Sqrt(float64(attention.headSize()))
+	for sample := 0; sample < numSamples; sample++ {
+		for head := 0; head < attention.NumHeads; head++ {
+			weights := attention.attentionWeights[sample*attention.NumHeads+head]
+			headGradient := attention.head(concatenatedGradient, sample, head, numSteps)
+			attention.head(valuesGradient, sample, head, numSteps).Mul(weights.T(), headGradient)
+			//through the softmax of each row, scores' gradients are weights * (weightsGradient - sum(weightsGradient * weights))
+			scoresGradient := &mat.Dense{}
+			scoresGradient.Mul(headGradient, attention.head(attention.values, sample, head, numSteps).T())
+			for t := 0; t < numSteps; t++ {
+				row := scoresGradient.RawRowView(t)
+				weightsRow := weights.RawRowView(t)
+				dot := float64(0)
+				for u := range row {
+					dot += row[u] * weightsRow[u]
+				}
+				for u := range row {
+					row[u] = weightsRow[u] * (row[u] - dot) * scale
+				}
+			}
+			attention.head(queriesGradient, sample, head, numSteps).Mul(scoresGradient, attention.head(attention.keys, sample, head, numSteps))
+			attention.head(keysGradient, sample, head, numSteps).Mul(scoresGradient.T(), attention.head(attention.queries, sample, head, numSteps))
+		}
+	}
+
+	attention.gradients = nil
+	result := mat.NewDense(numRows, attention.ModelSize, nil)
+	for i, projectionGradient := range []*mat.Dense{queriesGradient, keysGradient, valuesGradient} {
+		weightGradient := &mat.Dense{}
+		weightGradient.Mul(projectionGradient.T(), attention.inputs)
+		weightGradient.Scale(1/float64(numSamples), weightGradient)
+		attention.gradients = append(attention.gradients, weightGradient.RawMatrix().Data, sumRows(projectionGradient, float64(numSamples)).RawVector().Data)
+		inputGradient := &mat.Dense{}
+		inputGradient.Mul(projectionGradient, attention.projections()[i])
+		result.Add(result, inputGradient)
+	}
+	weightGradient := &mat.Dense{}
+	weightGradient.Mul(outputGradient.T(), attention.concatenated)
+	weightGradient.Scale(1/float64(numSamples), weightGradient)
+	attention.gradients = append(attention.gradients, weightGradient.RawMatrix().Data, sumRows(outputGradient, float64(numSamples)).RawVector().Data)
+	return reshape(result, numSamples)
+}
+
+func (attention *MultiHeadAttention) Params() [][]float64 {
+	params := [][]float64{}
+	for i, weights := range attention.projections() {
+		params = append(params, weights.RawMatrix().Data, attention.biases()[i].RawVector().Data)
+	}
+	return params
+}
+
+func (attention *MultiHeadAttention) Grads() [][]float64 {
+	return attention.gradients
+}
+
+func (attention *MultiHeadAttention) Serialize() (*JSONLayer, error) {
+	return serialize("multiHeadAttention", jsonMultiHeadAttention{
+		ModelSize:     attention.ModelSize,
+		NumHeads:      attention.NumHeads,
+		Causal:        attention.Causal,
+		QueryWeights:  rows(attention.QueryWeights),
+		QueryBiases:   rawOrNil(attention.QueryBiases),
+		KeyWeights:    rows(attention.KeyWeights),
+		KeyBiases:     rawOrNil(attention.KeyBiases),
+		ValueWeights:  rows(attention.ValueWeights),
+		ValueBiases:   rawOrNil(attention.ValueBiases),
+		OutputWeights: rows(attention.OutputWeights),
+		OutputBiases:  rawOrNil(attention.OutputBiases),
+	})
+}
+
+func decodeMultiHeadAttention(data *jsonMultiHeadAttention) (Layer, error) {
+	if data.ModelSize < 1 || data.NumHeads < 1 || data.ModelSize%data.NumHeads != 0 {
+		return nil, fmt.Errorf("model size %v can't be split into %v heads", data.ModelSize, data.NumHeads)
+	}
+	attention := NewMultiHeadAttention(data.ModelSize, data.NumHeads, data.Causal)
+	weights := [][][]float64{data.QueryWeights, data.KeyWeights, data.ValueWeights, data.OutputWeights}
+	biases := [][]float64{data.QueryBiases, data.KeyBiases, data.ValueBiases, data.OutputBiases}
+	for i, projection := range attention.projections() {
+		if err := setRows(projection, weights[i]); err != nil {
+			return nil, err
+		}
+		if len(biases[i]) != data.ModelSize {
+			return nil, fmt.Errorf("expected %v biases, got %v", data.ModelSize, len(biases[i]))
+		}
+		attention.biases()[i].SetRawVector(mat.NewVecDense(data.ModelSize, biases[i]).RawVector())
+	}
+	return attention, nil
+}
+
+// TransformerEncoder is a post-norm transformer encoder block: self-attention and a two layer feedforward network
+// applied to each step, each followed by a residual connection and a layer normalization of each step
+type TransformerEncoder struct {
+	Attention       *MultiHeadAttention
+	AttentionNorm   *Normalization
+	Hidden          *Dense //ModelSize -> hidden size with ReLU
+	Output          *Dense //hidden size -> ModelSize
+	FeedForwardNorm *Normalization
+
+	steps []*TimeDistributed //AttentionNorm, Hidden, Output and FeedForwardNorm applied to each step
+}
+
+type jsonTransformerEncoder struct {
+	Attention       *JSONLayer
+	AttentionNorm   *JSONLayer
+	Hidden          *JSONLayer
+	Output          *JSONLayer
+	FeedForwardNorm *JSONLayer
+}
+
+func newTransformerEncoder(attention *MultiHeadAttention, attentionNorm *Normalization, hidden, output *Dense, feedForwardNorm *Normalization) *TransformerEncoder {
+	_, hiddenSize := output.Weights.Dims()
+	return &TransformerEncoder{
+		Attention:       attention,
+		AttentionNorm:   attentionNorm,
+		Hidden:          hidden,
+		Output:          output,
+		FeedForwardNorm: feedForwardNorm,
+		steps: []*TimeDistributed{
+			NewTimeDistributed(attentionNorm, attention.ModelSize),
+			NewTimeDistributed(hidden, attention.ModelSize),
+			NewTimeDistributed(output, hiddenSize),
+			NewTimeDistributed(feedForwardNorm, attention.ModelSize),
+		},
+	}
+}
+
+func NewTransformerEncoder(modelSize, numHeads, hiddenSize int, causal bool) *TransformerEncoder {
+	return newTransformerEncoder(
+		NewMultiHeadAttention(modelSize, numHeads, causal),
+		NewLayerNorm(modelSize),
+		NewDense(modelSize, hiddenSize, activationfunction.ReLU),
+		NewDense(hiddenSize, modelSize, activationfunction.Identity),
+		NewLayerNorm(modelSize),
+	)
+}
+
+func (encoder *TransformerEncoder) Initialize(weightInitializer, biasInitializer feedforward.Initializer) {
+	encoder.Attention.Initialize(weightInitializer, biasInitializer)
+	encoder.Hidden.Initialize(weightInitializer, biasInitializer)
+	encoder.Output.Initialize(weightInitializer, biasInitializer)
+}
+
+func (encoder *TransformerEncoder) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	attended := encoder.Attention.Forward(inputs, training)
+	attended.Add(attended, inputs)
+	normalized := encoder.steps[0].Forward(attended, training)
+	transformed := encoder.steps[2].Forward(encoder.steps[1].Forward(normalized, training), training)
+	transformed.Add(transformed, normalized)
+	return encoder.steps[3].Forward(transformed, training)
+}
+
+func (encoder *TransformerEncoder) Backward(grad *mat.Dense) *mat.Dense {
+	grad = encoder.steps[3].Backward(grad)
+	normalizedGrad := encoder.steps[1].Backward(encoder.steps[2].Backward(grad))
+	normalizedGrad.Add(normalizedGrad, grad)
+	grad = encoder.steps[0].Backward(normalizedGrad)
+	result := encoder.Attention.Backward(grad)
+	result.Add(result, grad)
+	return result
+}
+
+func (encoder *TransformerEncoder) layers() []Layer {
+	return []Layer{encoder.Attention, encoder.AttentionNorm, encoder.Hidden, encoder.Output, encoder.FeedForwardNorm}
+}
+
+func (encoder *TransformerEncoder) Params() [][]float64 {
+	params := [][]float64{}
+	for _, currLayer := range encoder.layers() {
+		params = append(params, currLayer.Params()...)
+	}
+	return params
+}
+
+func (encoder *TransformerEncoder) Grads() [][]float64 {
+	grads := [][]float64{}
+	for _, currLayer := range encoder.layers() {
+		grads = append(grads, currLayer.Grads()...)
+	}
+	return grads
+}
+
+func (encoder *TransformerEncoder) SparseGrads() []*optimizer.SparseGradient {
+	result := []*optimizer.SparseGradient{}
+	for _, currLayer := range encoder.layers() {
+		result = append(result, sparseGrads(currLayer)...)
+	}
+	return result
+}
+
+func (encoder *TransformerEncoder) Serialize() (*JSONLayer, error) {
+	jsonLayers := make([]*JSONLayer, len(encoder.layers()))
+	for i, currLayer := range encoder.layers() {
+		jsonLayer, err := currLayer.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		jsonLayers[i] = jsonLayer
+	}
+	return serialize("transformerEncoder", jsonTransformerEncoder{
+		Attention:       jsonLayers[0],
+		AttentionNorm:   jsonLayers[1],
+		Hidden:          jsonLayers[2],
+		Output:          jsonLayers[3],
+		FeedForwardNorm: jsonLayers[4],
+	})
+}
+
+// decodeAs decodes jsonLayer and checks that it is a T
+func decodeAs[T Layer](jsonLayer *JSONLayer) (T, error) {
+	var result T
+	if jsonLayer == nil {
+		return result, fmt.Errorf("missing %T", result)
+	}
+	currLayer, err := jsonLayer.ToLayer()
+	if err != nil {
+		return result, err
+	}
+	result, ok := currLayer.(T)
+	if !ok {
+		return result, fmt.Errorf("expected %T, got %T", result, currLayer)
+	}
+	return result, nil
+}
+
+func decodeTransformerEncoder(data *jsonTransformerEncoder) (Layer, error) {
+	attention, err := decodeAs[*MultiHeadAttention](data.Attention)
+	if err != nil {
+		return nil, err
+	}
+	attentionNorm, err := decodeAs[*Normalization](data.AttentionNorm)
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := decodeAs[*Dense](data.Hidden)
+	if err != nil {
+		return nil, err
+	}
+	output, err := decodeAs[*Dense](data.Output)
+	if err != nil {
+		return nil, err
+	}
+	feedForwardNorm, err := decodeAs[*Normalization](data.FeedForwardNorm)
+	if err != nil {
+		return nil, err
+	}
+	_, hiddenSize := output.Weights.Dims()
+	hiddenOutputs, hiddenInputs := hidden.Weights.Dims()
+	if hiddenInputs != attention.ModelSize || hiddenOutputs != hiddenSize || output.Biases.Len() != attention.ModelSize ||
+		attentionNorm.Gamma.Len() != attention.ModelSize || feedForwardNorm.Gamma.Len() != attention.ModelSize {
+		return nil, fmt.Errorf("transformer encoder layers don't fit a model size of %v", attention.ModelSize)
+	}
+	return newTransformerEncoder(attention, attentionNorm, hidden, output, feedForwardNorm), nil
+}
+
+func init() {
+	Register("positionalEncoding", decodeInto(func(data *jsonPositionalEncoding) (Layer, error) {
+		if data.ModelSize < 1 {
+			return nil, fmt.Errorf("positional encoding needs a positive model size")
+		}
+		return NewPositionalEncoding(data.ModelSize), nil
+	}))
+	Register("multiHeadAttention", decodeInto(decodeMultiHeadAttention))
+	Register("transformerEncoder", decodeInto(decodeTransformerEncoder))
+}
@@ -0,0 +1,32 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"testing"
+)
+
+func TestTransformerEncoderGradients(t *testing.T) {
+	const numSteps, modelSize, numHeads = 5, 4, 2
+	for _, causal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("causal=%v", causal), func(t *testing.T) {
+			attention := NewMultiHeadAttention(modelSize, numHeads, causal)
+			attention.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+			encoder := NewTransformerEncoder(modelSize, numHeads, 6, causal)
+			encoder.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+			//move the layer norm off its identity initialization so its gradients are exercised too
+			for _, param := range encoder.AttentionNorm.Params() {
+				for i := range param {
+					param[i] += 0.1 * math.Sin(float64(i))
+				}
+			}
+			dense := NewDense(modelSize, 3, activationfunction.Tanh)
+			dense.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+			sequential := NewSequential(NewPositionalEncoding(modelSize), attention, encoder, NewTimeDistributed(dense, modelSize))
+			checkGradients(t, sequential, sinMatrix(3, numSteps*modelSize, 0), sinMatrix(3, numSteps*3, 1), loss.SquaredError, true)
+		})
+	}
+}
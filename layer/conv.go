@@ -0,0 +1,533 @@
+package layer
+
+import (
+	"fmt"
+	"nn/feedforward"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Shape is the shape of an image, whose values are laid out channel by channel and row by row in a sample
+type Shape struct {
+	Channels int
+	Height   int
+	Width    int
+}
+
+func (shape Shape) Size() int {
+	return shape.Channels * shape.Height * shape.Width
+}
+
+func (shape Shape) index(channel, y, x int) int {
+	return (channel*shape.Height+y)*shape.Width + x
+}
+
+// Conv2D slides NumFilters kernels of KernelHeight x KernelWidth x Input.Channels over the image, Stride values at a time,
+// after padding every side of the image with Padding zeros
+type Conv2D struct {
+	Input        Shape
+	NumFilters   int
+	KernelHeight int
+	KernelWidth  int
+	Stride       int
+	Padding      int
+	Kernels      *mat.Dense //NumFilters x (Input.Channels * KernelHeight * KernelWidth)
+	Biases       *mat.VecDense
+
+	columns        []*mat.Dense //per sample of the last Forward, the image patch under each output position
+	kernelGradient *mat.Dense
+	biasGradient   *mat.VecDense
+}
+
+type jsonConv2D struct {
+	Input        Shape
+	NumFilters   int
+	KernelHeight int
+	KernelWidth  int
+	Stride       int
+	Padding      int
+	Kernels      [][]float64
+	Biases       []float64
+}
+
+func NewConv2D(input Shape, numFilters, kernelHeight, kernelWidth, stride, padding int) *Conv2D {
+	return &Conv2D{
+		Input:        input,
+		NumFilters:   numFilters,
+		KernelHeight: kernelHeight,
+		KernelWidth:  kernelWidth,
+		Stride:       stride,
+		Padding:      padding,
+		Kernels:      mat.NewDense(numFilters, input.Channels*kernelHeight*kernelWidth, nil),
+		Biases:       mat.NewVecDense(numFilters, nil),
+	}
+}
+
+func (conv *Conv2D) Output() Shape {
+	return Shape{
+		Channels: conv.NumFilters,
+		Height:   (conv.Input.Height+2*conv.Padding-conv.KernelHeight)/conv.Stride + 1,
+		Width:    (conv.Input.Width+2*conv.Padding-conv.KernelWidth)/conv.Stride + 1,
+	}
+}
+
+// Initialize fills the kernels and biases, with a fan-in of one kernel's size and a fan-out of NumFilters kernel positions
+func (conv *Conv2D) Initialize(weightInitializer, biasInitializer feedforward.Initializer) {
+	kernelArea := conv.KernelHeight * conv.KernelWidth
+	weightInitializer.Init(conv.Kernels, conv.Input.Channels*kernelArea, conv.NumFilters*kernelArea)
+	biasInitializer.Init(mat.NewDense(conv.NumFilters, 1, conv.Biases.RawVector().Data), conv.Input.Channels*kernelArea, conv.NumFilters*kernelArea)
+}
+
+// patchIndex returns where the kernel value (channel, ky, kx) lands in the input when the kernel is at output position (y, x), or -1 in the padding
+func (conv *Conv2D) patchIndex(y, x, channel, ky, kx int) int {
+	inputY := y*conv.Stride - conv.Padding + ky
+	inputX := x*conv.Stride - conv.Padding + kx
+	if inputY < 0 || inputY >= conv.Input.Height || inputX < 0 || inputX >= conv.Input.Width {
+		return -1
+	}
+	return conv.Input.index(channel, inputY, inputX)
+}
+
+// forEachPatchValue calls f with the row and column of every value of the columns matrix and the input index it comes from
+func (conv *Conv2D) forEachPatchValue(f func(row, col, inputIndex int)) {
+	output := conv.Output()
+	for y := 0; y < output.Height; y++ {
+		for x := 0; x < output.Width; x++ {
+			col := 0
+			for channel := 0; channel < conv.Input.Channels; channel++ {
+				for ky := 0; ky < conv.KernelHeight; ky++ {
+					for kx := 0; kx < conv.KernelWidth; kx++ {
+						f(y*output.Width+x, col, conv.patchIndex(y, x, channel, ky, kx))
+						col++
+					}
+				}
+			}
+		}
+	}
+}
+
+func (conv *Conv2D) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	output := conv.Output()
+	numPositions := output.Height * output.Width
+	result := mat.NewDense(numSamples, output.Size(), nil)
+	conv.columns = make([]*mat.Dense, numSamples)
+	products := mat.NewDense(numPositions, conv.NumFilters, nil)
+	for i := 0; i < numSamples; i++ {
+		input := inputs.RawRowView(i)
+		columns := mat.NewDense(numPositions, conv.Input.Channels*conv.KernelHeight*conv.KernelWidth, nil)
+		conv.forEachPatchValue(func(row, col, inputIndex int) {
+			if inputIndex >= 0 {
+				columns.Set(row, col, input[inputIndex])
+			}
+		})
+		conv.columns[i] = columns
+
+		products.Mul(columns, conv.Kernels.T())
+		row := result.RawRowView(i)
+		for filter := 0; filter < conv.NumFilters; filter++ {
+			for position := 0; position < numPositions; position++ {
+				row[filter*numPositions+position] = products.At(position, filter) + conv.Biases.AtVec(filter)
+			}
+		}
+	}
+	return result
+}
+
+func (conv *Conv2D) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	output := conv.Output()
+	numPositions := output.Height * output.Width
+	conv.kernelGradient = mat.NewDense(conv.NumFilters, conv.Input.Channels*conv.KernelHeight*conv.KernelWidth, nil)
+	conv.biasGradient = mat.NewVecDense(conv.NumFilters, nil)
+	result := mat.NewDense(numSamples, conv.Input.Size(), nil)
+	kernelGradient := &mat.Dense{}
+	columnsGradient := &mat.Dense{}
+	for i := 0; i < numSamples; i++ {
+		//numPositions x NumFilters, like the products in Forward
+		outputGradient := mat.NewDense(numPositions, conv.NumFilters, nil)
+		row := grad.RawRowView(i)
+		for filter := 0; filter < conv.NumFilters; filter++ {
+			for position := 0; position < numPositions; position++ {
+				outputGradient.Set(position, filter, row[filter*numPositions+position])
+				conv.biasGradient.SetVec(filter, conv.biasGradient.AtVec(filter)+row[filter*numPositions+position])
+			}
+		}
+		kernelGradient.Mul(outputGradient.T(), conv.columns[i])
+		conv.kernelGradient.Add(conv.kernelGradient, kernelGradient)
+
+		columnsGradient.Mul(outputGradient, conv.Kernels)
+		inputGradient := result.RawRowView(i)
+		conv.forEachPatchValue(func(row, col, inputIndex int) {
+			if inputIndex >= 0 {
+				inputGradient[inputIndex] += columnsGradient.At(row, col)
+			}
+		})
+	}
+	conv.kernelGradient.Scale(1/float64(numSamples), conv.kernelGradient)
+	conv.biasGradient.ScaleVec(1/float64(numSamples), conv.biasGradient)
+	return result
+}
+
+func (conv *Conv2D) Params() [][]float64 {
+	return [][]float64{conv.Kernels.RawMatrix().Data, conv.Biases.RawVector().Data}
+}
+
+func (conv *Conv2D) Grads() [][]float64 {
+	return [][]float64{conv.kernelGradient.RawMatrix().Data, conv.biasGradient.RawVector().Data}
+}
+
+func (conv *Conv2D) Serialize() (*JSONLayer, error) {
+	data := jsonConv2D{Input: conv.Input, NumFilters: conv.NumFilters, KernelHeight: conv.KernelHeight, KernelWidth: conv.KernelWidth, Stride: conv.Stride, Padding: conv.Padding, Kernels: make([][]float64, conv.NumFilters), Biases: mat.Col(nil, 0, conv.Biases)}
+	for i := 0; i < conv.NumFilters; i++ {
+		data.Kernels[i] = mat.Row(nil, i, conv.Kernels)
+	}
+	return serialize("conv2D", data)
+}
+
+func decodeConv2D(data *jsonConv2D) (Layer, error) {
+	if data.Stride < 1 || data.KernelHeight < 1 || data.KernelWidth < 1 {
+		return nil, fmt.Errorf("conv2D layer needs a positive stride and kernel size")
+	}
+	conv := NewConv2D(data.Input, data.NumFilters, data.KernelHeight, data.KernelWidth, data.Stride, data.Padding)
+	_, kernelSize := conv.Kernels.Dims()
+	if len(data.Kernels) != data.NumFilters || len(data.Biases) != data.NumFilters {
+		return nil, fmt.Errorf("conv2D layer should have %v kernels and biases", data.NumFilters)
+	}
+	for i, kernel := range data.Kernels {
+		if len(kernel) != kernelSize {
+			return nil, fmt.Errorf("conv2D kernels should have %v values", kernelSize)
+		}
+		conv.Kernels.SetRow(i, kernel)
+	}
+	conv.Biases = mat.NewVecDense(data.NumFilters, data.Biases)
+	return conv, nil
+}
+
+// pool2D takes the maximum or average of every PoolSize x PoolSize window of each channel, moving Stride values at a time
+type pool2D struct {
+	Input    Shape
+	PoolSize int
+	Stride   int
+
+	max bool //average otherwise
+
+	maxIndices [][]int //per sample of the last Forward and output value, the input index of the maximum
+}
+
+type jsonPool2D struct {
+	Input    Shape
+	PoolSize int
+	Stride   int
+}
+
+type MaxPool2D struct {
+	pool2D
+}
+
+type AvgPool2D struct {
+	pool2D
+}
+
+func NewMaxPool2D(input Shape, poolSize, stride int) *MaxPool2D {
+	return &MaxPool2D{pool2D{Input: input, PoolSize: poolSize, Stride: stride, max: true}}
+}
+
+func NewAvgPool2D(input Shape, poolSize, stride int) *AvgPool2D {
+	return &AvgPool2D{pool2D{Input: input, PoolSize: poolSize, Stride: stride}}
+}
+
+func (pool *pool2D) Output() Shape {
+	return Shape{
+		Channels: pool.Input.Channels,
+		Height:   (pool.Input.Height-pool.PoolSize)/pool.Stride + 1,
+		Width:    (pool.Input.Width-pool.PoolSize)/pool.Stride + 1,
+	}
+}
+
+// forEachWindow calls f with the output index of every window and the input indices it covers
+func (pool *pool2D) forEachWindow(f func(outputIndex int, inputIndices []int)) {
+	output := pool.Output()
+	inputIndices := make([]int, 0, pool.PoolSize*pool.PoolSize)
+	for channel := 0; channel < output.Channels; channel++ {
+		for y := 0; y < output.Height; y++ {
+			for x := 0; x < output.Width; x++ {
+				inputIndices = inputIndices[:0]
+				for dy := 0; dy < pool.PoolSize; dy++ {
+					for dx := 0; dx < pool.PoolSize; dx++ {
+						inputIndices = append(inputIndices, pool.Input.index(channel, y*pool.Stride+dy, x*pool.Stride+dx))
+					}
+				}
+				f(output.index(channel, y, x), inputIndices)
+			}
+		}
+	}
+}
+
+func (pool *pool2D) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	output := pool.Output()
+	result := mat.NewDense(numSamples, output.Size(), nil)
+	pool.maxIndices = make([][]int, numSamples)
+	for i := 0; i < numSamples; i++ {
+		input := inputs.RawRowView(i)
+		row := result.RawRowView(i)
+		pool.maxIndices[i] = make([]int, output.Size())
+		pool.forEachWindow(func(outputIndex int, inputIndices []int) {
+			if pool.max {
+				maxIndex := inputIndices[0]
+				for _, inputIndex := range inputIndices {
+					if input[inputIndex] > input[maxIndex] {
+						maxIndex = inputIndex
+					}
+				}
+				pool.maxIndices[i][outputIndex] = maxIndex
+				row[outputIndex] = input[maxIndex]
+				return
+			}
+			for _, inputIndex := range inputIndices {
+				row[outputIndex] += input[inputIndex] / float64(len(inputIndices))
+			}
+		})
+	}
+	return result
+}
+
+func (pool *pool2D) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	result := mat.NewDense(numSamples, pool.Input.Size(), nil)
+	for i := 0; i < numSamples; i++ {
+		row := grad.RawRowView(i)
+		inputGradient := result.RawRowView(i)
+		pool.forEachWindow(func(outputIndex int, inputIndices []int) {
+			if pool.max {
+				inputGradient[pool.maxIndices[i][outputIndex]] += row[outputIndex]
+				return
+			}
+			for _, inputIndex := range inputIndices {
+				inputGradient[inputIndex] += row[outputIndex] / float64(len(inputIndices))
+			}
+		})
+	}
+	return result
+}
+
+func (pool *pool2D) Params() [][]float64 {
+	return nil
+}
+
+func (pool *pool2D) Grads() [][]float64 {
+	return nil
+}
+
+func (pool *MaxPool2D) Serialize() (*JSONLayer, error) {
+	return serialize("maxPool2D", jsonPool2D{Input: pool.Input, PoolSize: pool.PoolSize, Stride: pool.Stride})
+}
+
+func (pool *AvgPool2D) Serialize() (*JSONLayer, error) {
+	return serialize("avgPool2D", jsonPool2D{Input: pool.Input, PoolSize: pool.PoolSize, Stride: pool.Stride})
+}
+
+func checkPool2D(data *jsonPool2D) error {
+	if data.PoolSize < 1 || data.Stride < 1 {
+		return fmt.Errorf("pooling layer needs a positive pool size and stride")
+	}
+	return nil
+}
+
+// GlobalAvgPool averages each channel down to a single value
+type GlobalAvgPool struct {
+	Input Shape
+}
+
+type jsonGlobalAvgPool struct {
+	Input Shape
+}
+
+func NewGlobalAvgPool(input Shape) *GlobalAvgPool {
+	return &GlobalAvgPool{Input: input}
+}
+
+func (pool *GlobalAvgPool) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	area := pool.Input.Height * pool.Input.Width
+	result := mat.NewDense(numSamples, pool.Input.Channels, nil)
+	for i := 0; i < numSamples; i++ {
+		input := inputs.RawRowView(i)
+		for channel := 0; channel < pool.Input.Channels; channel++ {
+			sum := float64(0)
+			for _, value := range input[channel*area : (channel+1)*area] {
+				sum += value
+			}
+			result.Set(i, channel, sum/float64(area))
+		}
+	}
+	return result
+}
+
+func (pool *GlobalAvgPool) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	area := pool.Input.Height * pool.Input.Width
+	result := mat.NewDense(numSamples, pool.Input.Size(), nil)
+	result.Apply(func(i, j int, _ float64) float64 {
+		return grad.At(i, j/area) / float64(area)
+	}, result)
+	return result
+}
+
+func (pool *GlobalAvgPool) Params() [][]float64 {
+	return nil
+}
+
+func (pool *GlobalAvgPool) Grads() [][]float64 {
+	return nil
+}
+
+func (pool *GlobalAvgPool) Serialize() (*JSONLayer, error) {
+	return serialize("globalAvgPool", jsonGlobalAvgPool{Input: pool.Input})
+}
+
+// SpatialBatchNorm is batch normalization for images: each channel is normalized over the batch and every position of the image,
+// with one Gamma and Beta per channel, unlike a Normalization which would normalize every value of the image on its own
+type SpatialBatchNorm struct {
+	*feedforward.Normalization
+	Input Shape
+}
+
+type jsonSpatialBatchNorm struct {
+	Input         Shape
+	Normalization *feedforward.JSONNormalization
+}
+
+func NewSpatialBatchNorm(input Shape, momentum float64) *SpatialBatchNorm {
+	return &SpatialBatchNorm{feedforward.NewBatchNorm(input.Channels, momentum), input}
+}
+
+// toPositions rearranges images into one row per position of every image, holding the values of each channel at that position
+func (shape Shape) toPositions(images *mat.Dense) *mat.Dense {
+	numSamples, _ := images.Dims()
+	area := shape.Height * shape.Width
+	result := mat.NewDense(numSamples*area, shape.Channels, nil)
+	for i := 0; i < numSamples; i++ {
+		image := images.RawRowView(i)
+		for channel := 0; channel < shape.Channels; channel++ {
+			for position := 0; position < area; position++ {
+				result.Set(i*area+position, channel, image[channel*area+position])
+			}
+		}
+	}
+	return result
+}
+
+// fromPositions undoes toPositions for numSamples images
+func (shape Shape) fromPositions(positions *mat.Dense, numSamples int) *mat.Dense {
+	area := shape.Height * shape.Width
+	result := mat.NewDense(numSamples, shape.Size(), nil)
+	for i := 0; i < numSamples; i++ {
+		image := result.RawRowView(i)
+		for channel := 0; channel < shape.Channels; channel++ {
+			for position := 0; position < area; position++ {
+				image[channel*area+position] = positions.At(i*area+position, channel)
+			}
+		}
+	}
+	return result
+}
+
+func (norm *SpatialBatchNorm) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	return norm.Input.fromPositions(norm.Normalization.Forward(norm.Input.toPositions(inputs), training), numSamples)
+}
+
+// Backward scales the gradients of Gamma and Beta back up, since Normalization averages them over every position of every sample
+func (norm *SpatialBatchNorm) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	inputGradient := norm.Normalization.Backward(norm.Input.toPositions(grad))
+	for _, paramGrad := range norm.Normalization.Grads() {
+		for i := range paramGrad {
+			paramGrad[i] *= float64(norm.Input.Height * norm.Input.Width)
+		}
+	}
+	return norm.Input.fromPositions(inputGradient, numSamples)
+}
+
+func (norm *SpatialBatchNorm) Output() Shape {
+	return norm.Input
+}
+
+func (norm *SpatialBatchNorm) Serialize() (*JSONLayer, error) {
+	return serialize("spatialBatchNorm", jsonSpatialBatchNorm{Input: norm.Input, Normalization: norm.ToJSONNormalization()})
+}
+
+// Flatten marks where image layers end and dense layers start. Samples are always stored flat, so it passes values through unchanged.
+type Flatten struct {
+	Input Shape
+}
+
+type jsonFlatten struct {
+	Input Shape
+}
+
+func NewFlatten(input Shape) *Flatten {
+	return &Flatten{Input: input}
+}
+
+func (flatten *Flatten) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	return inputs
+}
+
+func (flatten *Flatten) Backward(grad *mat.Dense) *mat.Dense {
+	return grad
+}
+
+func (flatten *Flatten) Params() [][]float64 {
+	return nil
+}
+
+func (flatten *Flatten) Grads() [][]float64 {
+	return nil
+}
+
+// Output is the number of values of each flattened sample
+func (flatten *Flatten) Output() int {
+	return flatten.Input.Size()
+}
+
+func (flatten *Flatten) Serialize() (*JSONLayer, error) {
+	return serialize("flatten", jsonFlatten{Input: flatten.Input})
+}
+
+func init() {
+	Register("conv2D", decodeInto(decodeConv2D))
+	Register("maxPool2D", decodeInto(func(data *jsonPool2D) (Layer, error) {
+		if err := checkPool2D(data); err != nil {
+			return nil, err
+		}
+		return NewMaxPool2D(data.Input, data.PoolSize, data.Stride), nil
+	}))
+	Register("avgPool2D", decodeInto(func(data *jsonPool2D) (Layer, error) {
+		if err := checkPool2D(data); err != nil {
+			return nil, err
+		}
+		return NewAvgPool2D(data.Input, data.PoolSize, data.Stride), nil
+	}))
+	Register("globalAvgPool", decodeInto(func(data *jsonGlobalAvgPool) (Layer, error) {
+		return NewGlobalAvgPool(data.Input), nil
+	}))
+	Register("spatialBatchNorm", decodeInto(func(data *jsonSpatialBatchNorm) (Layer, error) {
+		if data.Normalization == nil || data.Normalization.Kind != feedforward.BatchNorm {
+			return nil, fmt.Errorf("spatial batch norm needs a batch normalization")
+		}
+		normalization, err := data.Normalization.ToNormalization()
+		if err != nil {
+			return nil, err
+		}
+		if err := normalization.Validate(data.Input.Channels); err != nil {
+			return nil, err
+		}
+		return &SpatialBatchNorm{normalization, data.Input}, nil
+	}))
+	Register("flatten", decodeInto(func(data *jsonFlatten) (Layer, error) {
+		return NewFlatten(data.Input), nil
+	}))
+}
@@ -0,0 +1,30 @@
+package layer
+
+import (
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestConv2DGradients(t *testing.T) {
+	conv1 := NewConv2D(Shape{2, 6, 7}, 3, 3, 2, 2, 1)
+	conv1.Initialize(feedforward.HeNormal, feedforward.TruncatedNormal)
+	norm := NewSpatialBatchNorm(conv1.Output(), 0.1)
+	norm.Gamma.SetVec(1, 1.7)
+	norm.Beta.SetVec(2, 0.3)
+	pool1 := NewMaxPool2D(conv1.Output(), 2, 1)
+	conv2 := NewConv2D(pool1.Output(), 4, 2, 2, 1, 0)
+	conv2.Initialize(feedforward.HeNormal, feedforward.TruncatedNormal)
+	pool2 := NewAvgPool2D(conv2.Output(), 1, 1)
+	globalPool := NewGlobalAvgPool(pool2.Output())
+	dense := NewDense(4, 2, activationfunction.Softmax)
+	dense.Initialize(feedforward.XavierNormal, feedforward.Zeros)
+	sequential := NewSequential(conv1, norm, NewActivation(activationfunction.Tanh), pool1, conv2, pool2, globalPool, NewFlatten(Shape{4, 1, 1}), dense)
+
+	inputs := sinMatrix(3, Shape{2, 6, 7}.Size(), 0)
+	groundTruth := mat.NewDense(3, 2, []float64{1, 0, 0, 1, 1, 0})
+	checkGradients(t, sequential, inputs, groundTruth, loss.CategoricalCrossEntropy, true)
+}
@@ -0,0 +1,222 @@
+package layer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"nn/feedforward"
+	"nn/optimizer"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Embedding maps integer ids to learnable vectors. Each input value is an id, so a sample of numIds ids
+// becomes numIds vectors one after another, e.g. the steps of a sequence for Recurrent or attention layers.
+// Its gradients are sparse: only the rows of the ids in a batch are updated.
+type Embedding struct {
+	Vectors *mat.Dense //vocabulary size x embedding size
+	Tokens  []string   //optional names of the ids, e.g. the words of pretrained vectors
+	Frozen  bool       //if set, Vectors aren't trained
+
+	tokenIndices map[string]int
+	ids          []int //of the last Forward
+	gradient     *mat.Dense
+	rows         []int //of gradient that the last Backward filled
+}
+
+type jsonEmbedding struct {
+	Vectors [][]float64
+	Tokens  []string `json:",omitempty"`
+	Frozen  bool     `json:",omitempty"`
+}
+
+func NewEmbedding(vocabularySize, embeddingSize int) *Embedding {
+	return &Embedding{Vectors: mat.NewDense(vocabularySize, embeddingSize, nil)}
+}
+
+func (embedding *Embedding) VocabularySize() int {
+	vocabularySize, _ := embedding.Vectors.Dims()
+	return vocabularySize
+}
+
+func (embedding *Embedding) EmbeddingSize() int {
+	_, embeddingSize := embedding.Vectors.Dims()
+	return embeddingSize
+}
+
+// Initialize fills Vectors with a fan-in of the vocabulary size and a fan-out of the embedding size
+func (embedding *Embedding) Initialize(initializer feedforward.Initializer) {
+	initializer.Init(embedding.Vectors, embedding.VocabularySize(), embedding.EmbeddingSize())
+}
+
+// Index returns the id of token, or -1 if it isn't one of Tokens
+func (embedding *Embedding) Index(token string) int {
+	if embedding.tokenIndices == nil {
+		embedding.tokenIndices = make(map[string]int, len(embedding.Tokens))
+		for i, currToken := range embedding.Tokens {
+			embedding.tokenIndices[currToken] = i
+		}
+	}
+	index, ok := embedding.tokenIndices[token]
+	if !ok {
+		return -1
+	}
+	return index
+}
+
+// Vector returns the row of id, aliasing Vectors
+func (embedding *Embedding) Vector(id int) *mat.VecDense {
+	return embedding.Vectors.RowView(id).(*mat.VecDense)
+}
+
+func (embedding *Embedding) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, numIds := inputs.Dims()
+	embeddingSize := embedding.EmbeddingSize()
+	embedding.ids = make([]int, numSamples*numIds)
+	result := mat.NewDense(numSamples, numIds*embeddingSize, nil)
+	for i := 0; i < numSamples; i++ {
+		row := result.RawRowView(i)
+		for j := 0; j < numIds; j++ {
+			id := int(math.Round(inputs.At(i, j)))
+			if id < 0 || id >= embedding.VocabularySize() {
+				panic(fmt.Sprintf("id %v is outside a vocabulary of %v", inputs.At(i, j), embedding.VocabularySize()))
+			}
+			embedding.ids[i*numIds+j] = id
+			copy(row[j*embeddingSize:(j+1)*embeddingSize], embedding.Vectors.RawRowView(id))
+		}
+	}
+	return result
+}
+
+// Backward only clears and fills the rows of the ids in the last batch. Ids aren't differentiable, so the gradients with respect to the inputs are zero.
+func (embedding *Embedding) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	numIds := len(embedding.ids) / numSamples
+	embeddingSize := embedding.EmbeddingSize()
+	if embedding.gradient == nil {
+		embedding.gradient = mat.NewDense(embedding.VocabularySize(), embeddingSize, nil)
+	}
+	for _, id := range embedding.rows {
+		row := embedding.gradient.RawRowView(id)
+		for k := range row {
+			row[k] = 0
+		}
+	}
+	embedding.rows = embedding.rows[:0]
+	for i := 0; i < numSamples; i++ {
+		gradRow := grad.RawRowView(i)
+		for j := 0; j < numIds; j++ {
+			id := embedding.ids[i*numIds+j]
+			row := embedding.gradient.RawRowView(id)
+			for k := range row {
+				row[k] += gradRow[j*embeddingSize+k] / float64(numSamples)
+			}
+		}
+	}
+	seen := map[int]bool{}
+	for _, id := range embedding.ids {
+		if !seen[id] {
+			seen[id] = true
+			embedding.rows = append(embedding.rows, id)
+		}
+	}
+	sort.Ints(embedding.rows)
+	return mat.NewDense(numSamples, numIds, nil)
+}
+
+func (embedding *Embedding) Params() [][]float64 {
+	if embedding.Frozen {
+		return nil
+	}
+	return [][]float64{embedding.Vectors.RawMatrix().Data}
+}
+
+func (embedding *Embedding) Grads() [][]float64 {
+	if embedding.Frozen {
+		return nil
+	}
+	return [][]float64{embedding.gradient.RawMatrix().Data}
+}
+
+func (embedding *Embedding) SparseGrads() []*optimizer.SparseGradient {
+	if embedding.Frozen {
+		return nil
+	}
+	return []*optimizer.SparseGradient{{Rows: embedding.rows, RowSize: embedding.EmbeddingSize()}}
+}
+
+func (embedding *Embedding) Serialize() (*JSONLayer, error) {
+	return serialize("embedding", jsonEmbedding{Vectors: rows(embedding.Vectors), Tokens: embedding.Tokens, Frozen: embedding.Frozen})
+}
+
+func decodeEmbedding(data *jsonEmbedding) (Layer, error) {
+	if len(data.Vectors) == 0 || len(data.Vectors[0]) == 0 {
+		return nil, fmt.Errorf("embedding has no vectors")
+	}
+	if data.Tokens != nil && len(data.Tokens) != len(data.Vectors) {
+		return nil, fmt.Errorf("%v tokens for %v vectors", len(data.Tokens), len(data.Vectors))
+	}
+	embedding := NewEmbedding(len(data.Vectors), len(data.Vectors[0]))
+	if err := setRows(embedding.Vectors, data.Vectors); err != nil {
+		return nil, err
+	}
+	embedding.Tokens = data.Tokens
+	embedding.Frozen = data.Frozen
+	return embedding, nil
+}
+
+// ReadWordVectors reads pretrained vectors in the plain-text format of GloVe and word2vec:
+// a token followed by its values on each line, separated by spaces, with word2vec's optional "count size" header line.
+func ReadWordVectors(reader io.Reader) (*Embedding, error) {
+	tokens := []string{}
+	vectors := [][]float64{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if lineNumber == 1 && len(fields) == 2 {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				continue
+			}
+		}
+		vector := make([]float64, len(fields)-1)
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", lineNumber, err)
+			}
+			vector[i] = value
+		}
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("line %v: %q has no values", lineNumber, fields[0])
+		}
+		if len(vectors) > 0 && len(vector) != len(vectors[0]) {
+			return nil, fmt.Errorf("line %v: expected %v values, got %v", lineNumber, len(vectors[0]), len(vector))
+		}
+		tokens = append(tokens, fields[0])
+		vectors = append(vectors, vector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no word vectors")
+	}
+	embedding := NewEmbedding(len(vectors), len(vectors[0]))
+	for i, vector := range vectors {
+		embedding.Vectors.SetRow(i, vector)
+	}
+	embedding.Tokens = tokens
+	return embedding, nil
+}
+
+func init() {
+	Register("embedding", decodeInto(decodeEmbedding))
+}
@@ -0,0 +1,27 @@
+package layer
+
+import (
+	"nn/feedforward"
+	"nn/loss"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestEmbeddingGradients(t *testing.T) {
+	const vocabularySize, embeddingSize, hiddenSize = 6, 3, 4
+	embedding := NewEmbedding(vocabularySize, embeddingSize)
+	embedding.Initialize(feedforward.XavierNormal)
+	gru := NewGRU(embeddingSize, hiddenSize, false, 0)
+	gru.Initialize(feedforward.XavierNormal, feedforward.Orthogonal, feedforward.TruncatedNormal)
+	sequential := NewSequential(embedding, gru)
+
+	//ids 1 and 4 repeat and id 5 is never used, so its gradient must stay zero
+	ids := mat.NewDense(2, 3, []float64{1, 4, 0, 2, 1, 4})
+	checkGradients(t, sequential, ids, sinMatrix(2, hiddenSize, 1), loss.SquaredError, false)
+
+	if rows, want := embedding.SparseGrads()[0].Rows, []int{0, 1, 2, 4}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("sparse gradient rows %v, want %v", rows, want)
+	}
+}
@@ -0,0 +1,389 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+	"nn/loss"
+	"nn/model"
+	"nn/optimizer"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type MergeKind string
+
+const (
+	Add    MergeKind = "add"    //sums inputs of the same size, e.g. for a residual connection
+	Concat MergeKind = "concat" //joins the inputs' values one after another
+)
+
+// Node is one step of a Graph. Its inputs, which are graph inputs or earlier nodes, are merged and then run through Layer.
+type Node struct {
+	Name   string
+	Inputs []string
+	Merge  MergeKind //how more than one input is combined
+	Layer  Layer     //nil for nodes that only merge
+}
+
+type JSONNode struct {
+	Name   string
+	Inputs []string
+	Merge  MergeKind  `json:",omitempty"`
+	Layer  *JSONLayer `json:",omitempty"`
+}
+
+// GraphInput is a named input of a Graph taking Size values of each sample
+type GraphInput struct {
+	Name string
+	Size int
+}
+
+// Graph runs layers connected in any order without cycles, allowing skip connections, several inputs and several outputs.
+// As a model.Model it takes its inputs' values one after another in a single matrix and returns its outputs' values the same way.
+type Graph struct {
+	Inputs  []GraphInput
+	Nodes   []*Node  //each after the nodes it takes inputs from
+	Outputs []string //names of the nodes or inputs whose values are the graph's outputs
+	Loss    loss.Loss
+
+	values map[string]*mat.Dense //of the last Forward
+}
+
+type JSONGraph struct {
+	Inputs  []GraphInput
+	Nodes   []*JSONNode
+	Outputs []string
+	Loss    string
+}
+
+func NewNode(name string, layer Layer, inputs ...string) *Node {
+	return &Node{Name: name, Inputs: inputs, Layer: layer}
+}
+
+// NewMerge makes a node that merges inputs, optionally running the result through layer
+func NewMerge(name string, merge MergeKind, layer Layer, inputs ...string) *Node {
+	return &Node{Name: name, Inputs: inputs, Merge: merge, Layer: layer}
+}
+
+// NewGraph checks that every node only uses inputs and earlier nodes and that the outputs exist
+func NewGraph(inputs []GraphInput, nodes []*Node, outputs []string) (*Graph, error) {
+	graph := &Graph{Inputs: inputs, Nodes: nodes, Outputs: outputs}
+	if err := graph.validate(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+func (graph *Graph) validate() error {
+	if len(graph.Inputs) == 0 || len(graph.Outputs) == 0 {
+		return fmt.Errorf("graph needs inputs and outputs")
+	}
+	defined := map[string]bool{}
+	for _, input := range graph.Inputs {
+		if defined[input.Name] {
+			return fmt.Errorf("%q is defined twice", input.Name)
+		}
+		if input.Size < 1 {
+			return fmt.Errorf("input %q needs a positive size", input.Name)
+		}
+		defined[input.Name] = true
+	}
+	for _, node := range graph.Nodes {
+		if defined[node.Name] {
+			return fmt.Errorf("%q is defined twice", node.Name)
+		}
+		if len(node.Inputs) == 0 {
+			return fmt.Errorf("node %q has no inputs", node.Name)
+		}
+		for _, input := range node.Inputs {
+			if !defined[input] {
+				return fmt.Errorf("node %q takes %q, which isn't an input or an earlier node", node.Name, input)
+			}
+		}
+		switch node.Merge {
+		case Add, Concat:
+		case "":
+			if len(node.Inputs) > 1 {
+				return fmt.Errorf("node %q has %v inputs but no merge", node.Name, len(node.Inputs))
+			}
+		default:
+			return fmt.Errorf("node %q has unknown merge %q", node.Name, node.Merge)
+		}
+		if node.Layer == nil && len(node.Inputs) == 1 && node.Merge == "" {
+			return fmt.Errorf("node %q has neither a layer nor a merge", node.Name)
+		}
+		defined[node.Name] = true
+	}
+	for _, output := range graph.Outputs {
+		if !defined[output] {
+			return fmt.Errorf("unknown output %q", output)
+		}
+	}
+	return nil
+}
+
+func (graph *Graph) ToJSONGraph() (*JSONGraph, error) {
+	jsonGraph := &JSONGraph{Inputs: graph.Inputs, Outputs: graph.Outputs}
+	for _, node := range graph.Nodes {
+		jsonNode := &JSONNode{Name: node.Name, Inputs: node.Inputs, Merge: node.Merge}
+		if node.Layer != nil {
+			jsonLayer, err := node.Layer.Serialize()
+			if err != nil {
+				return nil, fmt.Errorf("node %q: %w", node.Name, err)
+			}
+			jsonNode.Layer = jsonLayer
+		}
+		jsonGraph.Nodes = append(jsonGraph.Nodes, jsonNode)
+	}
+	if graph.Loss != nil {
+		jsonGraph.Loss = graph.Loss.Name()
+	}
+	return jsonGraph, nil
+}
+
+func (jsonGraph *JSONGraph) ToGraph() (*Graph, error) {
+	lossFunction, err := getLoss(jsonGraph.Loss)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*Node{}
+	for _, jsonNode := range jsonGraph.Nodes {
+		node := &Node{Name: jsonNode.Name, Inputs: jsonNode.Inputs, Merge: jsonNode.Merge}
+		if jsonNode.Layer != nil {
+			currLayer, err := jsonNode.Layer.ToLayer()
+			if err != nil {
+				return nil, fmt.Errorf("node %q: %w", jsonNode.Name, err)
+			}
+			node.Layer = currLayer
+		}
+		nodes = append(nodes, node)
+	}
+	graph, err := NewGraph(jsonGraph.Inputs, nodes, jsonGraph.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	graph.Loss = lossFunction
+	return graph, nil
+}
+
+func (graph *Graph) MarshalJSON() ([]byte, error) {
+	jsonGraph, err := graph.ToJSONGraph()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonGraph)
+}
+
+func DecodeGraph(data []byte) (*Graph, error) {
+	jsonGraph := &JSONGraph{}
+	if err := json.Unmarshal(data, jsonGraph); err != nil {
+		return nil, err
+	}
+	return jsonGraph.ToGraph()
+}
+
+// splitColumns divides matrix into consecutive blocks of columns of the given sizes
+func splitColumns(matrix *mat.Dense, sizes []int) []*mat.Dense {
+	numRows, numCols := matrix.Dims()
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if total != numCols {
+		panic(fmt.Sprintf("expected %v values per sample, got %v", total, numCols))
+	}
+	result := make([]*mat.Dense, len(sizes))
+	start := 0
+	for i, size := range sizes {
+		result[i] = mat.DenseCopyOf(matrix.Slice(0, numRows, start, start+size))
+		start += size
+	}
+	return result
+}
+
+func concatColumns(matrices []*mat.Dense) *mat.Dense {
+	numRows, _ := matrices[0].Dims()
+	numCols := 0
+	for _, matrix := range matrices {
+		_, currCols := matrix.Dims()
+		numCols += currCols
+	}
+	result := mat.NewDense(numRows, numCols, nil)
+	start := 0
+	for _, matrix := range matrices {
+		_, currCols := matrix.Dims()
+		result.Slice(0, numRows, start, start+currCols).(*mat.Dense).Copy(matrix)
+		start += currCols
+	}
+	return result
+}
+
+func (graph *Graph) merge(node *Node) *mat.Dense {
+	inputs := make([]*mat.Dense, len(node.Inputs))
+	for i, input := range node.Inputs {
+		inputs[i] = graph.values[input]
+	}
+	if node.Merge == Concat {
+		return concatColumns(inputs)
+	}
+	result := mat.DenseCopyOf(inputs[0])
+	for _, input := range inputs[1:] {
+		result.Add(result, input)
+	}
+	return result
+}
+
+// ForwardMulti runs a batch given as one matrix per input and returns one matrix per output
+func (graph *Graph) ForwardMulti(inputs []*mat.Dense, training bool) []*mat.Dense {
+	if len(inputs) != len(graph.Inputs) {
+		panic(fmt.Sprintf("graph takes %v inputs, got %v", len(graph.Inputs), len(inputs)))
+	}
+	graph.values = map[string]*mat.Dense{}
+	for i, input := range graph.Inputs {
+		graph.values[input.Name] = inputs[i]
+	}
+	for _, node := range graph.Nodes {
+		value := graph.merge(node)
+		if node.Layer != nil {
+			value = node.Layer.Forward(value, training)
+		}
+		graph.values[node.Name] = value
+	}
+	outputs := make([]*mat.Dense, len(graph.Outputs))
+	for i, output := range graph.Outputs {
+		outputs[i] = graph.values[output]
+	}
+	return outputs
+}
+
+// BackwardMulti takes the gradients with respect to each output of the last ForwardMulti and returns the gradients with respect to each input.
+// Gradients of values used by several nodes are summed.
+func (graph *Graph) BackwardMulti(grads []*mat.Dense) []*mat.Dense {
+	gradients := map[string]*mat.Dense{}
+	addGradient := func(name string, grad mat.Matrix) {
+		if gradients[name] == nil {
+			gradients[name] = mat.DenseCopyOf(grad)
+			return
+		}
+		gradients[name].Add(gradients[name], grad)
+	}
+	for i, output := range graph.Outputs {
+		addGradient(output, grads[i])
+	}
+	for i := len(graph.Nodes) - 1; i >= 0; i-- {
+		node := graph.Nodes[i]
+		grad := gradients[node.Name]
+		if grad == nil { //not used by any output, but its layer still needs gradients for the optimizer
+			numRows, numCols := graph.values[node.Name].Dims()
+			grad = mat.NewDense(numRows, numCols, nil)
+		}
+		if node.Layer != nil {
+			grad = node.Layer.Backward(grad)
+		}
+		if node.Merge != Concat {
+			for _, input := range node.Inputs {
+				addGradient(input, grad)
+			}
+			continue
+		}
+		numRows, _ := grad.Dims()
+		start := 0
+		for _, input := range node.Inputs {
+			_, size := graph.values[input].Dims()
+			addGradient(input, grad.Slice(0, numRows, start, start+size))
+			start += size
+		}
+	}
+	result := make([]*mat.Dense, len(graph.Inputs))
+	for i, input := range graph.Inputs {
+		result[i] = gradients[input.Name]
+		if result[i] == nil {
+			numRows, numCols := graph.values[input.Name].Dims()
+			result[i] = mat.NewDense(numRows, numCols, nil)
+		}
+	}
+	return result
+}
+
+func (graph *Graph) inputSizes() []int {
+	sizes := make([]int, len(graph.Inputs))
+	for i, input := range graph.Inputs {
+		sizes[i] = input.Size
+	}
+	return sizes
+}
+
+func (graph *Graph) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	return concatColumns(graph.ForwardMulti(splitColumns(inputs, graph.inputSizes()), training))
+}
+
+// SplitOutputs divides the values of Forward or Predict by output
+func (graph *Graph) SplitOutputs(outputs *mat.Dense) []*mat.Dense {
+	sizes := make([]int, len(graph.Outputs))
+	for i, output := range graph.Outputs {
+		_, sizes[i] = graph.values[output].Dims()
+	}
+	return splitColumns(outputs, sizes)
+}
+
+func (graph *Graph) Backward(grad *mat.Dense) *mat.Dense {
+	return concatColumns(graph.BackwardMulti(graph.SplitOutputs(grad)))
+}
+
+func (graph *Graph) Predict(inputs *mat.Dense) *mat.Dense {
+	return graph.Forward(inputs, false)
+}
+
+// Run runs a single sample in inference mode
+func (graph *Graph) Run(inputs *mat.VecDense) *mat.VecDense {
+	output := graph.Predict(mat.NewDense(1, inputs.Len(), mat.Col(nil, 0, inputs)))
+	return mat.VecDenseCopyOf(output.RowView(0))
+}
+
+func (graph *Graph) layers() []Layer {
+	result := []Layer{}
+	for _, node := range graph.Nodes {
+		if node.Layer != nil {
+			result = append(result, node.Layer)
+		}
+	}
+	return result
+}
+
+func (graph *Graph) Parameters() [][]float64 {
+	return NewSequential(graph.layers()...).Parameters()
+}
+
+// Gradients lists the gradients kept by the last Backward in the order of Parameters
+func (graph *Graph) Gradients() [][]float64 {
+	return NewSequential(graph.layers()...).Gradients()
+}
+
+func (graph *Graph) SparseGradients() []*optimizer.SparseGradient {
+	return NewSequential(graph.layers()...).SparseGradients()
+}
+
+// LearnBatch takes one optimizer step on a batch and returns its average cost, with the loss applied to all outputs together
+func (graph *Graph) LearnBatch(inputs, groundTruth *mat.Dense, lossFunction loss.Loss, opt optimizer.Optimizer) (float64, *mat.Dense) {
+	output := graph.Forward(inputs, true)
+	graph.Backward(lossFunction.Gradient(output, groundTruth))
+	opt.UpdateSparse(graph.Parameters(), graph.Gradients(), graph.SparseGradients())
+	return lossFunction.Eval(output, groundTruth), output
+}
+
+// Copy fails for graphs with layers that can't be serialized
+func (graph *Graph) Copy() (*Graph, error) {
+	jsonGraph, err := graph.ToJSONGraph()
+	if err != nil {
+		return nil, err
+	}
+	return jsonGraph.ToGraph()
+}
+
+func (graph *Graph) Clone() (model.Model, error) {
+	return graph.Copy()
+}
+
+func (graph *Graph) SetLoss(lossFunction loss.Loss) {
+	graph.Loss = lossFunction
+}
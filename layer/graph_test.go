@@ -0,0 +1,39 @@
+package layer
+
+import (
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGraphGradients(t *testing.T) {
+	dense := func(numInputs, numOutputs int, activationFunction activationfunction.LayerActivationFunction) *Dense {
+		result := NewDense(numInputs, numOutputs, activationFunction)
+		result.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+		return result
+	}
+	graph, err := NewGraph([]GraphInput{{"a", 3}, {"b", 2}}, []*Node{
+		NewNode("hidden1", dense(3, 4, activationfunction.Tanh), "a"),
+		NewNode("hidden2", dense(4, 4, activationfunction.Tanh), "hidden1"),
+		NewMerge("residual", Add, nil, "hidden1", "hidden2"),
+		NewMerge("concat", Concat, dense(6, 3, activationfunction.Sigmoid), "residual", "b"),
+		NewNode("head1", dense(3, 2, activationfunction.Softmax), "concat"),
+		NewNode("head2", dense(4, 1, activationfunction.Identity), "residual"),
+		NewNode("unused", dense(2, 2, activationfunction.Tanh), "b"),
+	}, []string{"head1", "head2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groundTruth := mat.NewDense(3, 3, []float64{1, 0, 0.5, 0, 1, -0.5, 1, 0, 0.2})
+	checkGradients(t, graph, sinMatrix(3, 5, 0), groundTruth, loss.SquaredError, true)
+}
+
+func TestDecodeGraphUnknownLoss(t *testing.T) {
+	document := `{"Inputs":[{"Name":"a","Size":1}],"Nodes":[],"Outputs":["a"],"Loss":"squaredEror"}`
+	if _, err := DecodeGraph([]byte(document)); err == nil {
+		t.Error("decoded a misspelled loss without an error")
+	}
+}
@@ -0,0 +1,355 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/optimizer"
+	"nn/random"
+	"reflect"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Layer is one step of a Sequential model. Batches are numSamples x size matrices with one sample per row,
+// and layers working on images or sequences read each row as their flattened values.
+type Layer interface {
+	// Forward runs a batch through the layer, keeping what Backward needs
+	Forward(inputs *mat.Dense, training bool) *mat.Dense
+	// Backward takes the gradients of the batch's summed cost with respect to the last Forward's outputs,
+	// keeps the gradients of the parameters averaged over the batch and returns the gradients with respect to the inputs
+	Backward(grad *mat.Dense) *mat.Dense
+	// Params aliases the layer's parameters, so updating the returned slices updates the layer
+	Params() [][]float64
+	// Grads returns the gradients kept by the last Backward in the order of Params
+	Grads() [][]float64
+	// Serialize fails for layers using an activation function that isn't registered
+	Serialize() (*JSONLayer, error)
+}
+
+// SparseLayer is a layer whose gradients only cover some rows of its parameters, such as Embedding, or that wraps such layers.
+// SparseGrads describes the rows of each of Grads, with nil entries for parameters with dense gradients.
+type SparseLayer interface {
+	Layer
+	SparseGrads() []*optimizer.SparseGradient
+}
+
+// sparseGrads is the SparseGrads of a SparseLayer, or nil entries for every parameter of any other layer
+func sparseGrads(currLayer Layer) []*optimizer.SparseGradient {
+	if sparseLayer, ok := currLayer.(SparseLayer); ok {
+		return sparseLayer.SparseGrads()
+	}
+	return make([]*optimizer.SparseGradient, len(currLayer.Params()))
+}
+
+type JSONLayer struct {
+	Type string
+	Data json.RawMessage
+}
+
+var nameToDecoder = map[string]func(data json.RawMessage) (Layer, error){}
+
+// Register makes layers of a type loadable from their JSONLayer
+func Register(layerType string, decode func(data json.RawMessage) (Layer, error)) {
+	if _, ok := nameToDecoder[layerType]; ok {
+		panic(fmt.Sprintf("layer type %q is already registered", layerType))
+	}
+	nameToDecoder[layerType] = decode
+}
+
+func (jsonLayer *JSONLayer) ToLayer() (Layer, error) {
+	decode, ok := nameToDecoder[jsonLayer.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer type %q", jsonLayer.Type)
+	}
+	return decode(jsonLayer.Data)
+}
+
+// TypeName is the name of a layer's Go type, e.g. Dense, for labelling layers without serializing them
+func TypeName(currLayer Layer) string {
+	layerType := reflect.TypeOf(currLayer)
+	if layerType.Kind() == reflect.Pointer {
+		layerType = layerType.Elem()
+	}
+	return layerType.Name()
+}
+
+// serialize wraps the JSON encoding of data
+func serialize(layerType string, data any) (*JSONLayer, error) {
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLayer{Type: layerType, Data: encodedData}, nil
+}
+
+// decodeInto returns a decoder that unmarshals into a new T and converts it with toLayer
+func decodeInto[T any](toLayer func(data *T) (Layer, error)) func(json.RawMessage) (Layer, error) {
+	return func(encodedData json.RawMessage) (Layer, error) {
+		data := new(T)
+		if err := json.Unmarshal(encodedData, data); err != nil {
+			return nil, err
+		}
+		return toLayer(data)
+	}
+}
+
+func activationFunctionName(activationFunction activationfunction.LayerActivationFunction) (feedforward.JSONActivationFunction, error) {
+	name, ok := activationfunction.Name(activationFunction)
+	if !ok {
+		return "", fmt.Errorf("activation function is not registered")
+	}
+	return feedforward.JSONActivationFunction(name), nil
+}
+
+func getActivationFunction(name feedforward.JSONActivationFunction) (activationfunction.LayerActivationFunction, error) {
+	activationFunction, ok := activationfunction.Get(string(name))
+	if !ok {
+		return nil, fmt.Errorf("unknown activation function %q", name)
+	}
+	return activationFunction, nil
+}
+
+// sumRows adds up the rows of matrix and divides them by scale
+func sumRows(matrix *mat.Dense, scale float64) *mat.VecDense {
+	numRows, numCols := matrix.Dims()
+	result := mat.NewVecDense(numCols, nil)
+	for i := 0; i < numRows; i++ {
+		result.AddVec(result, matrix.RowView(i))
+	}
+	result.ScaleVec(1/scale, result)
+	return result
+}
+
+// Dense is a fully connected layer followed by an activation function, the layer feedforward.Network stacks
+type Dense struct {
+	Weights            *mat.Dense //numOutputs x numInputs
+	Biases             *mat.VecDense
+	ActivationFunction activationfunction.LayerActivationFunction
+
+	inputs           *mat.Dense
+	beforeActivation *mat.Dense
+	weightGradient   *mat.Dense
+	biasGradient     *mat.VecDense
+}
+
+type jsonDense struct {
+	Weights            [][]float64
+	Biases             []float64
+	ActivationFunction feedforward.JSONActivationFunction
+}
+
+func NewDense(numInputs, numOutputs int, activationFunction activationfunction.LayerActivationFunction) *Dense {
+	return &Dense{Weights: mat.NewDense(numOutputs, numInputs, nil), Biases: mat.NewVecDense(numOutputs, nil), ActivationFunction: activationFunction}
+}
+
+// Initialize fills the weights and biases using the layer's fan-in and fan-out
+func (dense *Dense) Initialize(weightInitializer, biasInitializer feedforward.Initializer) {
+	numOutputs, numInputs := dense.Weights.Dims()
+	weightInitializer.Init(dense.Weights, numInputs, numOutputs)
+	biasInitializer.Init(mat.NewDense(numOutputs, 1, dense.Biases.RawVector().Data), numInputs, numOutputs)
+}
+
+func (dense *Dense) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	numOutputs, _ := dense.Weights.Dims()
+	dense.inputs = inputs
+	dense.beforeActivation = mat.NewDense(numSamples, numOutputs, nil)
+	dense.beforeActivation.Mul(inputs, dense.Weights.T())
+	bias := dense.Biases.RawVector().Data
+	for i := 0; i < numSamples; i++ {
+		row := dense.beforeActivation.RawRowView(i)
+		for j := range row {
+			row[j] += bias[j]
+		}
+	}
+	return activationfunction.EvalBatch(dense.ActivationFunction, dense.beforeActivation)
+}
+
+func (dense *Dense) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	grad = activationfunction.JacobianVectorProductBatch(dense.ActivationFunction, dense.beforeActivation, grad)
+	dense.weightGradient = &mat.Dense{}
+	dense.weightGradient.Mul(grad.T(), dense.inputs)
+	dense.weightGradient.Scale(1/float64(numSamples), dense.weightGradient)
+	dense.biasGradient = sumRows(grad, float64(numSamples))
+	result := &mat.Dense{}
+	result.Mul(grad, dense.Weights)
+	return result
+}
+
+func (dense *Dense) Params() [][]float64 {
+	return [][]float64{dense.Weights.RawMatrix().Data, dense.Biases.RawVector().Data}
+}
+
+func (dense *Dense) Grads() [][]float64 {
+	return [][]float64{dense.weightGradient.RawMatrix().Data, dense.biasGradient.RawVector().Data}
+}
+
+func (dense *Dense) Serialize() (*JSONLayer, error) {
+	activationFunction, err := activationFunctionName(dense.ActivationFunction)
+	if err != nil {
+		return nil, err
+	}
+	return serialize("dense", jsonDense{Weights: rows(dense.Weights), Biases: mat.Col(nil, 0, dense.Biases), ActivationFunction: activationFunction})
+}
+
+func decodeDense(data *jsonDense) (Layer, error) {
+	activationFunction, err := getActivationFunction(data.ActivationFunction)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Weights) == 0 || len(data.Weights) != len(data.Biases) {
+		return nil, fmt.Errorf("dense layer has %v rows of weights and %v biases", len(data.Weights), len(data.Biases))
+	}
+	if len(data.Weights[0]) == 0 {
+		return nil, fmt.Errorf("dense layer has no inputs")
+	}
+	dense := NewDense(len(data.Weights[0]), len(data.Weights), activationFunction)
+	for i, row := range data.Weights {
+		if len(row) != len(data.Weights[0]) {
+			return nil, fmt.Errorf("dense layer has rows of %v and %v weights", len(data.Weights[0]), len(row))
+		}
+		dense.Weights.SetRow(i, row)
+	}
+	dense.Biases = mat.NewVecDense(len(data.Biases), data.Biases)
+	return dense, nil
+}
+
+// Activation applies an activation function on its own, e.g. after a normalization or convolution
+type Activation struct {
+	ActivationFunction activationfunction.LayerActivationFunction
+
+	inputs *mat.Dense
+}
+
+type jsonActivation struct {
+	ActivationFunction feedforward.JSONActivationFunction
+}
+
+func NewActivation(activationFunction activationfunction.LayerActivationFunction) *Activation {
+	return &Activation{ActivationFunction: activationFunction}
+}
+
+func (activation *Activation) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	activation.inputs = inputs
+	return activationfunction.EvalBatch(activation.ActivationFunction, inputs)
+}
+
+func (activation *Activation) Backward(grad *mat.Dense) *mat.Dense {
+	return activationfunction.JacobianVectorProductBatch(activation.ActivationFunction, activation.inputs, grad)
+}
+
+func (activation *Activation) Params() [][]float64 {
+	return nil
+}
+
+func (activation *Activation) Grads() [][]float64 {
+	return nil
+}
+
+func (activation *Activation) Serialize() (*JSONLayer, error) {
+	activationFunction, err := activationFunctionName(activation.ActivationFunction)
+	if err != nil {
+		return nil, err
+	}
+	return serialize("activation", jsonActivation{ActivationFunction: activationFunction})
+}
+
+func decodeActivation(data *jsonActivation) (Layer, error) {
+	activationFunction, err := getActivationFunction(data.ActivationFunction)
+	if err != nil {
+		return nil, err
+	}
+	return NewActivation(activationFunction), nil
+}
+
+// Dropout zeroes each value with probability Rate while training and scales the rest up to keep the expected sum
+type Dropout struct {
+	Rate float64
+
+	mask *mat.Dense //nil if the last Forward wasn't training
+}
+
+type jsonDropout struct {
+	Rate float64
+}
+
+func NewDropout(rate float64) *Dropout {
+	return &Dropout{Rate: rate}
+}
+
+func (dropout *Dropout) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	dropout.mask = nil
+	if !training || dropout.Rate == 0 {
+		return inputs
+	}
+	numSamples, size := inputs.Dims()
+	dropout.mask = mat.NewDense(numSamples, size, nil)
+	dropout.mask.Apply(func(_, _ int, _ float64) float64 {
+		if random.RandomFloat64(0, 1) < dropout.Rate {
+			return 0
+		}
+		return 1 / (1 - dropout.Rate)
+	}, dropout.mask)
+	result := mat.NewDense(numSamples, size, nil)
+	result.MulElem(inputs, dropout.mask)
+	return result
+}
+
+func (dropout *Dropout) Backward(grad *mat.Dense) *mat.Dense {
+	if dropout.mask == nil {
+		return grad
+	}
+	result := &mat.Dense{}
+	result.MulElem(grad, dropout.mask)
+	return result
+}
+
+func (dropout *Dropout) Params() [][]float64 {
+	return nil
+}
+
+func (dropout *Dropout) Grads() [][]float64 {
+	return nil
+}
+
+func (dropout *Dropout) Serialize() (*JSONLayer, error) {
+	return serialize("dropout", jsonDropout{Rate: dropout.Rate})
+}
+
+// Normalization is a batch or layer normalization, see feedforward.Normalization
+type Normalization struct {
+	*feedforward.Normalization
+}
+
+func NewBatchNorm(size int, momentum float64) *Normalization {
+	return &Normalization{feedforward.NewBatchNorm(size, momentum)}
+}
+
+func NewLayerNorm(size int) *Normalization {
+	return &Normalization{feedforward.NewLayerNorm(size)}
+}
+
+func (normalization *Normalization) Serialize() (*JSONLayer, error) {
+	return serialize("normalization", normalization.ToJSONNormalization())
+}
+
+func init() {
+	Register("dense", decodeInto(decodeDense))
+	Register("activation", decodeInto(decodeActivation))
+	Register("dropout", decodeInto(func(data *jsonDropout) (Layer, error) {
+		if data.Rate < 0 || data.Rate >= 1 {
+			return nil, fmt.Errorf("dropout rate %v is outside [0, 1)", data.Rate)
+		}
+		return NewDropout(data.Rate), nil
+	}))
+	Register("normalization", decodeInto(func(data *feedforward.JSONNormalization) (Layer, error) {
+		normalization, err := data.ToNormalization()
+		if err != nil {
+			return nil, err
+		}
+		return &Normalization{normalization}, nil
+	}))
+}
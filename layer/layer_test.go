@@ -0,0 +1,77 @@
+package layer
+
+import (
+	"math"
+	"nn/loss"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// differentiable is what Sequential and Graph share for training
+type differentiable interface {
+	Forward(inputs *mat.Dense, training bool) *mat.Dense
+	Backward(grad *mat.Dense) *mat.Dense
+	Parameters() [][]float64
+	Gradients() [][]float64
+}
+
+// sinMatrix fills a matrix with deterministic values in [-1, 1]
+func sinMatrix(numRows, numCols int, seed float64) *mat.Dense {
+	result := mat.NewDense(numRows, numCols, nil)
+	result.Apply(func(i, j int, _ float64) float64 { return math.Sin(seed + float64(i*31+j*7)) }, result)
+	return result
+}
+
+// floatsClose reports whether a and b differ only by rounding
+func floatsClose(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-12*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// checkGradients compares the gradients of model's parameters, and of its inputs if checkInputs is set,
+// with central finite differences of lossFunction's batch average
+func checkGradients(t *testing.T, model differentiable, inputs, groundTruth *mat.Dense, lossFunction loss.Loss, checkInputs bool) {
+	t.Helper()
+	const epsilon, tolerance = 1e-6, 1e-6
+	cost := func() float64 {
+		return lossFunction.Eval(model.Forward(inputs, true), groundTruth)
+	}
+	numerical := func(value *float64) float64 {
+		original := *value
+		*value = original + epsilon
+		above := cost()
+		*value = original - epsilon
+		below := cost()
+		*value = original
+		return (above - below) / (2 * epsilon)
+	}
+
+	output := model.Forward(inputs, true)
+	inputGrads := model.Backward(lossFunction.Gradient(output, groundTruth))
+	grads := model.Gradients()
+	params := model.Parameters()
+	if len(grads) != len(params) {
+		t.Fatalf("%d gradients for %d parameters", len(grads), len(params))
+	}
+	for i := range params {
+		for j := range params[i] {
+			if want := numerical(&params[i][j]); math.Abs(grads[i][j]-want) > tolerance {
+				t.Errorf("parameter %d[%d]: gradient %g, finite differences give %g", i, j, grads[i][j], want)
+			}
+		}
+	}
+	if !checkInputs {
+		return
+	}
+	numSamples, numInputs := inputs.Dims()
+	raw := inputs.RawMatrix()
+	for i := 0; i < numSamples; i++ {
+		for j := 0; j < numInputs; j++ {
+			//the cost is averaged over the batch, but input gradients are per sample
+			want := numerical(&raw.Data[i*raw.Stride+j]) * float64(numSamples)
+			if got := inputGrads.At(i, j); math.Abs(got-want) > tolerance {
+				t.Errorf("input (%d, %d): gradient %g, finite differences give %g", i, j, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"nn/feedforward"
+	"nn/optimizer"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type CellType string
+
+const (
+	RNN  CellType = "rnn"  //h' = tanh(x Wx + h Wh + b)
+	GRU  CellType = "gru"  //update and reset gates, the candidate state sees the previous state through the reset gate
+	LSTM CellType = "lstm" //input, forget, cell and output gates with a separate cell state
+)
+
+func (cellType CellType) numGates() int {
+	switch cellType {
+	case RNN:
+		return 1
+	case GRU:
+		return 3
+	case LSTM:
+		return 4
+	}
+	panic(fmt.Sprintf("unknown cell type %q", cellType))
+}
+
+// Recurrent runs a cell over a sequence. Each sample holds SequenceLength steps of InputSize values one after another,
+// and the output holds the hidden state of every step the same way, or only the last one.
+// The gates of a cell are stacked in the weight matrices, in the order given on CellType.
+type Recurrent struct {
+	Cell            CellType
+	InputSize       int
+	HiddenSize      int
+	ReturnSequences bool //output every step's hidden state instead of only the last one
+	TruncateSteps   int  //if positive, gradients only flow back through this many steps, in chunks from the start of the sequence
+
+	InputWeights     *mat.Dense    //(numGates * HiddenSize) x InputSize
+	RecurrentWeights *mat.Dense    //(numGates * HiddenSize) x HiddenSize
+	Biases           *mat.VecDense //numGates * HiddenSize
+	RecurrentBiases  *mat.VecDense //GRU only, added to the recurrent part of each gate so the reset gate can scale it
+
+	steps                   []*recurrentStep //of the last Forward
+	inputWeightGradient     *mat.Dense
+	recurrentWeightGradient *mat.Dense
+	biasGradient            *mat.VecDense
+	recurrentBiasGradient   *mat.VecDense
+}
+
+// recurrentStep is what Backward needs from one step of Forward, every matrix numSamples wide
+type recurrentStep struct {
+	inputs        *mat.Dense
+	prevHidden    *mat.Dense
+	prevCell      *mat.Dense
+	gates         *mat.Dense //after their activation functions
+	recurrentPart *mat.Dense //GRU only, prevHidden RecurrentWeights^T + RecurrentBiases before gating
+	hidden        *mat.Dense
+	cell          *mat.Dense
+}
+
+type jsonRecurrent struct {
+	Cell             CellType
+	InputSize        int
+	HiddenSize       int
+	ReturnSequences  bool
+	TruncateSteps    int
+	InputWeights     [][]float64
+	RecurrentWeights [][]float64
+	Biases           []float64
+	RecurrentBiases  []float64 `json:",omitempty"`
+}
+
+func NewRecurrent(cell CellType, inputSize, hiddenSize int, returnSequences bool, truncateSteps int) *Recurrent {
+	numGates := cell.numGates()
+	recurrent := &Recurrent{
+		Cell:             cell,
+		InputSize:        inputSize,
+		HiddenSize:       hiddenSize,
+		ReturnSequences:  returnSequences,
+		TruncateSteps:    truncateSteps,
+		InputWeights:     mat.NewDense(numGates*hiddenSize, inputSize, nil),
+		RecurrentWeights: mat.NewDense(numGates*hiddenSize, hiddenSize, nil),
+		Biases:           mat.NewVecDense(numGates*hiddenSize, nil),
+	}
+	if cell == GRU {
+		recurrent.RecurrentBiases = mat.NewVecDense(numGates*hiddenSize, nil)
+	}
+	return recurrent
+}
+
+func NewRNN(inputSize, hiddenSize int, returnSequences bool, truncateSteps int) *Recurrent {
+	return NewRecurrent(RNN, inputSize, hiddenSize, returnSequences, truncateSteps)
+}
+
+func NewGRU(inputSize, hiddenSize int, returnSequences bool, truncateSteps int) *Recurrent {
+	return NewRecurrent(GRU, inputSize, hiddenSize, returnSequences, truncateSteps)
+}
+
+func NewLSTM(inputSize, hiddenSize int, returnSequences bool, truncateSteps int) *Recurrent {
+	return NewRecurrent(LSTM, inputSize, hiddenSize, returnSequences, truncateSteps)
+}
+
+// Initialize fills the weights of each gate with a fan-in of InputSize or HiddenSize and a fan-out of HiddenSize.
+// Orthogonal recurrent weights are the usual choice.
+func (recurrent *Recurrent) Initialize(inputInitializer, recurrentInitializer, biasInitializer feedforward.Initializer) {
+	numGates := recurrent.Cell.numGates()
+	inputInitializer.Init(recurrent.InputWeights, recurrent.InputSize, recurrent.HiddenSize)
+	recurrentInitializer.Init(recurrent.RecurrentWeights, recurrent.HiddenSize, recurrent.HiddenSize)
+	biasInitializer.Init(mat.NewDense(numGates*recurrent.HiddenSize, 1, recurrent.Biases.RawVector().Data), recurrent.InputSize, recurrent.HiddenSize)
+	if recurrent.RecurrentBiases != nil {
+		biasInitializer.Init(mat.NewDense(numGates*recurrent.HiddenSize, 1, recurrent.RecurrentBiases.RawVector().Data), recurrent.HiddenSize, recurrent.HiddenSize)
+	}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// affine computes x weights^T + biases
+func affine(x, weights *mat.Dense, biases *mat.VecDense) *mat.Dense {
+	result := &mat.Dense{}
+	result.Mul(x, weights.T())
+	if biases != nil {
+		bias := biases.RawVector().Data
+		numSamples, _ := result.Dims()
+		for i := 0; i < numSamples; i++ {
+			row := result.RawRowView(i)
+			for j := range row {
+				row[j] += bias[j]
+			}
+		}
+	}
+	return result
+}
+
+// step runs the cell on one step of a batch
+func (recurrent *Recurrent) step(inputs, prevHidden, prevCell *mat.Dense) *recurrentStep {
+	numSamples, _ := inputs.Dims()
+	size := recurrent.HiddenSize
+	step := &recurrentStep{inputs: inputs, prevHidden: prevHidden, prevCell: prevCell}
+	step.hidden = mat.NewDense(numSamples, size, nil)
+	step.gates = affine(inputs, recurrent.InputWeights, recurrent.Biases)
+	if recurrent.Cell == GRU {
+		step.recurrentPart = affine(prevHidden, recurrent.RecurrentWeights, recurrent.RecurrentBiases)
+	} else {
+		step.gates.Add(step.gates, affine(prevHidden, recurrent.RecurrentWeights, nil))
+	}
+	for i := 0; i < numSamples; i++ {
+		gates := step.gates.RawRowView(i)
+		hidden := step.hidden.RawRowView(i)
+		prev := prevHidden.RawRowView(i)
+		switch recurrent.Cell {
+		case RNN:
+			for j := range hidden {
+				gates[j] = math.Tanh(gates[j])
+				hidden[j] = gates[j]
+			}
+		case GRU:
+			recurrentPart := step.recurrentPart.RawRowView(i)
+			for j := range hidden {
+				update := sigmoid(gates[j] + recurrentPart[j])
+				reset := sigmoid(gates[size+j] + recurrentPart[size+j])
+				candidate := math.Tanh(gates[2*size+j] + reset*recurrentPart[2*size+j])
+				gates[j], gates[size+j], gates[2*size+j] = update, reset, candidate
+				hidden[j] = (1-update)*candidate + update*prev[j]
+			}
+		case LSTM:
+			if step.cell == nil {
+				step.cell = mat.NewDense(numSamples, size, nil)
+			}
+			cell := step.cell.RawRowView(i)
+			prevCellRow := prevCell.RawRowView(i)
+			for j := range hidden {
+				input := sigmoid(gates[j])
+				forget := sigmoid(gates[size+j])
+				candidate := math.Tanh(gates[2*size+j])
+				output := sigmoid(gates[3*size+j])
+				gates[j], gates[size+j], gates[2*size+j], gates[3*size+j] = input, forget, candidate, output
+				cell[j] = forget*prevCellRow[j] + input*candidate
+				hidden[j] = output * math.Tanh(cell[j])
+			}
+		}
+	}
+	return step
+}
+
+func (recurrent *Recurrent) sequenceLength(inputs *mat.Dense) int {
+	_, numValues := inputs.Dims()
+	if numValues%recurrent.InputSize != 0 {
+		panic(fmt.Sprintf("samples of %v values can't be split into steps of %v", numValues, recurrent.InputSize))
+	}
+	return numValues / recurrent.InputSize
+}
+
+func (recurrent *Recurrent) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, _ := inputs.Dims()
+	sequenceLength := recurrent.sequenceLength(inputs)
+	size := recurrent.HiddenSize
+	hidden := mat.NewDense(numSamples, size, nil)
+	cell := mat.NewDense(numSamples, size, nil)
+	recurrent.steps = make([]*recurrentStep, sequenceLength)
+	result := mat.NewDense(numSamples, size, nil)
+	if recurrent.ReturnSequences {
+		result = mat.NewDense(numSamples, sequenceLength*size, nil)
+	}
+	for t := 0; t < sequenceLength; t++ {
+		stepInputs := mat.DenseCopyOf(inputs.Slice(0, numSamples, t*recurrent.InputSize, (t+1)*recurrent.InputSize))
+		recurrent.steps[t] = recurrent.step(stepInputs, hidden, cell)
+		hidden, cell = recurrent.steps[t].hidden, recurrent.steps[t].cell
+		if recurrent.ReturnSequences {
+			result.Slice(0, numSamples, t*size, (t+1)*size).(*mat.Dense).Copy(hidden)
+		}
+	}
+	if !recurrent.ReturnSequences {
+		result.Copy(hidden)
+	}
+	return result
+}
+
+func (recurrent *Recurrent) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	sequenceLength := len(recurrent.steps)
+	size := recurrent.HiddenSize
+	numGates := recurrent.Cell.numGates()
+	recurrent.inputWeightGradient = mat.NewDense(numGates*size, recurrent.InputSize, nil)
+	recurrent.recurrentWeightGradient = mat.NewDense(numGates*size, size, nil)
+	recurrent.biasGradient = mat.NewVecDense(numGates*size, nil)
+	if recurrent.Cell == GRU {
+		recurrent.recurrentBiasGradient = mat.NewVecDense(numGates*size, nil)
+	}
+	result := mat.NewDense(numSamples, sequenceLength*recurrent.InputSize, nil)
+
+	hiddenGradient := mat.NewDense(numSamples, size, nil)
+	cellGradient := mat.NewDense(numSamples, size, nil)
+	for t := sequenceLength - 1; t >= 0; t-- {
+		step := recurrent.steps[t]
+		if recurrent.ReturnSequences {
+			hiddenGradient.Add(hiddenGradient, grad.Slice(0, numSamples, t*size, (t+1)*size))
+		} else if t == sequenceLength-1 {
+			hiddenGradient.Add(hiddenGradient, grad)
+		}
+
+		//gradients with respect to the gates before their activation functions, split into the input and recurrent parts for GRU
+		gatesGradient := mat.NewDense(numSamples, numGates*size, nil)
+		recurrentPartGradient := gatesGradient
+		if recurrent.Cell == GRU {
+			recurrentPartGradient = mat.NewDense(numSamples, numGates*size, nil)
+		}
+		prevHiddenGradient := mat.NewDense(numSamples, size, nil) //besides the part through RecurrentWeights
+		prevCellGradient := mat.NewDense(numSamples, size, nil)
+		for i := 0; i < numSamples; i++ {
+			gates := step.gates.RawRowView(i)
+			dGates := gatesGradient.RawRowView(i)
+			dHidden := hiddenGradient.RawRowView(i)
+			switch recurrent.Cell {
+			case RNN:
+				for j := 0; j < size; j++ {
+					dGates[j] = dHidden[j] * (1 - gates[j]*gates[j])
+				}
+			case GRU:
+				prev := step.prevHidden.RawRowView(i)
+				recurrentPart := step.recurrentPart.RawRowView(i)
+				dRecurrentPart := recurrentPartGradient.RawRowView(i)
+				dPrevHidden := prevHiddenGradient.RawRowView(i)
+				for j := 0; j < size; j++ {
+					update, reset, candidate := gates[j], gates[size+j], gates[2*size+j]
+					dCandidate := dHidden[j] * (1 - update) * (1 - candidate*candidate)
+					dUpdate := dHidden[j] * (prev[j] - candidate) * update * (1 - update)
+					dReset := dCandidate * recurrentPart[2*size+j] * reset * (1 - reset)
+					dGates[j], dGates[size+j], dGates[2*size+j] = dUpdate, dReset, dCandidate
+					dRecurrentPart[j], dRecurrentPart[size+j], dRecurrentPart[2*size+j] = dUpdate, dReset, dCandidate*reset
+					dPrevHidden[j] = dHidden[j] * update
+				}
+			case LSTM:
+				cell := step.cell.RawRowView(i)
+				prevCell := step.prevCell.RawRowView(i)
+				dCellNext := cellGradient.RawRowView(i)
+				dPrevCell := prevCellGradient.RawRowView(i)
+				for j := 0; j < size; j++ {
+					input, forget, candidate, output := gates[j], gates[size+j], gates[2*size+j], gates[3*size+j]
+					tanhCell := math.Tanh(cell[j])
+					dCell := dCellNext[j] + dHidden[j]*output*(1-tanhCell*tanhCell)
+					dGates[j] = dCell * candidate * input * (1 - input)
+					dGates[size+j] = dCell * prevCell[j] * forget * (1 - forget)
+					dGates[2*size+j] = dCell * input * (1 - candidate*candidate)
+					dGates[3*size+j] = dHidden[j] * tanhCell * output * (1 - output)
+					dPrevCell[j] = dCell * forget
+				}
+			}
+		}
+
+		weightGradient := &mat.Dense{}
+		weightGradient.Mul(gatesGradient.T(), step.inputs)
+		recurrent.inputWeightGradient.Add(recurrent.inputWeightGradient, weightGradient)
+		weightGradient = &mat.Dense{}
+		weightGradient.Mul(recurrentPartGradient.T(), step.prevHidden)
+		recurrent.recurrentWeightGradient.Add(recurrent.recurrentWeightGradient, weightGradient)
+		recurrent.biasGradient.AddVec(recurrent.biasGradient, sumRows(gatesGradient, 1))
+		if recurrent.Cell == GRU {
+			recurrent.recurrentBiasGradient.AddVec(recurrent.recurrentBiasGradient, sumRows(recurrentPartGradient, 1))
+		}
+
+		inputGradient := &mat.Dense{}
+		inputGradient.Mul(gatesGradient, recurrent.InputWeights)
+		result.Slice(0, numSamples, t*recurrent.InputSize, (t+1)*recurrent.InputSize).(*mat.Dense).Copy(inputGradient)
+
+		hiddenGradient = &mat.Dense{}
+		hiddenGradient.Mul(recurrentPartGradient, recurrent.RecurrentWeights)
+		hiddenGradient.Add(hiddenGradient, prevHiddenGradient)
+		cellGradient = prevCellGradient
+		if recurrent.TruncateSteps > 0 && t%recurrent.TruncateSteps == 0 {
+			hiddenGradient.Zero()
+			cellGradient.Zero()
+		}
+	}
+	recurrent.inputWeightGradient.Scale(1/float64(numSamples), recurrent.inputWeightGradient)
+	recurrent.recurrentWeightGradient.Scale(1/float64(numSamples), recurrent.recurrentWeightGradient)
+	recurrent.biasGradient.ScaleVec(1/float64(numSamples), recurrent.biasGradient)
+	if recurrent.Cell == GRU {
+		recurrent.recurrentBiasGradient.ScaleVec(1/float64(numSamples), recurrent.recurrentBiasGradient)
+	}
+	return result
+}
+
+func (recurrent *Recurrent) Params() [][]float64 {
+	params := [][]float64{recurrent.InputWeights.RawMatrix().Data, recurrent.RecurrentWeights.RawMatrix().Data, recurrent.Biases.RawVector().Data}
+	if recurrent.RecurrentBiases != nil {
+		params = append(params, recurrent.RecurrentBiases.RawVector().Data)
+	}
+	return params
+}
+
+func (recurrent *Recurrent) Grads() [][]float64 {
+	grads := [][]float64{recurrent.inputWeightGradient.RawMatrix().Data, recurrent.recurrentWeightGradient.RawMatrix().Data, recurrent.biasGradient.RawVector().Data}
+	if recurrent.recurrentBiasGradient != nil {
+		grads = append(grads, recurrent.recurrentBiasGradient.RawVector().Data)
+	}
+	return grads
+}
+
+func rows(matrix *mat.Dense) [][]float64 {
+	numRows, _ := matrix.Dims()
+	result := make([][]float64, numRows)
+	for i := range result {
+		result[i] = mat.Row(nil, i, matrix)
+	}
+	return result
+}
+
+// setRows copies values into matrix, checking their shape
+func setRows(matrix *mat.Dense, values [][]float64) error {
+	numRows, numCols := matrix.Dims()
+	if len(values) != numRows {
+		return fmt.Errorf("expected %v rows, got %v", numRows, len(values))
+	}
+	for i, row := range values {
+		if len(row) != numCols {
+			return fmt.Errorf("expected rows of %v values, got %v", numCols, len(row))
+		}
+		matrix.SetRow(i, row)
+	}
+	return nil
+}
+
+func (recurrent *Recurrent) Serialize() (*JSONLayer, error) {
+	return serialize("recurrent", jsonRecurrent{
+		Cell:             recurrent.Cell,
+		InputSize:        recurrent.InputSize,
+		HiddenSize:       recurrent.HiddenSize,
+		ReturnSequences:  recurrent.ReturnSequences,
+		TruncateSteps:    recurrent.TruncateSteps,
+		InputWeights:     rows(recurrent.InputWeights),
+		RecurrentWeights: rows(recurrent.RecurrentWeights),
+		Biases:           rawOrNil(recurrent.Biases),
+		RecurrentBiases:  rawOrNil(recurrent.RecurrentBiases),
+	})
+}
+
+func rawOrNil(vec *mat.VecDense) []float64 {
+	if vec == nil {
+		return nil
+	}
+	return mat.Col(nil, 0, vec)
+}
+
+func decodeRecurrent(data *jsonRecurrent) (Layer, error) {
+	if data.Cell != RNN && data.Cell != GRU && data.Cell != LSTM {
+		return nil, fmt.Errorf("unknown cell type %q", data.Cell)
+	}
+	if data.InputSize < 1 || data.HiddenSize < 1 {
+		return nil, fmt.Errorf("recurrent layer needs positive input and hidden sizes")
+	}
+	recurrent := NewRecurrent(data.Cell, data.InputSize, data.HiddenSize, data.ReturnSequences, data.TruncateSteps)
+	if err := setRows(recurrent.InputWeights, data.InputWeights); err != nil {
+		return nil, fmt.Errorf("input weights: %w", err)
+	}
+	if err := setRows(recurrent.RecurrentWeights, data.RecurrentWeights); err != nil {
+		return nil, fmt.Errorf("recurrent weights: %w", err)
+	}
+	if len(data.Biases) != recurrent.Biases.Len() {
+		return nil, fmt.Errorf("expected %v biases, got %v", recurrent.Biases.Len(), len(data.Biases))
+	}
+	recurrent.Biases = mat.NewVecDense(len(data.Biases), data.Biases)
+	if recurrent.RecurrentBiases != nil {
+		if len(data.RecurrentBiases) != recurrent.RecurrentBiases.Len() {
+			return nil, fmt.Errorf("expected %v recurrent biases, got %v", recurrent.RecurrentBiases.Len(), len(data.RecurrentBiases))
+		}
+		recurrent.RecurrentBiases = mat.NewVecDense(len(data.RecurrentBiases), data.RecurrentBiases)
+	}
+	return recurrent, nil
+}
+
+// TimeDistributed applies Layer to every step of a sequence separately, e.g. a Dense layer to each hidden state of a Recurrent layer
+type TimeDistributed struct {
+	Layer    Layer
+	StepSize int //number of values in each step of the input
+
+	numSteps int //rows given to Layer by the last Forward
+}
+
+type jsonTimeDistributed struct {
+	Layer    *JSONLayer
+	StepSize int
+}
+
+func NewTimeDistributed(layer Layer, stepSize int) *TimeDistributed {
+	return &TimeDistributed{Layer: layer, StepSize: stepSize}
+}
+
+// reshape views matrix's values as numRows rows
+func reshape(matrix *mat.Dense, numRows int) *mat.Dense {
+	numSamples, numValues := matrix.Dims()
+	return mat.NewDense(numRows, numSamples*numValues/numRows, mat.DenseCopyOf(matrix).RawMatrix().Data)
+}
+
+func (timeDistributed *TimeDistributed) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	numSamples, numValues := inputs.Dims()
+	if numValues%timeDistributed.StepSize != 0 {
+		panic(fmt.Sprintf("samples of %v values can't be split into steps of %v", numValues, timeDistributed.StepSize))
+	}
+	timeDistributed.numSteps = numSamples * numValues / timeDistributed.StepSize
+	outputs := timeDistributed.Layer.Forward(reshape(inputs, timeDistributed.numSteps), training)
+	return reshape(outputs, numSamples)
+}
+
+// Backward scales the gradients kept by Layer back up, since Layer averages over every step of every sample
+func (timeDistributed *TimeDistributed) Backward(grad *mat.Dense) *mat.Dense {
+	numSamples, _ := grad.Dims()
+	inputGradient := timeDistributed.Layer.Backward(reshape(grad, timeDistributed.numSteps))
+	for _, stepGrad := range timeDistributed.Layer.Grads() {
+		for i := range stepGrad {
+			stepGrad[i] *= float64(timeDistributed.numSteps) / float64(numSamples)
+		}
+	}
+	return reshape(inputGradient, numSamples)
+}
+
+func (timeDistributed *TimeDistributed) Params() [][]float64 {
+	return timeDistributed.Layer.Params()
+}
+
+func (timeDistributed *TimeDistributed) Grads() [][]float64 {
+	return timeDistributed.Layer.Grads()
+}
+
+func (timeDistributed *TimeDistributed) SparseGrads() []*optimizer.SparseGradient {
+	return sparseGrads(timeDistributed.Layer)
+}
+
+func (timeDistributed *TimeDistributed) Serialize() (*JSONLayer, error) {
+	jsonLayer, err := timeDistributed.Layer.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return serialize("timeDistributed", jsonTimeDistributed{Layer: jsonLayer, StepSize: timeDistributed.StepSize})
+}
+
+func init() {
+	Register("recurrent", decodeInto(decodeRecurrent))
+	Register("timeDistributed", decodeInto(func(data *jsonTimeDistributed) (Layer, error) {
+		if data.Layer == nil || data.StepSize < 1 {
+			return nil, fmt.Errorf("time distributed layer needs a layer and a positive step size")
+		}
+		currLayer, err := data.Layer.ToLayer()
+		if err != nil {
+			return nil, err
+		}
+		return NewTimeDistributed(currLayer, data.StepSize), nil
+	}))
+}
@@ -0,0 +1,30 @@
+package layer
+
+import (
+	"fmt"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"testing"
+)
+
+func TestRecurrentGradients(t *testing.T) {
+	const numSteps, inputSize, hiddenSize = 5, 2, 4
+	for _, cell := range []CellType{RNN, GRU, LSTM} {
+		for _, returnSequences := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%v returnSequences=%v", cell, returnSequences), func(t *testing.T) {
+				recurrent := NewRecurrent(cell, inputSize, hiddenSize, returnSequences, 0)
+				recurrent.Initialize(feedforward.XavierNormal, feedforward.Orthogonal, feedforward.TruncatedNormal)
+				sequential := NewSequential(recurrent)
+				groundTruth := sinMatrix(3, hiddenSize, 1)
+				if returnSequences {
+					dense := NewDense(hiddenSize, 3, activationfunction.Tanh)
+					dense.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+					sequential = NewSequential(recurrent, NewTimeDistributed(dense, hiddenSize))
+					groundTruth = sinMatrix(3, numSteps*3, 1)
+				}
+				checkGradients(t, sequential, sinMatrix(3, numSteps*inputSize, 0), groundTruth, loss.SquaredError, true)
+			})
+		}
+	}
+}
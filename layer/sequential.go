@@ -0,0 +1,233 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"nn/model"
+	"nn/optimizer"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Sequential runs its layers one after another
+type Sequential struct {
+	Layers []Layer
+	Loss   loss.Loss //the loss the model was trained with, may be nil
+}
+
+type JSONSequential struct {
+	Layers []*JSONLayer
+	Loss   string
+}
+
+func NewSequential(layers ...Layer) *Sequential {
+	return &Sequential{Layers: layers}
+}
+
+// FromNetwork turns each layer of a feedforward network into a Dropout, Dense, Normalization and Activation layer as needed.
+// The network's parameters are copied.
+func FromNetwork(network *feedforward.Network) *Sequential {
+	network = network.Copy()
+	sequential := &Sequential{Loss: network.Loss}
+	for i := 0; i < network.NumLayers-1; i++ {
+		if i < len(network.DropoutRates) && network.DropoutRates[i] > 0 {
+			sequential.Layers = append(sequential.Layers, NewDropout(network.DropoutRates[i]))
+		}
+		dense := &Dense{Weights: network.Weights[i], Biases: network.Biases[i], ActivationFunction: network.ActivationFunctions[i]}
+		sequential.Layers = append(sequential.Layers, dense)
+		if i < len(network.Normalizations) && network.Normalizations[i] != nil {
+			dense.ActivationFunction = activationfunction.Identity
+			sequential.Layers = append(sequential.Layers, &Normalization{network.Normalizations[i]}, NewActivation(network.ActivationFunctions[i]))
+		}
+	}
+	return sequential
+}
+
+func (sequential *Sequential) ToJSONSequential() (*JSONSequential, error) {
+	jsonSequential := &JSONSequential{}
+	for i, currLayer := range sequential.Layers {
+		jsonLayer, err := currLayer.Serialize()
+		if err != nil {
+			return nil, fmt.Errorf("layer %v: %w", i, err)
+		}
+		jsonSequential.Layers = append(jsonSequential.Layers, jsonLayer)
+	}
+	if sequential.Loss != nil {
+		jsonSequential.Loss = sequential.Loss.Name()
+	}
+	return jsonSequential, nil
+}
+
+// getLoss returns the loss with a saved name, or nil if no loss was saved
+func getLoss(name string) (loss.Loss, error) {
+	if name == "" {
+		return nil, nil
+	}
+	lossFunction, ok := loss.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown loss %q", name)
+	}
+	return lossFunction, nil
+}
+
+func (jsonSequential *JSONSequential) ToSequential() (*Sequential, error) {
+	lossFunction, err := getLoss(jsonSequential.Loss)
+	if err != nil {
+		return nil, err
+	}
+	sequential := &Sequential{Loss: lossFunction}
+	for i, jsonLayer := range jsonSequential.Layers {
+		currLayer, err := jsonLayer.ToLayer()
+		if err != nil {
+			return nil, fmt.Errorf("layer %v: %w", i, err)
+		}
+		sequential.Layers = append(sequential.Layers, currLayer)
+	}
+	return sequential, nil
+}
+
+func (sequential *Sequential) MarshalJSON() ([]byte, error) {
+	jsonSequential, err := sequential.ToJSONSequential()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonSequential)
+}
+
+// hasField reports whether the JSON object in data has field, which tells the encoded models apart
+func hasField(data []byte, field string) (bool, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false, err
+	}
+	_, ok := fields[field]
+	return ok, nil
+}
+
+// isNetwork reports whether data holds a feedforward.JSONNetwork rather than a JSONSequential
+func isNetwork(data []byte) (bool, error) {
+	return hasField(data, "LayerSizes")
+}
+
+// Decode reads a JSONSequential, or a feedforward.JSONNetwork which it converts with FromNetwork.
+// Graphs and documents without layers are rejected rather than read as an empty model.
+func Decode(data []byte) (*Sequential, error) {
+	network, err := isNetwork(data)
+	if err != nil {
+		return nil, err
+	}
+	if network {
+		network, err := feedforward.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return FromNetwork(network), nil
+	}
+	if graph, _ := hasField(data, "Nodes"); graph {
+		return nil, fmt.Errorf("model is a graph, not a sequential model, see DecodeModel")
+	}
+	jsonSequential := &JSONSequential{}
+	if err := json.Unmarshal(data, jsonSequential); err != nil {
+		return nil, err
+	}
+	if len(jsonSequential.Layers) == 0 {
+		return nil, fmt.Errorf("sequential model has no layers")
+	}
+	return jsonSequential.ToSequential()
+}
+
+// DecodeModel reads a feedforward.JSONNetwork as a feedforward.Network, a JSONGraph as a Graph and a JSONSequential as a Sequential
+func DecodeModel(data []byte) (model.Model, error) {
+	network, err := isNetwork(data)
+	if err != nil {
+		return nil, err
+	}
+	if network {
+		return feedforward.Decode(data)
+	}
+	if graph, _ := hasField(data, "Nodes"); graph {
+		return DecodeGraph(data)
+	}
+	return Decode(data)
+}
+
+func (sequential *Sequential) Forward(inputs *mat.Dense, training bool) *mat.Dense {
+	for _, currLayer := range sequential.Layers {
+		inputs = currLayer.Forward(inputs, training)
+	}
+	return inputs
+}
+
+// Backward backpropagates the gradients of the batch's summed cost with respect to the last Forward's outputs through every layer
+func (sequential *Sequential) Backward(grad *mat.Dense) *mat.Dense {
+	for i := len(sequential.Layers) - 1; i >= 0; i-- {
+		grad = sequential.Layers[i].Backward(grad)
+	}
+	return grad
+}
+
+func (sequential *Sequential) Predict(inputs *mat.Dense) *mat.Dense {
+	return sequential.Forward(inputs, false)
+}
+
+// Run runs a single sample in inference mode
+func (sequential *Sequential) Run(inputs *mat.VecDense) *mat.VecDense {
+	output := sequential.Predict(mat.NewDense(1, inputs.Len(), mat.Col(nil, 0, inputs)))
+	return mat.VecDenseCopyOf(output.RowView(0))
+}
+
+func (sequential *Sequential) Parameters() [][]float64 {
+	result := [][]float64{}
+	for _, currLayer := range sequential.Layers {
+		result = append(result, currLayer.Params()...)
+	}
+	return result
+}
+
+// Gradients lists the gradients kept by the last Backward in the order of Parameters
+func (sequential *Sequential) Gradients() [][]float64 {
+	result := [][]float64{}
+	for _, currLayer := range sequential.Layers {
+		result = append(result, currLayer.Grads()...)
+	}
+	return result
+}
+
+// SparseGradients lists which rows the last Backward touched for the parameters of SparseLayers, in the order of Parameters.
+// Other parameters have nil entries.
+func (sequential *Sequential) SparseGradients() []*optimizer.SparseGradient {
+	result := []*optimizer.SparseGradient{}
+	for _, currLayer := range sequential.Layers {
+		result = append(result, sparseGrads(currLayer)...)
+	}
+	return result
+}
+
+// LearnBatch takes one optimizer step on a batch and returns its average cost.
+// Parameters of SparseLayers only have the rows the batch used updated.
+func (sequential *Sequential) LearnBatch(inputs, groundTruth *mat.Dense, lossFunction loss.Loss, opt optimizer.Optimizer) (float64, *mat.Dense) {
+	output := sequential.Forward(inputs, true)
+	sequential.Backward(lossFunction.Gradient(output, groundTruth))
+	opt.UpdateSparse(sequential.Parameters(), sequential.Gradients(), sequential.SparseGradients())
+	return lossFunction.Eval(output, groundTruth), output
+}
+
+// Copy fails for models with layers that can't be serialized
+func (sequential *Sequential) Copy() (*Sequential, error) {
+	jsonSequential, err := sequential.ToJSONSequential()
+	if err != nil {
+		return nil, err
+	}
+	return jsonSequential.ToSequential()
+}
+
+func (sequential *Sequential) Clone() (model.Model, error) {
+	return sequential.Copy()
+}
+
+func (sequential *Sequential) SetLoss(lossFunction loss.Loss) {
+	sequential.Loss = lossFunction
+}
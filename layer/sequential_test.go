@@ -0,0 +1,110 @@
+package layer
+
+import (
+	"encoding/json"
+	"nn/activationfunction"
+	"nn/feedforward"
+	"nn/loss"
+	"nn/optimizer"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSequentialGradients(t *testing.T) {
+	dense1 := NewDense(3, 6, activationfunction.Identity)
+	dense1.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+	norm := NewBatchNorm(6, 0.1)
+	norm.Gamma.SetVec(1, 1.7)
+	dense2 := NewDense(6, 5, activationfunction.Sigmoid)
+	dense2.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+	layerNorm := NewLayerNorm(5)
+	layerNorm.Beta.SetVec(2, 0.3)
+	dense3 := NewDense(5, 2, activationfunction.Softmax)
+	dense3.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+	sequential := NewSequential(dense1, norm, NewActivation(activationfunction.Tanh), dense2, layerNorm, dense3)
+
+	groundTruth := mat.NewDense(4, 2, []float64{1, 0, 0, 1, 1, 0, 0, 1})
+	checkGradients(t, sequential, sinMatrix(4, 3, 0), groundTruth, loss.CategoricalCrossEntropy, true)
+}
+
+func TestFromNetworkTrainsLikeNetwork(t *testing.T) {
+	network := feedforward.NewNetwork([]int{3, 6, 5, 2}, []activationfunction.LayerActivationFunction{activationfunction.Tanh, activationfunction.Sigmoid, activationfunction.Softmax})
+	network.Randomize(-1, 1, -1, 1)
+	network.Normalizations = []*feedforward.Normalization{feedforward.NewBatchNorm(6, 0.1)}
+	sequential := FromNetwork(network)
+	inputs := sinMatrix(4, 3, 0)
+	groundTruth := mat.NewDense(4, 2, []float64{1, 0, 0, 1, 1, 0, 0, 1})
+	for i := 0; i < 5; i++ {
+		networkCost, _ := network.LearnBatch(inputs, groundTruth, loss.CategoricalCrossEntropy, optimizer.NewSGD(0.3))
+		sequentialCost, _ := sequential.LearnBatch(inputs, groundTruth, loss.CategoricalCrossEntropy, optimizer.NewSGD(0.3))
+		if !floatsClose(networkCost, sequentialCost) {
+			t.Fatalf("step %d: network cost %g, sequential cost %g", i, networkCost, sequentialCost)
+		}
+	}
+	if !mat.EqualApprox(network.Predict(inputs), sequential.Predict(inputs), 1e-12) {
+		t.Errorf("predictions differ after training:\n%v\n%v", mat.Formatted(network.Predict(inputs)), mat.Formatted(sequential.Predict(inputs)))
+	}
+}
+
+func TestSequentialRoundTrip(t *testing.T) {
+	dense := NewDense(3, 2, activationfunction.Softmax)
+	dense.Initialize(feedforward.XavierNormal, feedforward.TruncatedNormal)
+	sequential := NewSequential(NewDropout(0.2), dense, NewBatchNorm(2, 0.1), NewActivation(activationfunction.ReLU))
+	sequential.Loss = loss.CategoricalCrossEntropy
+	encoded, err := json.Marshal(sequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reencoded) != string(encoded) {
+		t.Errorf("re-encoding gave\n%s\nwant\n%s", reencoded, encoded)
+	}
+	inputs := sinMatrix(4, 3, 0)
+	if !mat.Equal(decoded.Predict(inputs), sequential.Predict(inputs)) {
+		t.Error("decoded model predicts differently")
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	documents := map[string]string{
+		"no layers":          `{"Layers":[]}`,
+		"graph":              `{"Inputs":[{"Name":"a","Size":1}],"Nodes":[],"Outputs":["a"]}`,
+		"unknown layer type": `{"Layers":[{"Type":"nope","Data":{}}]}`,
+		"unknown activation": `{"Layers":[{"Type":"dense","Data":{"Weights":[[1]],"Biases":[0],"ActivationFunction":"nope"}}]}`,
+		"ragged weights":     `{"Layers":[{"Type":"dense","Data":{"Weights":[[1],[1,2]],"Biases":[0,0],"ActivationFunction":"relu"}}]}`,
+		"bad dropout rate":   `{"Layers":[{"Type":"dropout","Data":{"Rate":1}}]}`,
+		"no inputs":          `{"Layers":[{"Type":"dense","Data":{"Weights":[[]],"Biases":[0],"ActivationFunction":"relu"}}]}`,
+		"unknown loss":       `{"Layers":[{"Type":"activation","Data":{"ActivationFunction":"relu"}}],"Loss":"squaredEror"}`,
+	}
+	for name, document := range documents {
+		if _, err := Decode([]byte(document)); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
+
+func TestUnregisteredActivationFunction(t *testing.T) {
+	dense := NewDense(3, 2, activationfunction.NewLeakyReLU(0.2))
+	sequential := NewSequential(dense)
+	if _, err := json.Marshal(sequential); err == nil {
+		t.Error("encoded an unregistered activation function")
+	}
+	if _, err := sequential.Clone(); err == nil {
+		t.Error("cloned an unregistered activation function")
+	}
+	graph, err := NewGraph([]GraphInput{{"a", 3}}, []*Node{NewNode("b", NewTimeDistributed(NewActivation(activationfunction.NewELU(0.5)), 1), "a")}, []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := json.Marshal(graph); err == nil {
+		t.Error("encoded a graph with an unregistered activation function")
+	}
+}
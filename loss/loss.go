@@ -0,0 +1,203 @@
+package loss
+
+import (
+	"fmt"
+	"math"
+	"nn/mathext"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Loss compares a batch of outputs (one sample per row) against the ground truth.
+// Eval returns the per-sample loss averaged over the batch and Gradient returns
+// the derivative of each sample's loss with respect to that sample's outputs.
+type Loss interface {
+	Name() string
+	Eval(output, groundTruth *mat.Dense) float64
+	Gradient(output, groundTruth *mat.Dense) *mat.Dense
+}
+
+// probabilities are clamped to [epsilon, 1-epsilon] before taking logs
+const epsilon = 1e-12
+
+func clamp(x float64) float64 {
+	return math.Min(math.Max(x, epsilon), 1-epsilon)
+}
+
+// elementwise builds a loss that sums eval over every output of a sample
+type elementwise struct {
+	name       string
+	eval       func(output, groundTruth float64) float64
+	derivative func(output, groundTruth float64) float64
+}
+
+func (loss *elementwise) Name() string {
+	return loss.name
+}
+
+func (loss *elementwise) Eval(output, groundTruth *mat.Dense) float64 {
+	numSamples, numOutputs := output.Dims()
+	total := float64(0)
+	for i := 0; i < numSamples; i++ {
+		for j := 0; j < numOutputs; j++ {
+			total += loss.eval(output.At(i, j), groundTruth.At(i, j))
+		}
+	}
+	return total / float64(numSamples)
+}
+
+func (loss *elementwise) Gradient(output, groundTruth *mat.Dense) *mat.Dense {
+	numSamples, numOutputs := output.Dims()
+	result := mat.NewDense(numSamples, numOutputs, nil)
+	result.Apply(func(i, j int, x float64) float64 {
+		return loss.derivative(x, groundTruth.At(i, j))
+	}, output)
+	return result
+}
+
+var SquaredError Loss = &elementwise{
+	name: "squaredError",
+	eval: func(output, groundTruth float64) float64 {
+		return (output - groundTruth) * (output - groundTruth)
+	},
+	derivative: func(output, groundTruth float64) float64 {
+		return 2 * (output - groundTruth)
+	},
+}
+
+var BinaryCrossEntropy Loss = &elementwise{
+	name: "binaryCrossEntropy",
+	eval: func(output, groundTruth float64) float64 {
+		output = clamp(output)
+		return -groundTruth*math.Log(output) - (1-groundTruth)*math.Log(1-output)
+	},
+	derivative: func(output, groundTruth float64) float64 {
+		output = clamp(output)
+		return (output - groundTruth) / (output * (1 - output))
+	},
+}
+
+var CategoricalCrossEntropy Loss = &elementwise{ //expects outputs that are already probabilities, e.g. from a softmax layer
+	name: "categoricalCrossEntropy",
+	eval: func(output, groundTruth float64) float64 {
+		return -groundTruth * math.Log(clamp(output))
+	},
+	derivative: func(output, groundTruth float64) float64 {
+		return -groundTruth / clamp(output)
+	},
+}
+
+// NewHuber is named "huber" for the default delta of 1 and "huber(<delta>)" otherwise, which Get reads back
+func NewHuber(delta float64) Loss {
+	name := "huber"
+	if delta != 1 {
+		name = fmt.Sprintf("huber(%s)", strconv.FormatFloat(delta, 'g', -1, 64))
+	}
+	return &elementwise{
+		name: name,
+		eval: func(output, groundTruth float64) float64 {
+			diff := math.Abs(output - groundTruth)
+			if diff <= delta {
+				return diff * diff / 2
+			}
+			return delta * (diff - delta/2)
+		},
+		derivative: func(output, groundTruth float64) float64 {
+			return math.Max(-delta, math.Min(delta, output-groundTruth))
+		},
+	}
+}
+
+var Huber Loss = NewHuber(1)
+
+// meanAbsoluteError averages over the outputs of a sample rather than summing
+type meanAbsoluteError struct{}
+
+func (meanAbsoluteError) Name() string {
+	return "meanAbsoluteError"
+}
+
+func (meanAbsoluteError) Eval(output, groundTruth *mat.Dense) float64 {
+	numSamples, numOutputs := output.Dims()
+	diff := mat.NewDense(numSamples, numOutputs, nil)
+	diff.Sub(output, groundTruth)
+	diff.Apply(func(_, _ int, x float64) float64 {
+		return math.Abs(x)
+	}, diff)
+	return mat.Sum(diff) / float64(numSamples*numOutputs)
+}
+
+func (meanAbsoluteError) Gradient(output, groundTruth *mat.Dense) *mat.Dense {
+	numSamples, numOutputs := output.Dims()
+	result := mat.NewDense(numSamples, numOutputs, nil)
+	result.Sub(output, groundTruth)
+	result.Apply(func(_, _ int, x float64) float64 {
+		return mathext.Sign(x) / float64(numOutputs)
+	}, result)
+	return result
+}
+
+var MeanAbsoluteError Loss = meanAbsoluteError{}
+
+// softmaxCrossEntropy applies a softmax to raw outputs (logits) before taking the categorical cross-entropy.
+// Fusing the two keeps the gradient at the numerically stable softmax(output) - groundTruth.
+type softmaxCrossEntropy struct{}
+
+func (softmaxCrossEntropy) Name() string {
+	return "softmaxCrossEntropy"
+}
+
+func (softmaxCrossEntropy) Eval(output, groundTruth *mat.Dense) float64 {
+	numSamples, numOutputs := output.Dims()
+	total := float64(0)
+	for i := 0; i < numSamples; i++ {
+		logSumExp := mathext.LogSumExp(output.RawRowView(i))
+		for j := 0; j < numOutputs; j++ {
+			total -= groundTruth.At(i, j) * (output.At(i, j) - logSumExp)
+		}
+	}
+	return total / float64(numSamples)
+}
+
+func (softmaxCrossEntropy) Gradient(output, groundTruth *mat.Dense) *mat.Dense {
+	numSamples, numOutputs := output.Dims()
+	result := mat.NewDense(numSamples, numOutputs, nil)
+	for i := 0; i < numSamples; i++ {
+		logSumExp := mathext.LogSumExp(output.RawRowView(i))
+		groundTruthSum := float64(0)
+		for j := 0; j < numOutputs; j++ {
+			groundTruthSum += groundTruth.At(i, j)
+		}
+		for j := 0; j < numOutputs; j++ {
+			result.Set(i, j, math.Exp(output.At(i, j)-logSumExp)*groundTruthSum-groundTruth.At(i, j))
+		}
+	}
+	return result
+}
+
+var SoftmaxCrossEntropy Loss = softmaxCrossEntropy{}
+
+var NameToLoss = map[string]Loss{
+	SquaredError.Name():            SquaredError,
+	BinaryCrossEntropy.Name():      BinaryCrossEntropy,
+	CategoricalCrossEntropy.Name(): CategoricalCrossEntropy,
+	SoftmaxCrossEntropy.Name():     SoftmaxCrossEntropy,
+	Huber.Name():                   Huber,
+	MeanAbsoluteError.Name():       MeanAbsoluteError,
+}
+
+// Get returns the loss with a name, including Huber losses with any delta
+func Get(name string) (Loss, bool) {
+	if result, ok := NameToLoss[name]; ok {
+		return result, true
+	}
+	if strings.HasPrefix(name, "huber(") && strings.HasSuffix(name, ")") {
+		arguments := strings.TrimSuffix(strings.TrimPrefix(name, "huber("), ")")
+		if delta, err := strconv.ParseFloat(arguments, 64); err == nil && delta > 0 {
+			return NewHuber(delta), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,82 @@
+package loss
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGradients(t *testing.T) {
+	output := mat.NewDense(2, 3, []float64{0.2, 0.7, 0.1, 0.6, 0.3, -1.4})
+	groundTruth := mat.NewDense(2, 3, []float64{0, 1, 0, 0.5, 0, 0.5})
+	for _, lossFunction := range []Loss{SquaredError, BinaryCrossEntropy, CategoricalCrossEntropy, SoftmaxCrossEntropy, Huber, NewHuber(0.5), MeanAbsoluteError} {
+		if lossFunction == BinaryCrossEntropy || lossFunction == CategoricalCrossEntropy {
+			//these take probabilities
+			output.Set(1, 2, 0.1)
+		}
+		gradient := lossFunction.Gradient(output, groundTruth)
+		for i := 0; i < 2; i++ {
+			for j := 0; j < 3; j++ {
+				value := output.At(i, j)
+				output.Set(i, j, value+1e-6)
+				above := lossFunction.Eval(output, groundTruth)
+				output.Set(i, j, value-1e-6)
+				below := lossFunction.Eval(output, groundTruth)
+				output.Set(i, j, value)
+				//Eval averages over the batch and Gradient is per sample
+				if want := (above - below) / 2e-6 * 2; math.Abs(gradient.At(i, j)-want) > 1e-5 {
+					t.Errorf("%s: gradient at (%d, %d) is %g, finite differences give %g", lossFunction.Name(), i, j, gradient.At(i, j), want)
+				}
+			}
+		}
+		output.Set(1, 2, -1.4)
+	}
+}
+
+func TestSoftmaxCrossEntropy(t *testing.T) {
+	logits := mat.NewDense(2, 3, []float64{1, 2, 3, -1, 0, 1000})
+	groundTruth := mat.NewDense(2, 3, []float64{0, 0, 1, 1, 0, 0})
+	probabilities := mat.NewDense(2, 3, nil)
+	for i := 0; i < 2; i++ {
+		row := logits.RawRowView(i)
+		maxLogit := math.Max(row[0], math.Max(row[1], row[2]))
+		sum := 0.0
+		for j := range row {
+			sum += math.Exp(row[j] - maxLogit)
+		}
+		for j := range row {
+			probabilities.Set(i, j, math.Exp(row[j]-maxLogit)/sum)
+		}
+	}
+	//the second sample's logits would overflow a naive softmax
+	if got, want := SoftmaxCrossEntropy.Eval(logits, groundTruth), (-math.Log(probabilities.At(0, 2))+1001)/2; math.Abs(got-want) > 1e-9 {
+		t.Errorf("cost %g, want %g", got, want)
+	}
+}
+
+func TestGet(t *testing.T) {
+	for name, lossFunction := range NameToLoss {
+		if got, ok := Get(name); !ok || got != lossFunction {
+			t.Errorf("Get(%q) = %v, %v", name, got, ok)
+		}
+	}
+	huber := NewHuber(0.25)
+	if huber.Name() != "huber(0.25)" {
+		t.Errorf("Huber name %q", huber.Name())
+	}
+	got, ok := Get(huber.Name())
+	if !ok {
+		t.Fatalf("Get(%q) failed", huber.Name())
+	}
+	output := mat.NewDense(1, 2, []float64{0.1, 3})
+	groundTruth := mat.NewDense(1, 2, []float64{0, 0})
+	if got.Eval(output, groundTruth) != huber.Eval(output, groundTruth) {
+		t.Error("decoded Huber loss has a different delta")
+	}
+	for _, name := range []string{"", "nope", "huber(", "huber()", "huber(-1)", "huber(0)", "huber(x)", "huber(1"} {
+		if _, ok := Get(name); ok {
+			t.Errorf("Get(%q) succeeded", name)
+		}
+	}
+}
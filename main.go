@@ -2,20 +2,32 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"nn/activationfunction"
+	"nn/checkpoint"
+	"nn/codec"
+	"nn/dataset"
 	"nn/feedforward"
 	"nn/geneticalgorithm"
 	"nn/gradientdescent"
+	"nn/idx"
+	"nn/layer"
+	"nn/loss"
+	"nn/optimizer"
 	"nn/random"
+	"nn/render"
+	"nn/schedule"
+	"nn/tabular"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/goccy/go-graphviz"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -50,54 +62,110 @@ func genPoint() (*mat.VecDense, *mat.VecDense) {
 }
 
 func classifyPointGeneticAlgorithm() {
-	geneticalgorithm.Run(100, 50, 3000, 50, []int{2, 3, 4, 3, 2}, []*activationfunction.ActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid}, genPoint)
+	geneticalgorithm.Run(100, 50, 3000, 50, []int{2, 3, 4, 3, 2}, []activationfunction.LayerActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid}, loss.SquaredError, dataset.FromGenerator(genPoint, 1), nil, nil)
 }
 
 func classifyPointGradientDescent() {
-	gradientdescent.Run(100000, []int{2, 3, 4, 3, 2}, []*activationfunction.ActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid}, genPoint)
+	gradientdescent.Run(100000, []int{2, 3, 4, 3, 2}, []activationfunction.LayerActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid}, loss.SquaredError, optimizer.NewSGD(0.02), dataset.FromGenerator(genPoint, 1), nil, nil, nil)
 }
 
-func parseDigitDataset() ([][][]int, []int, error) {
-	// digitImagesFile, _ := os.Open("datasets/digit_images.bin")
-	// digitLabelsFile, _ := os.Open("datasets/digit_labels.bin")
+func classifyPointResidual() {
+	newDense := func(numInputs, numOutputs int, activationFunction activationfunction.LayerActivationFunction) *layer.Dense {
+		dense := layer.NewDense(numInputs, numOutputs, activationFunction)
+		dense.Initialize(feedforward.HeNormal, feedforward.Zeros)
+		return dense
+	}
+	network, err := layer.NewGraph([]layer.GraphInput{{Name: "point", Size: 2}}, []*layer.Node{
+		layer.NewNode("hidden", newDense(2, 16, activationfunction.ReLU), "point"),
+		layer.NewNode("block1", newDense(16, 16, activationfunction.ReLU), "hidden"),
+		layer.NewMerge("skip1", layer.Add, nil, "hidden", "block1"),
+		layer.NewNode("block2", newDense(16, 16, activationfunction.ReLU), "skip1"),
+		layer.NewMerge("skip2", layer.Add, nil, "skip1", "block2"),
+		layer.NewNode("output", newDense(16, 2, activationfunction.Softmax), "skip2"),
+	}, []string{"output"})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	render.RenderGraph(network, graphviz.SVG, "output/graph.svg")
 
-	// digitImagesFileInfo, _ := digitImagesFile.Stat()
-	// digitLabelsFileInfo, _ := digitImagesFile.Stat()
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{
+		Model:        network,
+		Loss:         loss.CategoricalCrossEntropy,
+		Optimizer:    optimizer.NewAdam(0.001, 0.9, 0.999),
+		NumEpochs:    20,
+		BatchSize:    32,
+		Log:          os.Stdout,
+		CostPlotPath: "output/cost.png",
+		NetworkPath:  "output/network.json",
+	})
+	if _, _, err := trainer.Train(dataset.FromGenerator(genPoint, 4096)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// readDigitFile reads datasets/<name>.idx, or the raw datasets/<name>.bin it is made from if convertDigitDataset hasn't been run
+func readDigitFile(name string, itemDimensions []int) (*idx.IDX, error) {
+	result, err := idx.ReadFile("datasets/" + name + ".idx")
+	if errors.Is(err, os.ErrNotExist) {
+		return idx.ReadRaw("datasets/"+name+".bin", itemDimensions)
+	}
+	return result, err
+}
 
-	// imagesFileBytes := make([]byte, digitImagesFileInfo.Size())
-	// digitImagesFile.Read(imagesFileBytes)
-	imagesFileBytes, err := readFile("datasets/digit_images.bin")
+func parseDigitDataset() ([][][]int, []int, error) {
+	images, err := readDigitFile("digit_images", []int{28, 28})
 	if err != nil {
 		return nil, nil, err
 	}
-	currInd := 0
-	currImages := [][][]int{}
-	for currInd < len(imagesFileBytes) {
-		currImages = append(currImages, make([][]int, 28))
-		for i := 0; i < 28; i++ {
-			currImages[len(currImages)-1][i] = make([]int, 28)
-			for j := 0; j < 28; j++ {
-				currImages[len(currImages)-1][i][j] = int(imagesFileBytes[currInd])
-				currInd++
-			}
-		}
+	if len(images.Dimensions) != 3 || images.Dimensions[1] != 28 || images.Dimensions[2] != 28 {
+		return nil, nil, fmt.Errorf("expected 28x28 digit images, got dimensions %v", images.Dimensions)
 	}
-	labelsFileBytes, err := readFile("datasets/digit_labels.bin")
+	labels, err := readDigitFile("digit_labels", []int{})
 	if err != nil {
 		return nil, nil, err
 	}
-	currLabels := []int{}
-	for i := 0; i < len(labelsFileBytes); i++ {
-		currLabels = append(currLabels, int(labelsFileBytes[i]))
+	if len(labels.Dimensions) != 1 || labels.Dimensions[0] != images.Dimensions[0] {
+		return nil, nil, fmt.Errorf("expected %v digit labels, got dimensions %v", images.Dimensions[0], labels.Dimensions)
+	}
+
+	currImages := make([][][]int, images.Dimensions[0])
+	for i := 0; i < len(currImages); i++ {
+		currImages[i] = make([][]int, 28)
+		for j := 0; j < 28; j++ {
+			currImages[i][j] = make([]int, 28)
+			for k := 0; k < 28; k++ {
+				currImages[i][j][k] = int(images.Data[i*28*28+j*28+k])
+			}
+		}
+	}
+	currLabels := make([]int, labels.Dimensions[0])
+	for i := 0; i < len(currLabels); i++ {
+		currLabels[i] = int(labels.Data[i])
 	}
 	return currImages, currLabels, nil
 }
 
+func convertDigitDataset() {
+	if err := idx.ConvertRaw("datasets/digit_images.bin", "datasets/digit_images.idx", []int{28, 28}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if err := idx.ConvertRaw("datasets/digit_labels.bin", "datasets/digit_labels.idx", []int{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
 var digitImages [][][]int
 var digitLabels []int
 
-func genDigit() (*mat.VecDense, *mat.VecDense) {
-	i := random.RandomInt(0, len(digitImages)-1)
+type digitDataset struct{}
+
+func (digitDataset) Len() int {
+	return len(digitImages)
+}
+
+func (digitDataset) Get(i int) (*mat.VecDense, *mat.VecDense) {
 	input := mat.NewVecDense(28*28, make([]float64, 28*28))
 	for j := 0; j < 28; j++ {
 		for k := 0; k < 28; k++ {
@@ -109,33 +177,264 @@ func genDigit() (*mat.VecDense, *mat.VecDense) {
 	return input, output
 }
 
-func trainClassifyDigit() {
+// loadDigitTraining parses the digit dataset into training and validation digits and loads the checkpoint to resume from, if one was given
+func loadDigitTraining() (dataset.Dataset, dataset.Dataset, *checkpoint.Checkpoint, error) {
 	fmt.Println("parsing digit dataset...")
-	digitImages, digitLabels, _ = parseDigitDataset()
+	var err error
+	digitImages, digitLabels, err = parseDigitDataset()
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	fmt.Println("finished parsing digit datset")
-	gradientdescent.Run(100000, []int{28 * 28, 384, 192, 91, 10}, []*activationfunction.ActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid}, genDigit)
+	digits, validationDigits := dataset.Split(digitDataset{}, 0.9) //not shuffled so a resumed run validates on the same digits
+
+	var resumeFrom *checkpoint.Checkpoint
+	if len(os.Args) > 2 {
+		resumeFrom, err = checkpoint.Load(os.Args[2])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return digits, validationDigits, resumeFrom, nil
 }
 
-func runNeuralNetwork() {
-	networkFileBytes, err := readFile(os.Args[2])
+func trainClassifyDigit() {
+	digits, validationDigits, resumeFrom, err := loadDigitTraining()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	checkpoints := &checkpoint.Manager{Dir: "output/checkpoints", Every: 1, KeepLast: 3, KeepBest: true}
+	batchSize := 32
+	numBatches := (digits.Len() + batchSize - 1) / batchSize
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{
+		LayerSizes:          []int{28 * 28, 384, 192, 91, 10},
+		ActivationFunctions: []activationfunction.LayerActivationFunction{activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Sigmoid, activationfunction.Softmax},
+		Loss:                loss.CategoricalCrossEntropy,
+		Optimizer:           optimizer.NewAdam(0.001, 0.9, 0.999),
+		Init: func(network *feedforward.Network) {
+			network.InitializeAll(feedforward.XavierUniform, feedforward.Zeros) //uniform weights in [-1, 1] saturate the sigmoids of the 784-wide input layer
+		},
+		Normalizations:  []*feedforward.Normalization{feedforward.NewBatchNorm(384, 0.1), feedforward.NewBatchNorm(192, 0.1), feedforward.NewBatchNorm(91, 0.1), nil},
+		Schedule:        schedule.NewLinearWarmup(numBatches, schedule.NewConstant(0.001)), //warm up over the first epoch, a step-based schedule resumes exactly from a checkpoint
+		NumEpochs:       10,
+		BatchSize:       batchSize,
+		Validation:      &gradientdescent.Validation{Data: validationDigits, EarlyStopping: &gradientdescent.EarlyStopping{Patience: 3, RestoreBestWeights: true}},
+		Checkpoints:     checkpoints,
+		ResumeFrom:      resumeFrom,
+		Log:             os.Stdout,
+		CostPlotPath:    "output/cost.png",
+		NetworkPath:     "output/network.json",
+		BestNetworkPath: "output/best_network.json",
+		OptimizerPath:   "output/optimizer.json",
+	})
+	if _, _, err := trainer.Train(digits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// trainClassifyDigitCNN trains a small convolutional network on the digit images, which keeps their spatial structure
+func trainClassifyDigitCNN() {
+	digits, validationDigits, resumeFrom, err := loadDigitTraining()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		return
 	}
 
-	jsonNetwork := &feedforward.JSONNetwork{}
-	json.Unmarshal(networkFileBytes, jsonNetwork)
-	network := jsonNetwork.ToNetwork()
+	conv1 := layer.NewConv2D(layer.Shape{Channels: 1, Height: 28, Width: 28}, 8, 3, 3, 1, 1)
+	conv1.Initialize(feedforward.HeNormal, feedforward.Zeros)
+	pool1 := layer.NewMaxPool2D(conv1.Output(), 2, 2)
+	conv2 := layer.NewConv2D(pool1.Output(), 16, 3, 3, 1, 1)
+	conv2.Initialize(feedforward.HeNormal, feedforward.Zeros)
+	pool2 := layer.NewMaxPool2D(conv2.Output(), 2, 2)
+	flatten := layer.NewFlatten(pool2.Output())
+	dense := layer.NewDense(flatten.Output(), 10, activationfunction.Softmax)
+	dense.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	network := layer.NewSequential(
+		conv1, layer.NewSpatialBatchNorm(conv1.Output(), 0.1), layer.NewActivation(activationfunction.ReLU), pool1, //batch norm also brings the filters of the raw 0-255 pixels into range
+		conv2, layer.NewSpatialBatchNorm(conv2.Output(), 0.1), layer.NewActivation(activationfunction.ReLU), pool2,
+		flatten, dense,
+	)
 
-	inputsSlice := []float64{}
-	json.Unmarshal([]byte(os.Args[3]), &inputsSlice)
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{
+		Model:           network,
+		Loss:            loss.CategoricalCrossEntropy,
+		Optimizer:       optimizer.NewAdam(0.001, 0.9, 0.999),
+		NumEpochs:       5,
+		BatchSize:       32,
+		Validation:      &gradientdescent.Validation{Data: validationDigits, EarlyStopping: &gradientdescent.EarlyStopping{Patience: 2, RestoreBestWeights: true}},
+		Checkpoints:     &checkpoint.Manager{Dir: "output/checkpoints", Every: 1, KeepLast: 3, KeepBest: true},
+		ResumeFrom:      resumeFrom,
+		Log:             os.Stdout,
+		CostPlotPath:    "output/cost.png",
+		NetworkPath:     "output/network.json",
+		BestNetworkPath: "output/best_network.json",
+		OptimizerPath:   "output/optimizer.json",
+	})
+	if _, _, err := trainer.Train(digits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func trainSineWave() {
+	sequenceLength := 20
+	waves := dataset.SineWave(2048, sequenceLength, 0.3, false)
 
-	numInputs := len(inputsSlice)
-	inputs := mat.NewVecDense(numInputs, inputsSlice)
-	outputs, _, _ := network.Run(inputs, false, false)
+	lstm := layer.NewLSTM(1, 16, true, 10)
+	lstm.Initialize(feedforward.XavierUniform, feedforward.Orthogonal, feedforward.Zeros)
+	dense := layer.NewDense(16, 1, activationfunction.Identity)
+	dense.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	network := layer.NewSequential(lstm, layer.NewTimeDistributed(dense, 16))
+
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{
+		Model:        network,
+		Loss:         loss.SquaredError,
+		Optimizer:    optimizer.NewAdam(0.01, 0.9, 0.999),
+		NumEpochs:    10,
+		BatchSize:    32,
+		Log:          os.Stdout,
+		CostPlotPath: "output/cost.png",
+		NetworkPath:  "output/network.json",
+	})
+	if _, _, err := trainer.Train(waves); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// sortedDigits makes size sequences of sequenceLength random one-hot digits, each step's ground truth being the digit at that position once sorted
+func sortedDigits(size, sequenceLength int) (*dataset.Sequences, error) {
+	oneHot := func(digit int) *mat.VecDense {
+		result := mat.NewVecDense(10, nil)
+		result.SetVec(digit, 1)
+		return result
+	}
+	inputs := make([][]*mat.VecDense, size)
+	groundTruths := make([][]*mat.VecDense, size)
+	for i := 0; i < size; i++ {
+		digits := make([]int, sequenceLength)
+		for t := range digits {
+			digits[t] = random.RandomInt(0, 9)
+			inputs[i] = append(inputs[i], oneHot(digits[t]))
+		}
+		sort.Ints(digits)
+		for _, digit := range digits {
+			groundTruths[i] = append(groundTruths[i], oneHot(digit))
+		}
+	}
+	return dataset.FromSequences(inputs, groundTruths)
+}
+
+func trainSortDigits() {
+	modelSize := 32
+	digits, err := sortedDigits(4096, 6)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	embedding := layer.NewDense(10, modelSize, activationfunction.Identity)
+	embedding.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	encoder1 := layer.NewTransformerEncoder(modelSize, 4, 64, false)
+	encoder1.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	encoder2 := layer.NewTransformerEncoder(modelSize, 4, 64, false)
+	encoder2.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	output := layer.NewDense(modelSize, 10, activationfunction.Softmax)
+	output.Initialize(feedforward.XavierUniform, feedforward.Zeros)
+	network := layer.NewSequential(
+		layer.NewTimeDistributed(embedding, 10), layer.NewPositionalEncoding(modelSize),
+		encoder1, encoder2,
+		layer.NewTimeDistributed(output, modelSize),
+	)
+
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{
+		Model:        network,
+		Loss:         loss.CategoricalCrossEntropy,
+		Optimizer:    optimizer.NewAdam(0.001, 0.9, 0.999),
+		NumEpochs:    10,
+		BatchSize:    32,
+		Log:          os.Stdout,
+		CostPlotPath: "output/cost.png",
+		NetworkPath:  "output/network.json",
+	})
+	if _, _, err := trainer.Train(digits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func trainTabular() {
+	schemaBytes, err := readFile(os.Args[3])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	schema := tabular.Schema{}
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data, preprocessor, err := tabular.Load(os.Args[2], schema)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	var outputActivationFunction activationfunction.LayerActivationFunction = activationfunction.Identity
+	var lossFunction loss.Loss = loss.SquaredError
+	if len(schema.Targets) == 1 && schema.Targets[0].Type == tabular.Categorical {
+		outputActivationFunction = activationfunction.Softmax
+		lossFunction = loss.CategoricalCrossEntropy
+	}
+	trainer := gradientdescent.NewTrainer(gradientdescent.Options{ //no NetworkPath, the network is only saved once, beside its preprocessor
+		LayerSizes:          []int{preprocessor.NumFeatures(), 16, 16, preprocessor.NumTargets()},
+		ActivationFunctions: []activationfunction.LayerActivationFunction{activationfunction.Tanh, activationfunction.Tanh, outputActivationFunction},
+		Loss:                lossFunction,
+		Optimizer:           optimizer.NewAdam(0.01, 0.9, 0.999),
+		NumEpochs:           100,
+		BatchSize:           32,
+		Log:                 os.Stdout,
+		CostPlotPath:        "output/cost.png",
+	})
+	network, _, err := trainer.Train(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if err := codec.EncodeTabularModel(network, preprocessor, "output/network.json"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func runNeuralNetwork() {
+	network, preprocessor, err := codec.DecodeTabularModel(os.Args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	var inputs *mat.VecDense
+	if preprocessor != nil {
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(os.Args[3]), &values); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		inputs, err = preprocessor.TransformFeatures(tabular.ParseJSONRecord(values))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	} else {
+		inputsSlice := []float64{}
+		json.Unmarshal([]byte(os.Args[3]), &inputsSlice)
+
+		numInputs := len(inputsSlice)
+		inputs = mat.NewVecDense(numInputs, inputsSlice)
+	}
+	outputs := network.Predict(mat.NewDense(1, inputs.Len(), inputs.RawVector().Data)).RawRowView(0)
 	fmt.Print("[")
-	for i := 0; i < network.LayerSizes[network.NumLayers-1]; i++ {
-		fmt.Print(outputs.AtVec(i))
-		if i != network.LayerSizes[network.NumLayers-1]-1 {
+	for i := 0; i < len(outputs); i++ {
+		fmt.Print(outputs[i])
+		if i != len(outputs)-1 {
 			fmt.Print(",")
 		}
 	}
@@ -143,10 +442,13 @@ func runNeuralNetwork() {
 }
 
 func queryDigitDataset() {
-	parseDigitDataset()
 	imageIndex64, _ := strconv.ParseInt(os.Args[2], 10, 0)
 	imageIndex := int(imageIndex64) - 1
-	digitImages, digitLabels, _ = parseDigitDataset()
+	digitImages, digitLabels, err := parseDigitDataset()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
 	output := "["
 	for i := 0; i < 28; i++ {
 		for j := 0; j < 28; j++ {
@@ -231,9 +533,12 @@ func classifyDigitWebserver() {
 }
 
 func randomDigitDataset() {
-	digitImages, digitLabels, _ := parseDigitDataset()
-	imageIndex := rand.Intn(len(digitImages))
-	digitImages, digitLabels, _ = parseDigitDataset()
+	digitImages, digitLabels, err := parseDigitDataset()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	imageIndex := random.RandomInt(0, len(digitImages)-1)
 	output := "["
 	for i := 0; i < 28; i++ {
 		for j := 0; j < 28; j++ {
@@ -249,11 +554,11 @@ func randomDigitDataset() {
 }
 
 func main() {
-	rand.Seed(time.Now().UnixMilli())
+	random.Seed(time.Now().UnixMilli())
 	demos := map[string]struct {
 		runFunc    func()
 		descripton string
-	}{"classifyPointGeneticAlgorithm": {classifyPointGeneticAlgorithm, "checks if the sum of x and y values is >= -5 and <= 5 using the genetic algorithm"}, "classifyPointGradientDescent": {classifyPointGradientDescent, "checks if the sum of x and y values is >= -5 and <= 5 using gradient descent"}, "trainClassifyDigit": {trainClassifyDigit, "train classifying digits using nn"}, "runNeuralNetwork": {runNeuralNetwork, "run neural network"}, "queryDigitDataset": {queryDigitDataset, "output the kth image in a 1D JSON list"}, "classifyDigitInDataset": {classifyDigitInDataset, "classify kth digit in dataset"}, "classifyDigitWebserver": {classifyDigitWebserver, "start digit classification web interface"}, "randomDigitDataset": {randomDigitDataset, "random digit in dataset"}}
+	}{"classifyPointGeneticAlgorithm": {classifyPointGeneticAlgorithm, "checks if the sum of x and y values is >= -5 and <= 5 using the genetic algorithm"}, "classifyPointGradientDescent": {classifyPointGradientDescent, "checks if the sum of x and y values is >= -5 and <= 5 using gradient descent"}, "classifyPointResidual": {classifyPointResidual, "checks if the sum of x and y values is >= -5 and <= 5 using a network with skip connections"}, "trainClassifyDigit": {trainClassifyDigit, "train classifying digits using nn, optionally resuming from a checkpoint file"}, "trainClassifyDigitCNN": {trainClassifyDigitCNN, "train classifying digits using a convolutional nn, optionally resuming from a checkpoint file"}, "runNeuralNetwork": {runNeuralNetwork, "run neural network"}, "queryDigitDataset": {queryDigitDataset, "output the kth image in a 1D JSON list"}, "classifyDigitInDataset": {classifyDigitInDataset, "classify kth digit in dataset"}, "classifyDigitWebserver": {classifyDigitWebserver, "start digit classification web interface"}, "randomDigitDataset": {randomDigitDataset, "random digit in dataset"}, "convertDigitDataset": {convertDigitDataset, "convert the raw digit .bin files in datasets/ to IDX"}, "trainSineWave": {trainSineWave, "train an LSTM to predict the next value of sine waves"}, "trainSortDigits": {trainSortDigits, "train a transformer encoder to sort sequences of digits"}, "trainTabular": {trainTabular, "train on a CSV or JSON lines file described by a JSON schema file"}}
 	if len(os.Args) == 1 {
 		fmt.Println("please specify a demo to run:")
 		for demoName, demo := range demos {
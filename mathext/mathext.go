@@ -10,3 +10,53 @@ func RoundFloat64(val float64, precision int) float64 {
 func Sigmoid(x float64) float64 {
 	return 1 / (1 + math.Pow(math.E, -x))
 }
+
+func Sign(x float64) float64 {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+func LogSumExp(xs []float64) float64 {
+	max := math.Inf(-1)
+	for _, x := range xs {
+		max = math.Max(max, x)
+	}
+	sum := float64(0)
+	for _, x := range xs {
+		sum += math.Exp(x - max)
+	}
+	return max + math.Log(sum)
+}
+
+func Softplus(x float64) float64 { //log(1 + e^x) without overflowing for large x
+	return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+}
+
+func NormalCDF(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
+
+func NormalPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func Average(xs []float64) float64 {
+	sum := float64(0)
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// MovingAverages averages each value with up to window-1 values before it
+func MovingAverages(xs []float64, window int) []float64 {
+	result := make([]float64, len(xs))
+	for i := 0; i < len(xs); i++ {
+		result[i] = Average(xs[int(math.Max(0, float64(i+1-window))) : i+1])
+	}
+	return result
+}
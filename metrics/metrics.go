@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"fmt"
+	"nn/dataset"
+	"nn/loss"
+	"nn/model"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type ClassReport struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+	Support   int //number of samples of this class in the ground truth
+}
+
+type Report struct {
+	Loss            float64
+	Accuracy        float64
+	Classes         []ClassReport
+	ConfusionMatrix [][]int //ConfusionMatrix[i][j] counts samples of class i predicted as class j
+}
+
+// Class returns the index of the largest value, or for a single output whether it is at least 0.5
+func Class(output mat.Vector) int {
+	if output.Len() == 1 {
+		if output.AtVec(0) >= 0.5 {
+			return 1
+		}
+		return 0
+	}
+	result := 0
+	for i := 1; i < output.Len(); i++ {
+		if output.AtVec(i) > output.AtVec(result) {
+			result = i
+		}
+	}
+	return result
+}
+
+// Evaluate runs network over all of data and reports the average loss along with classification metrics. data must not be empty.
+func Evaluate(network model.Model, data dataset.Dataset, lossFunction loss.Loss) (*Report, error) {
+	if data.Len() == 0 {
+		return nil, fmt.Errorf("can't evaluate on an empty dataset")
+	}
+	report := &Report{}
+	numClasses := 0
+	batches := dataset.Batch(data, 256, false)
+	for i := 0; i < batches.Len(); i++ {
+		inputs, groundTruths := batches.Get(i)
+		outputs := network.Predict(inputs)
+		numSamples, numOutputs := outputs.Dims()
+		if report.ConfusionMatrix == nil {
+			numClasses = numOutputs
+			if numOutputs == 1 {
+				numClasses = 2
+			}
+			report.ConfusionMatrix = make([][]int, numClasses)
+			for j := 0; j < numClasses; j++ {
+				report.ConfusionMatrix[j] = make([]int, numClasses)
+			}
+		}
+		report.Loss += lossFunction.Eval(outputs, groundTruths) * float64(numSamples)
+		for j := 0; j < numSamples; j++ {
+			report.ConfusionMatrix[Class(groundTruths.RowView(j))][Class(outputs.RowView(j))]++
+		}
+	}
+	report.Loss /= float64(data.Len())
+
+	numCorrect := 0
+	report.Classes = make([]ClassReport, numClasses)
+	for i := 0; i < numClasses; i++ {
+		numPredicted := 0
+		for j := 0; j < numClasses; j++ {
+			report.Classes[i].Support += report.ConfusionMatrix[i][j]
+			numPredicted += report.ConfusionMatrix[j][i]
+		}
+		numCorrect += report.ConfusionMatrix[i][i]
+		if numPredicted > 0 {
+			report.Classes[i].Precision = float64(report.ConfusionMatrix[i][i]) / float64(numPredicted)
+		}
+		if report.Classes[i].Support > 0 {
+			report.Classes[i].Recall = float64(report.ConfusionMatrix[i][i]) / float64(report.Classes[i].Support)
+		}
+		if report.Classes[i].Precision+report.Classes[i].Recall > 0 {
+			report.Classes[i].F1 = 2 * report.Classes[i].Precision * report.Classes[i].Recall / (report.Classes[i].Precision + report.Classes[i].Recall)
+		}
+	}
+	report.Accuracy = float64(numCorrect) / float64(data.Len())
+	return report, nil
+}
+
+func (report *Report) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "loss %v | accuracy %v\n", report.Loss, report.Accuracy)
+	fmt.Fprintln(builder, "class | precision | recall | f1 | support")
+	for i, class := range report.Classes {
+		fmt.Fprintf(builder, "%v | %.4f | %.4f | %.4f | %v\n", i, class.Precision, class.Recall, class.F1, class.Support)
+	}
+	fmt.Fprintln(builder, "confusion matrix (rows are ground truth, columns are predictions):")
+	for _, row := range report.ConfusionMatrix {
+		fmt.Fprintln(builder, row)
+	}
+	return builder.String()
+}
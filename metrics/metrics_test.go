@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"math"
+	"nn/activationfunction"
+	"nn/dataset"
+	"nn/feedforward"
+	"nn/loss"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// identityNetwork predicts its inputs, so the inputs of a dataset are the predictions being evaluated
+func identityNetwork(size int) *feedforward.Network {
+	network := feedforward.NewNetwork([]int{size, size}, []activationfunction.LayerActivationFunction{activationfunction.Identity})
+	for i := 0; i < size; i++ {
+		network.Weights[0].Set(i, i, 1)
+	}
+	return network
+}
+
+// fromMatrices makes a dataset of the rows of inputs and groundTruths
+func fromMatrices(inputs, groundTruths *mat.Dense) dataset.Dataset {
+	inputRows, groundTruthRows := []*mat.VecDense{}, []*mat.VecDense{}
+	numRows, _ := inputs.Dims()
+	for i := 0; i < numRows; i++ {
+		inputRows = append(inputRows, mat.VecDenseCopyOf(inputs.RowView(i)))
+		groundTruthRows = append(groundTruthRows, mat.VecDenseCopyOf(groundTruths.RowView(i)))
+	}
+	return dataset.FromSlices(inputRows, groundTruthRows)
+}
+
+func TestEvaluate(t *testing.T) {
+	outputs := mat.NewDense(5, 3, []float64{0.9, 0.05, 0.05, 0.1, 0.8, 0.1, 0.2, 0.7, 0.1, 0.1, 0.1, 0.8, 0.6, 0.3, 0.1})
+	groundTruths := mat.NewDense(5, 3, []float64{1, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 1})
+	report, err := Evaluate(identityNetwork(3), fromMatrices(outputs, groundTruths), loss.SquaredError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := loss.SquaredError.Eval(outputs, groundTruths); math.Abs(report.Loss-want) > 1e-12 {
+		t.Errorf("loss %v, want %v", report.Loss, want)
+	}
+	if report.Accuracy != 0.6 {
+		t.Errorf("accuracy %v, want 0.6", report.Accuracy)
+	}
+	if want := [][]int{{1, 1, 0}, {0, 1, 0}, {1, 0, 1}}; !reflect.DeepEqual(report.ConfusionMatrix, want) {
+		t.Errorf("confusion matrix %v, want %v", report.ConfusionMatrix, want)
+	}
+	want := []ClassReport{{0.5, 0.5, 0.5, 2}, {0.5, 1, 2.0 / 3, 1}, {1, 0.5, 2.0 / 3, 2}}
+	for i := range want {
+		got := report.Classes[i]
+		if math.Abs(got.Precision-want[i].Precision) > 1e-12 || math.Abs(got.Recall-want[i].Recall) > 1e-12 || math.Abs(got.F1-want[i].F1) > 1e-12 || got.Support != want[i].Support {
+			t.Errorf("class %d: %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestEvaluateSingleOutput(t *testing.T) {
+	outputs := mat.NewDense(4, 1, []float64{0.7, 0.2, 0.5, 0.4})
+	groundTruths := mat.NewDense(4, 1, []float64{1, 0, 0, 1})
+	report, err := Evaluate(identityNetwork(1), fromMatrices(outputs, groundTruths), loss.SquaredError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1, 1}, {1, 1}}; !reflect.DeepEqual(report.ConfusionMatrix, want) {
+		t.Errorf("confusion matrix %v, want %v", report.ConfusionMatrix, want)
+	}
+	if report.Accuracy != 0.5 {
+		t.Errorf("accuracy %v, want 0.5", report.Accuracy)
+	}
+}
+
+func TestEvaluateEmpty(t *testing.T) {
+	if _, err := Evaluate(identityNetwork(2), dataset.FromSlices(nil, nil), loss.SquaredError); err == nil {
+		t.Error("evaluating on an empty dataset didn't fail")
+	}
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"encoding/json"
+	"nn/loss"
+	"nn/optimizer"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Model is what training, evaluation and checkpointing need from a network, whatever its architecture.
+// Both feedforward.Network and layer.Sequential are models.
+type Model interface {
+	// Predict runs every row of inputs through the model in inference mode
+	Predict(inputs *mat.Dense) *mat.Dense
+	// LearnBatch takes one optimizer step on a batch and returns its average cost and the model's outputs
+	LearnBatch(inputs, groundTruth *mat.Dense, lossFunction loss.Loss, opt optimizer.Optimizer) (float64, *mat.Dense)
+	// Parameters aliases the model's parameters in the order optimizers see them
+	Parameters() [][]float64
+	// Clone returns an independent copy, failing for models that can't be serialized
+	Clone() (Model, error)
+	// SetLoss records the loss the model is trained with so it is saved along with it
+	SetLoss(lossFunction loss.Loss)
+	json.Marshaler
+}
@@ -0,0 +1,243 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"nn/deepcopy"
+)
+
+// Optimizer updates a list of parameter slices from their gradients, keeping whatever per-parameter state it needs between calls.
+// params and grads must have the same shape on every call, e.g. feedforward.Network.Parameters().
+type Optimizer interface {
+	Update(params, grads [][]float64)
+	// UpdateSparse is Update touching only the rows listed in sparse for the parameters that have a non-nil entry,
+	// leaving the other rows and their state as they are, e.g. for an embedding where a batch only uses a few rows
+	UpdateSparse(params, grads [][]float64, sparse []*SparseGradient)
+	LearnRate() float64
+	SetLearnRate(learnRate float64)
+	ToJSONOptimizer() *JSONOptimizer
+}
+
+// SparseGradient lists the rows with gradients of a parameter seen as a matrix of RowSize columns. Rows must not repeat.
+type SparseGradient struct {
+	Rows    []int
+	RowSize int
+}
+
+type JSONOptimizer struct {
+	Name            string
+	Hyperparameters map[string]float64
+	Step            int
+	State           map[string][][]float64
+}
+
+// optimizer is shared by every built-in optimizer, which only differ in their hyperparameters and update rule
+type optimizer struct {
+	name            string
+	hyperparameters map[string]float64
+	step            int
+	state           map[string][][]float64
+}
+
+// updateRule updates params[i][start:end] for every range visited by each, in a tight loop per range
+type updateRule func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int)))
+
+var nameToUpdateRule = map[string]updateRule{}
+
+func (optimizer *optimizer) Update(params, grads [][]float64) {
+	optimizer.UpdateSparse(params, grads, nil)
+}
+
+// UpdateSparse visits every parameter whole, except those with sparse gradients which are visited row by row
+func (optimizer *optimizer) UpdateSparse(params, grads [][]float64, sparse []*SparseGradient) {
+	optimizer.step++
+	nameToUpdateRule[optimizer.name](optimizer, params, grads, func(update func(i, start, end int)) {
+		for i := 0; i < len(params); i++ {
+			if i >= len(sparse) || sparse[i] == nil {
+				update(i, 0, len(params[i]))
+				continue
+			}
+			for _, row := range sparse[i].Rows {
+				update(i, row*sparse[i].RowSize, (row+1)*sparse[i].RowSize)
+			}
+		}
+	})
+}
+
+func (optimizer *optimizer) LearnRate() float64 {
+	return optimizer.hyperparameters["learnRate"]
+}
+
+func (optimizer *optimizer) SetLearnRate(learnRate float64) {
+	optimizer.hyperparameters["learnRate"] = learnRate
+}
+
+func (optimizer *optimizer) ToJSONOptimizer() *JSONOptimizer {
+	jsonOptimizer := &JSONOptimizer{}
+	jsonOptimizer.Name = optimizer.name
+	jsonOptimizer.Step = optimizer.step
+	jsonOptimizer.Hyperparameters = map[string]float64{}
+	for name, value := range optimizer.hyperparameters {
+		jsonOptimizer.Hyperparameters[name] = value
+	}
+	jsonOptimizer.State = map[string][][]float64{}
+	for name, value := range optimizer.state {
+		jsonOptimizer.State[name] = deepcopy.PrimitiveSlice2D(value)
+	}
+	return jsonOptimizer
+}
+
+func (jsonOptimizer *JSONOptimizer) ToOptimizer() (Optimizer, error) {
+	if _, ok := nameToUpdateRule[jsonOptimizer.Name]; !ok {
+		return nil, fmt.Errorf("unknown optimizer %q", jsonOptimizer.Name)
+	}
+	result := newOptimizer(jsonOptimizer.Name, jsonOptimizer.Hyperparameters)
+	result.step = jsonOptimizer.Step
+	for name, value := range jsonOptimizer.State {
+		result.state[name] = deepcopy.PrimitiveSlice2D(value)
+	}
+	return result, nil
+}
+
+func newOptimizer(name string, hyperparameters map[string]float64) *optimizer {
+	result := &optimizer{name: name, hyperparameters: map[string]float64{}, state: map[string][][]float64{}}
+	for name, value := range hyperparameters {
+		result.hyperparameters[name] = value
+	}
+	return result
+}
+
+// stateFor returns the named state, allocating zeros shaped like params the first time it is used
+func (optimizer *optimizer) stateFor(name string, params [][]float64) [][]float64 {
+	state, ok := optimizer.state[name]
+	if !ok {
+		state = make([][]float64, len(params))
+		for i := 0; i < len(params); i++ {
+			state[i] = make([]float64, len(params[i]))
+		}
+		optimizer.state[name] = state
+	}
+	return state
+}
+
+const defaultEpsilon = 1e-8
+
+func NewSGD(learnRate float64) Optimizer {
+	return newOptimizer("sgd", map[string]float64{"learnRate": learnRate})
+}
+
+func NewMomentum(learnRate, momentum float64) Optimizer {
+	return newOptimizer("momentum", map[string]float64{"learnRate": learnRate, "momentum": momentum})
+}
+
+func NewNesterov(learnRate, momentum float64) Optimizer {
+	return newOptimizer("nesterov", map[string]float64{"learnRate": learnRate, "momentum": momentum})
+}
+
+func NewAdaGrad(learnRate float64) Optimizer {
+	return newOptimizer("adaGrad", map[string]float64{"learnRate": learnRate, "epsilon": defaultEpsilon})
+}
+
+func NewRMSProp(learnRate, decay float64) Optimizer {
+	return newOptimizer("rmsProp", map[string]float64{"learnRate": learnRate, "decay": decay, "epsilon": defaultEpsilon})
+}
+
+func NewAdam(learnRate, beta1, beta2 float64) Optimizer {
+	return newOptimizer("adam", map[string]float64{"learnRate": learnRate, "beta1": beta1, "beta2": beta2, "epsilon": defaultEpsilon})
+}
+
+// NewAdamW is Adam with weight decay applied directly to the parameters instead of through the gradients
+func NewAdamW(learnRate, beta1, beta2, weightDecay float64) Optimizer {
+	return newOptimizer("adamW", map[string]float64{"learnRate": learnRate, "beta1": beta1, "beta2": beta2, "epsilon": defaultEpsilon, "weightDecay": weightDecay})
+}
+
+func adamUpdate(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+	learnRate := optimizer.hyperparameters["learnRate"]
+	beta1 := optimizer.hyperparameters["beta1"]
+	beta2 := optimizer.hyperparameters["beta2"]
+	epsilon := optimizer.hyperparameters["epsilon"]
+	firstMoments := optimizer.stateFor("firstMoments", params)
+	secondMoments := optimizer.stateFor("secondMoments", params)
+	firstCorrection := 1 - math.Pow(beta1, float64(optimizer.step))
+	secondCorrection := 1 - math.Pow(beta2, float64(optimizer.step))
+	each(func(i, start, end int) {
+		param, grad, firstMoment, secondMoment := params[i], grads[i], firstMoments[i], secondMoments[i]
+		for j := start; j < end; j++ {
+			firstMoment[j] = beta1*firstMoment[j] + (1-beta1)*grad[j]
+			secondMoment[j] = beta2*secondMoment[j] + (1-beta2)*grad[j]*grad[j]
+			param[j] -= learnRate * (firstMoment[j] / firstCorrection) / (math.Sqrt(secondMoment[j]/secondCorrection) + epsilon)
+		}
+	})
+}
+
+func init() {
+	nameToUpdateRule["sgd"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		learnRate := optimizer.hyperparameters["learnRate"]
+		each(func(i, start, end int) {
+			param, grad := params[i], grads[i]
+			for j := start; j < end; j++ {
+				param[j] -= learnRate * grad[j]
+			}
+		})
+	}
+	nameToUpdateRule["momentum"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		learnRate := optimizer.hyperparameters["learnRate"]
+		momentum := optimizer.hyperparameters["momentum"]
+		velocities := optimizer.stateFor("velocities", params)
+		each(func(i, start, end int) {
+			param, grad, velocity := params[i], grads[i], velocities[i]
+			for j := start; j < end; j++ {
+				velocity[j] = momentum*velocity[j] + grad[j]
+				param[j] -= learnRate * velocity[j]
+			}
+		})
+	}
+	nameToUpdateRule["nesterov"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		learnRate := optimizer.hyperparameters["learnRate"]
+		momentum := optimizer.hyperparameters["momentum"]
+		velocities := optimizer.stateFor("velocities", params)
+		each(func(i, start, end int) {
+			param, grad, velocity := params[i], grads[i], velocities[i]
+			for j := start; j < end; j++ {
+				velocity[j] = momentum*velocity[j] + grad[j]
+				param[j] -= learnRate * (grad[j] + momentum*velocity[j])
+			}
+		})
+	}
+	nameToUpdateRule["adaGrad"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		learnRate := optimizer.hyperparameters["learnRate"]
+		epsilon := optimizer.hyperparameters["epsilon"]
+		squareSums := optimizer.stateFor("squareSums", params)
+		each(func(i, start, end int) {
+			param, grad, squareSum := params[i], grads[i], squareSums[i]
+			for j := start; j < end; j++ {
+				squareSum[j] += grad[j] * grad[j]
+				param[j] -= learnRate * grad[j] / (math.Sqrt(squareSum[j]) + epsilon)
+			}
+		})
+	}
+	nameToUpdateRule["rmsProp"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		learnRate := optimizer.hyperparameters["learnRate"]
+		decay := optimizer.hyperparameters["decay"]
+		epsilon := optimizer.hyperparameters["epsilon"]
+		squareAverages := optimizer.stateFor("squareAverages", params)
+		each(func(i, start, end int) {
+			param, grad, squareAverage := params[i], grads[i], squareAverages[i]
+			for j := start; j < end; j++ {
+				squareAverage[j] = decay*squareAverage[j] + (1-decay)*grad[j]*grad[j]
+				param[j] -= learnRate * grad[j] / (math.Sqrt(squareAverage[j]) + epsilon)
+			}
+		})
+	}
+	nameToUpdateRule["adam"] = adamUpdate
+	nameToUpdateRule["adamW"] = func(optimizer *optimizer, params, grads [][]float64, each func(update func(i, start, end int))) {
+		decay := optimizer.hyperparameters["learnRate"] * optimizer.hyperparameters["weightDecay"]
+		each(func(i, start, end int) {
+			param := params[i]
+			for j := start; j < end; j++ {
+				param[j] -= decay * param[j]
+			}
+		})
+		adamUpdate(optimizer, params, grads, each)
+	}
+}
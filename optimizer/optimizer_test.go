@@ -0,0 +1,90 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateRules(t *testing.T) {
+	//one parameter starting at 1 after gradients of 0.5 and -0.2 with a learning rate of 0.1
+	tests := map[string]struct {
+		optimizer Optimizer
+		want      float64
+	}{
+		"sgd":      {NewSGD(0.1), 0.97},
+		"momentum": {NewMomentum(0.1, 0.9), 0.925},
+		"nesterov": {NewNesterov(0.1, 0.9), 0.9025},
+		"adaGrad":  {NewAdaGrad(0.1), 0.9371390689457552},
+		"rmsProp":  {NewRMSProp(0.1, 0.9), 0.8066312698027817},
+		"adam":     {NewAdam(0.1, 0.9, 0.999), 0.8654394181165107},
+		"adamW":    {NewAdamW(0.1, 0.9, 0.999, 0.5), 0.7729394180165107},
+	}
+	for name, test := range tests {
+		params := [][]float64{{1}}
+		for _, grad := range []float64{0.5, -0.2} {
+			test.optimizer.Update(params, [][]float64{{grad}})
+		}
+		if math.Abs(params[0][0]-test.want) > 1e-12 {
+			t.Errorf("%s: parameter %v, want %v", name, params[0][0], test.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	params := [][]float64{{1, -2}, {0.5}}
+	grads := [][]float64{{0.3, -0.1}, {0.7}}
+	original := NewAdamW(0.01, 0.9, 0.999, 0.1)
+	original.Update(params, grads)
+
+	data, err := json.Marshal(original.ToJSONOptimizer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOptimizer := &JSONOptimizer{}
+	if err := json.Unmarshal(data, jsonOptimizer); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jsonOptimizer.ToOptimizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedParams := [][]float64{{params[0][0], params[0][1]}, {params[1][0]}}
+	original.Update(params, grads)
+	decoded.Update(decodedParams, grads)
+	if !reflect.DeepEqual(decodedParams, params) {
+		t.Errorf("decoded optimizer stepped to %v, the original to %v", decodedParams, params)
+	}
+
+	jsonOptimizer.Name = "lbfgs"
+	if _, err := jsonOptimizer.ToOptimizer(); err == nil {
+		t.Error("decoding an unknown optimizer didn't fail")
+	}
+}
+
+func TestUpdateSparse(t *testing.T) {
+	//a 3x2 parameter with gradients in rows 0 and 2 only, next to a dense parameter
+	grads := [][]float64{{0.1, 0.2, 9, 9, 0.5, -0.3}, {0.4}}
+	dense := NewMomentum(0.1, 0.9)
+	denseParams := [][]float64{{1, 1, 1, 1, 1, 1}, {1}}
+	dense.Update(denseParams, grads)
+
+	sparse := NewMomentum(0.1, 0.9)
+	sparseParams := [][]float64{{1, 1, 1, 1, 1, 1}, {1}}
+	sparse.UpdateSparse(sparseParams, grads, []*SparseGradient{{Rows: []int{0, 2}, RowSize: 2}})
+	for _, j := range []int{0, 1, 4, 5} {
+		if sparseParams[0][j] != denseParams[0][j] {
+			t.Errorf("row entry %d: sparse update gave %v, dense update %v", j, sparseParams[0][j], denseParams[0][j])
+		}
+	}
+	if sparseParams[0][2] != 1 || sparseParams[0][3] != 1 {
+		t.Errorf("row 1 without gradients changed to %v", sparseParams[0][2:4])
+	}
+	if sparseParams[1][0] != denseParams[1][0] {
+		t.Errorf("dense parameter: sparse update gave %v, dense update %v", sparseParams[1][0], denseParams[1][0])
+	}
+	if velocities := sparse.ToJSONOptimizer().State["velocities"][0]; velocities[2] != 0 || velocities[3] != 0 {
+		t.Errorf("row 1 without gradients has velocities %v", velocities[2:4])
+	}
+}
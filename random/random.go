@@ -2,10 +2,56 @@ package random
 
 import "math/rand"
 
+// source is a splitmix64 generator. Unlike math/rand's default source, its whole state is a single
+// number that can be saved and restored, which lets a resumed training run draw the same values.
+type source struct {
+	state uint64
+}
+
+func (source *source) Uint64() uint64 {
+	source.state += 0x9e3779b97f4a7c15
+	z := source.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (source *source) Int63() int64 {
+	return int64(source.Uint64() >> 1)
+}
+
+func (source *source) Seed(seed int64) {
+	source.state = uint64(seed)
+}
+
+var globalSource = &source{}
+var generator = rand.New(globalSource)
+
+func Seed(seed int64) {
+	globalSource.Seed(seed)
+}
+
+func State() uint64 {
+	return globalSource.state
+}
+
+func SetState(state uint64) {
+	globalSource.state = state
+}
+
 func RandomFloat64(min, max float64) float64 {
-	return rand.Float64()*(max-min) + min
+	return generator.Float64()*(max-min) + min
 }
 
 func RandomInt(min, max int) int {
-	return rand.Intn(max-min+1) + min
+	return generator.Intn(max-min+1) + min
+}
+
+func Permutation(n int) []int {
+	return generator.Perm(n)
+}
+
+// RandomNormal draws from a normal distribution with the given mean and standard deviation
+func RandomNormal(mean, stddev float64) float64 {
+	return generator.NormFloat64()*stddev + mean
 }
@@ -3,6 +3,7 @@ package render
 import (
 	"fmt"
 	"nn/feedforward"
+	"nn/layer"
 	"nn/mathext"
 
 	"github.com/goccy/go-graphviz"
@@ -38,7 +39,11 @@ func RenderFeedForward(network *feedforward.Network, inputs *mat.VecDense, width
 			if i == 0 {
 				currNode.SetLabel(fmt.Sprint(states[0].AtVec(j)))
 			} else {
-				currNode.SetLabel("bias " + fmt.Sprint(mathext.RoundFloat64(network.Biases[i-1][j], 2)) + " f(" + fmt.Sprint(mathext.RoundFloat64(statesBeforeActivationFunctions[i].AtVec(j), 2)) + ") = " + fmt.Sprint(mathext.RoundFloat64(states[i].AtVec(j), 2)))
+				normalization := ""
+				if i-1 < len(network.Normalizations) && network.Normalizations[i-1] != nil {
+					normalization = " " + string(network.Normalizations[i-1].Kind) + " γ " + fmt.Sprint(mathext.RoundFloat64(network.Normalizations[i-1].Gamma.AtVec(j), 2)) + " β " + fmt.Sprint(mathext.RoundFloat64(network.Normalizations[i-1].Beta.AtVec(j), 2))
+				}
+				currNode.SetLabel("bias " + fmt.Sprint(mathext.RoundFloat64(network.Biases[i-1].AtVec(j), 2)) + normalization + " f(" + fmt.Sprint(mathext.RoundFloat64(statesBeforeActivationFunctions[i].AtVec(j), 2)) + ") = " + fmt.Sprint(mathext.RoundFloat64(states[i].AtVec(j), 2)))
 			}
 			currNode.SetPos(width/float64(network.NumLayers+1)*float64(i+1), height/float64(network.LayerSizes[i]+1)*float64(j+1))
 			currNode.SetPin(true)
@@ -50,7 +55,7 @@ func RenderFeedForward(network *feedforward.Network, inputs *mat.VecDense, width
 						panic(err)
 					}
 
-					currEdge.SetHeadLabel(fmt.Sprint(mathext.RoundFloat64(network.Weights[i-1][j].AtVec(k), 2)))
+					currEdge.SetHeadLabel(fmt.Sprint(mathext.RoundFloat64(network.Weights[i-1].At(j, k), 2)))
 					currEdge.SetLabelDistance(3)
 				}
 			}
@@ -62,3 +67,58 @@ func RenderFeedForward(network *feedforward.Network, inputs *mat.VecDense, width
 		panic(err)
 	}
 }
+
+// RenderGraph draws the nodes of a layer.Graph with their layer types and the connections between them, top to bottom
+func RenderGraph(network *layer.Graph, format graphviz.Format, filename string) {
+	g := graphviz.New()
+	graph, err := g.Graph()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := graph.Close(); err != nil {
+			panic(err)
+		}
+		g.Close()
+	}()
+
+	//graphviz names are numbered so that no input or node name can collide with another element, names only appear in labels
+	nodes := map[string]*cgraph.Node{}
+	createNode := func(label string) *cgraph.Node {
+		currNode, err := graph.CreateNode(fmt.Sprint("node ", graph.NumberNodes()))
+		if err != nil {
+			panic(err)
+		}
+		currNode.SetLabel(label)
+		currNode.SetShape(cgraph.BoxShape)
+		return currNode
+	}
+	createEdge := func(from, to *cgraph.Node) {
+		if _, err := graph.CreateEdge(fmt.Sprint("edge ", graph.NumberEdges()), from, to); err != nil {
+			panic(err)
+		}
+	}
+	for _, input := range network.Inputs {
+		nodes[input.Name] = createNode(input.Name + "\ninput of " + fmt.Sprint(input.Size)).SetShape(cgraph.EllipseShape)
+	}
+	for _, node := range network.Nodes {
+		label := node.Name
+		if node.Merge != "" {
+			label += "\n" + string(node.Merge)
+		}
+		if node.Layer != nil {
+			label += "\n" + layer.TypeName(node.Layer)
+		}
+		nodes[node.Name] = createNode(label)
+		for _, input := range node.Inputs {
+			createEdge(nodes[input], nodes[node.Name])
+		}
+	}
+	for i, output := range network.Outputs {
+		createEdge(nodes[output], createNode("output "+fmt.Sprint(i)).SetShape(cgraph.EllipseShape))
+	}
+
+	if err := g.RenderFilename(graph, format, filename); err != nil {
+		panic(err)
+	}
+}
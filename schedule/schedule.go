@@ -0,0 +1,211 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"nn/callback"
+)
+
+// Schedule gives the learning rate to use for a step, counted from 0 over every optimizer step of a run
+type Schedule interface {
+	LearnRate(step int) float64
+}
+
+type constant struct {
+	learnRate float64
+}
+
+func (schedule constant) LearnRate(step int) float64 {
+	return schedule.learnRate
+}
+
+func NewConstant(learnRate float64) Schedule {
+	return constant{learnRate: learnRate}
+}
+
+type StepDecay struct {
+	InitialLearnRate float64
+	Factor           float64 //the learning rate is multiplied by this
+	StepSize         int     //every this many steps
+}
+
+func NewStepDecay(initialLearnRate, factor float64, stepSize int) (*StepDecay, error) {
+	if stepSize < 1 {
+		return nil, fmt.Errorf("step decay needs a positive step size, got %v", stepSize)
+	}
+	return &StepDecay{InitialLearnRate: initialLearnRate, Factor: factor, StepSize: stepSize}, nil
+}
+
+func (schedule *StepDecay) LearnRate(step int) float64 {
+	return schedule.InitialLearnRate * math.Pow(schedule.Factor, float64(step/schedule.StepSize))
+}
+
+type ExponentialDecay struct {
+	InitialLearnRate float64
+	DecayRate        float64 //the learning rate is multiplied by this
+	DecaySteps       int     //over this many steps, smoothly
+}
+
+func NewExponentialDecay(initialLearnRate, decayRate float64, decaySteps int) (*ExponentialDecay, error) {
+	if decaySteps < 1 {
+		return nil, fmt.Errorf("exponential decay needs a positive number of decay steps, got %v", decaySteps)
+	}
+	return &ExponentialDecay{InitialLearnRate: initialLearnRate, DecayRate: decayRate, DecaySteps: decaySteps}, nil
+}
+
+func (schedule *ExponentialDecay) LearnRate(step int) float64 {
+	return schedule.InitialLearnRate * math.Pow(schedule.DecayRate, float64(step)/float64(schedule.DecaySteps))
+}
+
+// annealCos goes from start to end along half a cosine as progress goes from 0 to 1
+func annealCos(start, end, progress float64) float64 {
+	return end + (start-end)*(1+math.Cos(math.Pi*progress))/2
+}
+
+// CosineWarmRestarts anneals from MaxLearnRate to MinLearnRate along a cosine and then jumps back to MaxLearnRate.
+// The first cycle lasts Period steps and every cycle after lasts PeriodMult times longer than the one before.
+type CosineWarmRestarts struct {
+	MaxLearnRate float64
+	MinLearnRate float64
+	Period       int
+	PeriodMult   float64 //1 or more
+}
+
+func NewCosineWarmRestarts(maxLearnRate, minLearnRate float64, period int, periodMult float64) (*CosineWarmRestarts, error) {
+	if period < 1 {
+		return nil, fmt.Errorf("cosine warm restarts need a positive period, got %v", period)
+	}
+	if periodMult < 1 {
+		return nil, fmt.Errorf("cosine warm restarts need a period multiplier of 1 or more, got %v", periodMult)
+	}
+	return &CosineWarmRestarts{MaxLearnRate: maxLearnRate, MinLearnRate: minLearnRate, Period: period, PeriodMult: periodMult}, nil
+}
+
+func (schedule *CosineWarmRestarts) LearnRate(step int) float64 {
+	cycleStep := float64(step)
+	period := float64(schedule.Period)
+	for cycleStep >= period {
+		cycleStep -= period
+		period *= schedule.PeriodMult
+	}
+	return annealCos(schedule.MaxLearnRate, schedule.MinLearnRate, cycleStep/period)
+}
+
+// LinearWarmup raises the learning rate linearly to the first rate of Schedule over NumSteps steps, then follows Schedule from its step 0
+type LinearWarmup struct {
+	NumSteps int
+	Schedule Schedule
+}
+
+func NewLinearWarmup(numSteps int, schedule Schedule) *LinearWarmup {
+	return &LinearWarmup{NumSteps: numSteps, Schedule: schedule}
+}
+
+func (schedule *LinearWarmup) LearnRate(step int) float64 {
+	if step < schedule.NumSteps {
+		return schedule.Schedule.LearnRate(0) * float64(step+1) / float64(schedule.NumSteps)
+	}
+	return schedule.Schedule.LearnRate(step - schedule.NumSteps)
+}
+
+// OneCycle anneals the learning rate up from MaxLearnRate/DivFactor to MaxLearnRate over the first PctStart of NumSteps steps,
+// then down to MaxLearnRate/(DivFactor*FinalDivFactor) over the rest
+type OneCycle struct {
+	MaxLearnRate   float64
+	NumSteps       int
+	PctStart       float64 //usually 0.3
+	DivFactor      float64 //usually 25
+	FinalDivFactor float64 //usually 1e4
+}
+
+func NewOneCycle(maxLearnRate float64, numSteps int) *OneCycle {
+	return &OneCycle{MaxLearnRate: maxLearnRate, NumSteps: numSteps, PctStart: 0.3, DivFactor: 25, FinalDivFactor: 1e4}
+}
+
+func (schedule *OneCycle) LearnRate(step int) float64 {
+	initialLearnRate := schedule.MaxLearnRate / schedule.DivFactor
+	finalLearnRate := initialLearnRate / schedule.FinalDivFactor
+	numWarmupSteps := schedule.PctStart * float64(schedule.NumSteps)
+	if float64(step) < numWarmupSteps {
+		return annealCos(initialLearnRate, schedule.MaxLearnRate, float64(step)/numWarmupSteps)
+	}
+	return annealCos(schedule.MaxLearnRate, finalLearnRate, math.Min(1, (float64(step)-numWarmupSteps)/(float64(schedule.NumSteps)-numWarmupSteps)))
+}
+
+// ReduceOnPlateau scales the learning rates of Schedule by Factor every time the validation loss hasn't improved by more than MinDelta
+// for Patience evaluations, never going below MinLearnRate. It is also a callback, which gradientdescent registers by itself
+// when it is the training schedule. How much it has reduced the learning rate is saved in checkpoints, so a resumed run keeps its rates.
+type ReduceOnPlateau struct {
+	callback.Base
+	Schedule     Schedule
+	Factor       float64
+	Patience     int
+	MinDelta     float64
+	MinLearnRate float64
+
+	scale                 float64
+	bestLoss              float64
+	numWithoutImprovement int
+}
+
+type jsonReduceOnPlateau struct {
+	Scale                 float64
+	BestLoss              *float64 `json:",omitempty"` //nil until the first evaluation
+	NumWithoutImprovement int
+}
+
+func NewReduceOnPlateau(schedule Schedule, factor float64, patience int, minDelta, minLearnRate float64) *ReduceOnPlateau {
+	return &ReduceOnPlateau{Schedule: schedule, Factor: factor, Patience: patience, MinDelta: minDelta, MinLearnRate: minLearnRate, scale: 1, bestLoss: math.Inf(1)}
+}
+
+func (schedule *ReduceOnPlateau) LearnRate(step int) float64 {
+	return math.Max(schedule.scale*schedule.Schedule.LearnRate(step), schedule.MinLearnRate)
+}
+
+func (schedule *ReduceOnPlateau) observe(state *callback.State) {
+	if state.Validation == nil {
+		return
+	}
+	if state.Validation.Loss < schedule.bestLoss-schedule.MinDelta {
+		schedule.bestLoss = state.Validation.Loss
+		schedule.numWithoutImprovement = 0
+		return
+	}
+	schedule.numWithoutImprovement++
+	if schedule.numWithoutImprovement >= schedule.Patience {
+		schedule.scale *= schedule.Factor
+		schedule.numWithoutImprovement = 0
+	}
+}
+
+func (schedule *ReduceOnPlateau) OnStepEnd(state *callback.State) {
+	schedule.observe(state)
+}
+
+func (schedule *ReduceOnPlateau) OnEpochEnd(state *callback.State) {
+	schedule.observe(state)
+}
+
+func (schedule *ReduceOnPlateau) SaveState() (json.RawMessage, error) {
+	state := jsonReduceOnPlateau{Scale: schedule.scale, NumWithoutImprovement: schedule.numWithoutImprovement}
+	if !math.IsInf(schedule.bestLoss, 1) {
+		state.BestLoss = &schedule.bestLoss
+	}
+	return json.Marshal(state)
+}
+
+func (schedule *ReduceOnPlateau) RestoreState(data json.RawMessage) error {
+	state := &jsonReduceOnPlateau{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+	if state.Scale <= 0 || state.NumWithoutImprovement < 0 {
+		return fmt.Errorf("malformed reduce on plateau state")
+	}
+	schedule.scale, schedule.numWithoutImprovement, schedule.bestLoss = state.Scale, state.NumWithoutImprovement, math.Inf(1)
+	if state.BestLoss != nil {
+		schedule.bestLoss = *state.BestLoss
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"math"
+	"nn/callback"
+	"nn/metrics"
+	"testing"
+)
+
+func TestLearnRates(t *testing.T) {
+	stepDecay, err := NewStepDecay(1, 0.5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exponentialDecay, err := NewExponentialDecay(1, 0.5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosineWarmRestarts, err := NewCosineWarmRestarts(1, 0, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedules := map[string]struct {
+		schedule Schedule
+		want     []float64 //learning rates of steps 0 to len(want)-1
+	}{
+		"constant":             {NewConstant(0.1), []float64{0.1, 0.1, 0.1}},
+		"step decay":           {stepDecay, []float64{1, 1, 1, 0.5, 0.5, 0.5, 0.25}},
+		"exponential decay":    {exponentialDecay, []float64{1, math.Sqrt(0.5), 0.5, math.Sqrt(0.125), 0.25}},
+		"cosine warm restarts": {cosineWarmRestarts, []float64{1, 0.5, 1, 0.5 + math.Sqrt(0.5)/2, 0.5, 0.5 - math.Sqrt(0.5)/2, 1}},
+		"linear warmup":        {NewLinearWarmup(4, NewConstant(2)), []float64{0.5, 1, 1.5, 2, 2, 2}},
+		"one cycle":            {&OneCycle{MaxLearnRate: 1, NumSteps: 5, PctStart: 0.4, DivFactor: 4, FinalDivFactor: 2}, []float64{0.25, 0.625, 1, 0.78125, 0.34375, 0.125, 0.125}},
+	}
+	for name, test := range schedules {
+		for step, want := range test.want {
+			if got := test.schedule.LearnRate(step); math.Abs(got-want) > 1e-12 {
+				t.Errorf("%s: learning rate of step %d is %g, want %g", name, step, got, want)
+			}
+		}
+	}
+}
+
+func TestConstructorsReject(t *testing.T) {
+	if _, err := NewStepDecay(1, 0.5, 0); err == nil {
+		t.Error("step decay accepted a step size of 0")
+	}
+	if _, err := NewExponentialDecay(1, 0.5, 0); err == nil {
+		t.Error("exponential decay accepted 0 decay steps")
+	}
+	if _, err := NewCosineWarmRestarts(1, 0, 0, 1); err == nil {
+		t.Error("cosine warm restarts accepted a period of 0")
+	}
+	if _, err := NewCosineWarmRestarts(1, 0, 2, 0.5); err == nil {
+		t.Error("cosine warm restarts accepted a shrinking period")
+	}
+}
+
+// observe runs schedule's epoch callback with a validation loss
+func observe(schedule *ReduceOnPlateau, validationLoss float64) {
+	schedule.OnEpochEnd(&callback.State{Validation: &metrics.Report{Loss: validationLoss}})
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	schedule := NewReduceOnPlateau(NewConstant(1), 0.5, 2, 0.1, 0.2)
+	wantRates := []float64{1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.2}
+	for i, validationLoss := range []float64{1, 0.5, 0.45, 0.46, 0.3, 0.3, 0.3, 0.3, 0.3} {
+		observe(schedule, validationLoss)
+		if got := schedule.LearnRate(i); got != wantRates[i] {
+			t.Errorf("after evaluation %d the learning rate is %g, want %g", i, got, wantRates[i])
+		}
+	}
+	schedule.OnEpochEnd(&callback.State{})
+	if got := schedule.LearnRate(0); got != 0.2 {
+		t.Errorf("an epoch without evaluation changed the learning rate to %g", got)
+	}
+}
+
+func TestReduceOnPlateauState(t *testing.T) {
+	original := NewReduceOnPlateau(NewConstant(1), 0.5, 2, 0, 0)
+	resumed := NewReduceOnPlateau(NewConstant(1), 0.5, 2, 0, 0)
+	state, err := resumed.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.RestoreState(state); err != nil {
+		t.Fatalf("restoring the state before any evaluation: %v", err)
+	}
+	for _, validationLoss := range []float64{1, 0.9, 0.95, 0.95} {
+		observe(original, validationLoss)
+	}
+	if state, err = original.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.RestoreState(state); err != nil {
+		t.Fatal(err)
+	}
+	for i, validationLoss := range []float64{0.95, 0.95, 0.8, 0.85, 0.85} {
+		observe(original, validationLoss)
+		observe(resumed, validationLoss)
+		if got, want := resumed.LearnRate(i), original.LearnRate(i); got != want {
+			t.Errorf("evaluation %d after resuming: learning rate %g, want %g", i, got, want)
+		}
+	}
+	if err := resumed.RestoreState([]byte(`{"Scale":0}`)); err == nil {
+		t.Error("restored a scale of 0")
+	}
+}
@@ -0,0 +1,385 @@
+package tabular
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"nn/dataset"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Record is one row of a table. A column that is absent or empty is missing.
+type Record map[string]string
+
+type ColumnType string
+
+const (
+	Numeric     ColumnType = "numeric"
+	Categorical ColumnType = "categorical" //one-hot encoded
+)
+
+type Scaling string
+
+const (
+	NoScaling   Scaling = ""
+	Standardize Scaling = "standardize"
+	MinMax      Scaling = "minMax"
+)
+
+type MissingValues string
+
+const (
+	DropRow      MissingValues = "" //rows with a missing value are skipped
+	FillMean     MissingValues = "mean"
+	FillMode     MissingValues = "mode" //most frequent value
+	FillConstant MissingValues = "constant"
+)
+
+type Column struct {
+	Name    string
+	Type    ColumnType
+	Scaling Scaling       `json:",omitempty"` //numeric columns only
+	Missing MissingValues `json:",omitempty"`
+	Fill    string        `json:",omitempty"` //used with FillConstant
+}
+
+type Schema struct {
+	Features []Column
+	Targets  []Column
+}
+
+// FittedColumn is a column together with what was learned about it from the training data
+type FittedColumn struct {
+	Column
+	Categories []string `json:",omitempty"`
+	Mean       float64
+	StdDev     float64
+	Min        float64
+	Max        float64
+	FillValue  string `json:",omitempty"`
+}
+
+// Preprocessor turns raw records into network inputs and ground truths
+type Preprocessor struct {
+	Features []*FittedColumn
+	Targets  []*FittedColumn
+}
+
+var ErrMissing = errors.New("missing value")
+
+func ReadCSV(reader io.Reader) ([]Record, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no header row")
+	}
+	records := make([]Record, len(rows)-1)
+	for i, row := range rows[1:] {
+		records[i] = Record{}
+		for j, name := range rows[0] {
+			records[i][name] = row[j]
+		}
+	}
+	return records, nil
+}
+
+// ReadJSONL reads one JSON object per line. Numbers and booleans are kept as their JSON text and null counts as missing.
+func ReadJSONL(reader io.Reader) ([]Record, error) {
+	records := []Record{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &values); err != nil {
+			return nil, fmt.Errorf("line %v: %w", lineNumber, err)
+		}
+		records = append(records, ParseJSONRecord(values))
+	}
+	return records, scanner.Err()
+}
+
+func ParseJSONRecord(values map[string]json.RawMessage) Record {
+	record := Record{}
+	for name, value := range values {
+		if string(value) == "null" {
+			continue
+		}
+		stringValue := ""
+		if err := json.Unmarshal(value, &stringValue); err != nil {
+			stringValue = string(value)
+		}
+		record[name] = stringValue
+	}
+	return record
+}
+
+func fitColumn(column Column, records []Record) (*FittedColumn, error) {
+	result := &FittedColumn{Column: column}
+	values := []string{}
+	for _, record := range records {
+		if value := record[column.Name]; value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("column %q has no values", column.Name)
+	}
+
+	counts := map[string]int{}
+	for _, value := range values {
+		counts[value]++
+	}
+	mode := values[0]
+	for value, count := range counts {
+		if count > counts[mode] || (count == counts[mode] && value < mode) {
+			mode = value
+		}
+	}
+
+	switch column.Type {
+	case Categorical:
+		for value := range counts {
+			result.Categories = append(result.Categories, value)
+		}
+		sort.Strings(result.Categories)
+	case Numeric:
+		result.Min = math.Inf(1)
+		result.Max = math.Inf(-1)
+		sum := float64(0)
+		squareSum := float64(0)
+		for _, value := range values {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", column.Name, err)
+			}
+			sum += number
+			squareSum += number * number
+			result.Min = math.Min(result.Min, number)
+			result.Max = math.Max(result.Max, number)
+		}
+		result.Mean = sum / float64(len(values))
+		result.StdDev = math.Sqrt(math.Max(0, squareSum/float64(len(values))-result.Mean*result.Mean))
+	default:
+		return nil, fmt.Errorf("column %q has unknown type %q", column.Name, column.Type)
+	}
+
+	switch column.Scaling {
+	case NoScaling:
+	case Standardize, MinMax:
+		if column.Type != Numeric {
+			return nil, fmt.Errorf("column %q: scaling only works for numeric columns", column.Name)
+		}
+	default:
+		return nil, fmt.Errorf("column %q has unknown scaling %q", column.Name, column.Scaling)
+	}
+
+	switch column.Missing {
+	case DropRow:
+	case FillMean:
+		if column.Type != Numeric {
+			return nil, fmt.Errorf("column %q: mean fill only works for numeric columns", column.Name)
+		}
+		result.FillValue = strconv.FormatFloat(result.Mean, 'g', -1, 64)
+	case FillMode:
+		result.FillValue = mode
+	case FillConstant:
+		result.FillValue = column.Fill
+	default:
+		return nil, fmt.Errorf("column %q has unknown missing value handling %q", column.Name, column.Missing)
+	}
+	return result, nil
+}
+
+// keptRecords leaves out the records that Dataset would skip for a missing value in a column that drops rows
+func keptRecords(schema Schema, records []Record) []Record {
+	result := []Record{}
+	for _, record := range records {
+		kept := true
+		for _, columns := range [][]Column{schema.Features, schema.Targets} {
+			for _, column := range columns {
+				if column.Missing == DropRow && record[column.Name] == "" {
+					kept = false
+				}
+			}
+		}
+		if kept {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// Fit learns categories, scaling statistics and fill values for every column of schema from the records that Dataset keeps
+func Fit(schema Schema, records []Record) (*Preprocessor, error) {
+	if len(schema.Features) == 0 || len(schema.Targets) == 0 {
+		return nil, errors.New("schema needs features and targets")
+	}
+	records = keptRecords(schema, records)
+	preprocessor := &Preprocessor{}
+	for _, column := range schema.Features {
+		fittedColumn, err := fitColumn(column, records)
+		if err != nil {
+			return nil, err
+		}
+		preprocessor.Features = append(preprocessor.Features, fittedColumn)
+	}
+	for _, column := range schema.Targets {
+		fittedColumn, err := fitColumn(column, records)
+		if err != nil {
+			return nil, err
+		}
+		preprocessor.Targets = append(preprocessor.Targets, fittedColumn)
+	}
+	return preprocessor, nil
+}
+
+func (column *FittedColumn) Width() int {
+	if column.Type == Categorical {
+		return len(column.Categories)
+	}
+	return 1
+}
+
+// encode appends the encoding of column's value in record to result. Unknown categories encode as all zeros.
+func (column *FittedColumn) encode(record Record, result []float64) ([]float64, error) {
+	value := record[column.Name]
+	if value == "" {
+		if column.Missing == DropRow {
+			return nil, fmt.Errorf("column %q: %w", column.Name, ErrMissing)
+		}
+		value = column.FillValue
+	}
+	if column.Type == Categorical {
+		for _, category := range column.Categories {
+			if category == value {
+				result = append(result, 1)
+			} else {
+				result = append(result, 0)
+			}
+		}
+		return result, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("column %q: %w", column.Name, err)
+	}
+	switch column.Scaling {
+	case Standardize:
+		if column.StdDev > 0 {
+			number = (number - column.Mean) / column.StdDev
+		} else {
+			number -= column.Mean
+		}
+	case MinMax:
+		if column.Max > column.Min {
+			number = (number - column.Min) / (column.Max - column.Min)
+		} else {
+			number = 0
+		}
+	}
+	return append(result, number), nil
+}
+
+func encodeColumns(columns []*FittedColumn, record Record) (*mat.VecDense, error) {
+	result := []float64{}
+	for _, column := range columns {
+		var err error
+		result, err = column.encode(record, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mat.NewVecDense(len(result), result), nil
+}
+
+func (preprocessor *Preprocessor) NumFeatures() int {
+	result := 0
+	for _, column := range preprocessor.Features {
+		result += column.Width()
+	}
+	return result
+}
+
+func (preprocessor *Preprocessor) NumTargets() int {
+	result := 0
+	for _, column := range preprocessor.Targets {
+		result += column.Width()
+	}
+	return result
+}
+
+func (preprocessor *Preprocessor) TransformFeatures(record Record) (*mat.VecDense, error) {
+	return encodeColumns(preprocessor.Features, record)
+}
+
+func (preprocessor *Preprocessor) Transform(record Record) (*mat.VecDense, *mat.VecDense, error) {
+	input, err := encodeColumns(preprocessor.Features, record)
+	if err != nil {
+		return nil, nil, err
+	}
+	groundTruth, err := encodeColumns(preprocessor.Targets, record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return input, groundTruth, nil
+}
+
+// Dataset transforms every record, skipping those with a missing value in a column that drops rows
+func (preprocessor *Preprocessor) Dataset(records []Record) (dataset.Dataset, error) {
+	inputs := []*mat.VecDense{}
+	groundTruths := []*mat.VecDense{}
+	for i, record := range records {
+		input, groundTruth, err := preprocessor.Transform(record)
+		if errors.Is(err, ErrMissing) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("record %v: %w", i, err)
+		}
+		inputs = append(inputs, input)
+		groundTruths = append(groundTruths, groundTruth)
+	}
+	return dataset.FromSlices(inputs, groundTruths), nil
+}
+
+// Load reads a .csv file, or JSON lines from any other extension, and fits schema to it
+func Load(filename string, schema Schema) (dataset.Dataset, *Preprocessor, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	if filepath.Ext(filename) == ".csv" {
+		records, err = ReadCSV(file)
+	} else {
+		records, err = ReadJSONL(file)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	preprocessor, err := Fit(schema, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := preprocessor.Dataset(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, preprocessor, nil
+}
@@ -0,0 +1,143 @@
+package tabular
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestReadCSV(t *testing.T) {
+	records, err := ReadCSV(strings.NewReader("a,b\n1,x\n,y\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{{"a": "1", "b": "x"}, {"a": "", "b": "y"}}; !reflect.DeepEqual(records, want) {
+		t.Errorf("read %v, want %v", records, want)
+	}
+	if _, err := ReadCSV(strings.NewReader("")); err == nil {
+		t.Error("read a file without a header row")
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	records, err := ReadJSONL(strings.NewReader(`{"a":1.5,"b":"x","c":true}` + "\n\n" + `{"a":null,"b":"y"}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{{"a": "1.5", "b": "x", "c": "true"}, {"b": "y"}}; !reflect.DeepEqual(records, want) {
+		t.Errorf("read %v, want %v", records, want)
+	}
+	if _, err := ReadJSONL(strings.NewReader("{\"a\":1}\n{")); err == nil {
+		t.Error("read a malformed line")
+	}
+}
+
+var testRecords = []Record{
+	{"size": "1", "color": "red", "weight": "10", "label": "0"},
+	{"size": "3", "color": "blue", "weight": "", "label": "1"},
+	{"size": "", "color": "red", "weight": "30", "label": "1"},
+	{"size": "5", "color": "", "weight": "20", "label": "0"},
+	{"size": "100", "color": "green", "weight": "40", "label": ""}, //dropped for its label, so it doesn't count when fitting
+}
+
+var testSchema = Schema{
+	Features: []Column{
+		{Name: "size", Type: Numeric, Scaling: Standardize, Missing: FillMean},
+		{Name: "color", Type: Categorical, Missing: FillMode},
+		{Name: "weight", Type: Numeric, Scaling: MinMax, Missing: FillConstant, Fill: "15"},
+	},
+	Targets: []Column{{Name: "label", Type: Numeric}},
+}
+
+func TestFitAndTransform(t *testing.T) {
+	preprocessor, err := Fit(testSchema, testRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := preprocessor.Features[0]
+	if size.Mean != 3 || math.Abs(size.StdDev-math.Sqrt(8.0/3)) > 1e-12 || size.FillValue != "3" {
+		t.Errorf("size fitted to mean %v, standard deviation %v and fill %q", size.Mean, size.StdDev, size.FillValue)
+	}
+	if color := preprocessor.Features[1]; !reflect.DeepEqual(color.Categories, []string{"blue", "red"}) || color.FillValue != "red" {
+		t.Errorf("color fitted to categories %v and fill %q", color.Categories, color.FillValue)
+	}
+	if weight := preprocessor.Features[2]; weight.Min != 10 || weight.Max != 30 {
+		t.Errorf("weight fitted to [%v, %v]", weight.Min, weight.Max)
+	}
+	if preprocessor.NumFeatures() != 4 || preprocessor.NumTargets() != 1 {
+		t.Errorf("%v features and %v targets", preprocessor.NumFeatures(), preprocessor.NumTargets())
+	}
+
+	data, err := preprocessor.Dataset(testRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Len() != 4 {
+		t.Fatalf("%v samples, want the 4 with a label", data.Len())
+	}
+	scale := math.Sqrt(8.0 / 3)
+	wantInputs := [][]float64{{-2 / scale, 0, 1, 0}, {0, 1, 0, 0.25}, {0, 0, 1, 1}, {2 / scale, 0, 1, 0.5}}
+	for i, want := range wantInputs {
+		input, groundTruth := data.Get(i)
+		if !mat.EqualApprox(input, mat.NewVecDense(4, want), 1e-12) {
+			t.Errorf("sample %d: input %v, want %v", i, mat.Formatted(input.T()), want)
+		}
+		if groundTruth.AtVec(0) != []float64{0, 1, 1, 0}[i] {
+			t.Errorf("sample %d: target %v", i, groundTruth.AtVec(0))
+		}
+	}
+
+	input, err := preprocessor.TransformFeatures(Record{"size": "3", "color": "purple", "weight": "30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mat.Equal(input, mat.NewVecDense(4, []float64{0, 0, 0, 1})) {
+		t.Errorf("unknown category encoded as %v", mat.Formatted(input.T()))
+	}
+	if _, err := preprocessor.TransformFeatures(Record{"size": "x", "color": "red", "weight": "1"}); err == nil {
+		t.Error("transformed a non-numeric value")
+	}
+}
+
+func TestFitRejects(t *testing.T) {
+	label := Column{Name: "label", Type: Numeric}
+	schemas := map[string]Schema{
+		"no features":           {Targets: []Column{label}},
+		"no targets":            {Features: []Column{label}},
+		"unknown type":          {Features: []Column{{Name: "size", Type: "number"}}, Targets: []Column{label}},
+		"unknown scaling":       {Features: []Column{{Name: "size", Type: Numeric, Scaling: "minmax"}}, Targets: []Column{label}},
+		"categorical scaling":   {Features: []Column{{Name: "color", Type: Categorical, Scaling: Standardize}}, Targets: []Column{label}},
+		"categorical mean fill": {Features: []Column{{Name: "color", Type: Categorical, Missing: FillMean}}, Targets: []Column{label}},
+		"unknown fill":          {Features: []Column{{Name: "size", Type: Numeric, Missing: "median"}}, Targets: []Column{label}},
+		"column without values": {Features: []Column{{Name: "nope", Type: Numeric, Missing: FillConstant, Fill: "0"}}, Targets: []Column{label}},
+		"non-numeric values":    {Features: []Column{{Name: "color", Type: Numeric}}, Targets: []Column{label}},
+	}
+	for name, schema := range schemas {
+		if _, err := Fit(schema, testRecords); err == nil {
+			t.Errorf("%s: fitted without an error", name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(filename, []byte("size,label\n1,0\n2,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, preprocessor, err := Load(filename, Schema{Features: []Column{{Name: "size", Type: Numeric, Scaling: MinMax}}, Targets: []Column{{Name: "label", Type: Categorical}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Len() != 2 || preprocessor.NumTargets() != 2 {
+		t.Fatalf("%v samples and %v targets", data.Len(), preprocessor.NumTargets())
+	}
+	input, groundTruth := data.Get(1)
+	if input.AtVec(0) != 1 || !mat.Equal(groundTruth, mat.NewVecDense(2, []float64{0, 1})) {
+		t.Errorf("second sample is %v, %v", mat.Formatted(input.T()), mat.Formatted(groundTruth.T()))
+	}
+}